@@ -0,0 +1,158 @@
+package answer
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/suryasaputra2016/course/backend/expression"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+// defaultRelTolerance is used when a spec sets neither tolerance
+const defaultRelTolerance = 0.01
+
+// Check compares a submitted answer like "9.81 m/s^2" against spec, or a
+// formula like "sqrt(2*g*h)" when spec has a symbolic answer
+func Check(spec model.AnswerSpec, submitted string) model.Verdict {
+	if spec.SymbolicAnswer != "" {
+		return checkSymbolic(spec, submitted)
+	}
+	verdict := model.Verdict{Submitted: submitted}
+
+	numberStr, unitStr := splitNumber(strings.TrimSpace(submitted))
+	value, err := strconv.ParseFloat(numberStr, 64)
+	if err != nil {
+		verdict.Reason = model.VerdictReasonMalformed
+		return verdict
+	}
+	verdict.SubmittedValue = value
+	verdict.SubmittedUnit = unitStr
+	verdict.SigFigs = CountSigFigs(numberStr)
+
+	converted, err := Convert(value, unitStr, spec.Unit)
+	if err != nil {
+		verdict.Reason = model.VerdictReasonUnit
+		return verdict
+	}
+	verdict.ConvertedValue = converted
+
+	diff := math.Abs(converted - spec.Value)
+	if spec.Value != 0 {
+		verdict.RelativeError = diff / math.Abs(spec.Value)
+	}
+
+	if !withinTolerance(spec, diff) {
+		verdict.Reason = model.VerdictReasonValue
+		return verdict
+	}
+
+	if spec.SigFigs > 0 && abs(verdict.SigFigs-spec.SigFigs) > spec.SigFigSlack {
+		verdict.Reason = model.VerdictReasonSigFigs
+		return verdict
+	}
+
+	verdict.IsCorrect = true
+	verdict.Reason = model.VerdictReasonCorrect
+	return verdict
+}
+
+func checkSymbolic(spec model.AnswerSpec, submitted string) model.Verdict {
+	verdict := model.Verdict{Submitted: submitted}
+
+	reference, err := expression.Parse(spec.SymbolicAnswer)
+	if err != nil {
+		// the spec is validated on save, so this is not the user's fault
+		log.Printf("parsing reference formula: %s", err)
+		verdict.Reason = model.VerdictReasonMalformed
+		return verdict
+	}
+	formula, err := expression.Parse(submitted)
+	if err != nil {
+		verdict.Reason = model.VerdictReasonMalformed
+		return verdict
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(spec.SymbolicAnswer))
+	isEquivalent, err := expression.Equivalent(formula, reference, spec.Constants, h.Sum64())
+	if errors.Is(err, expression.ErrUnknownSymbol) {
+		verdict.Reason = model.VerdictReasonSymbol
+		return verdict
+	}
+	if err != nil || !isEquivalent {
+		verdict.Reason = model.VerdictReasonFormula
+		return verdict
+	}
+
+	verdict.IsCorrect = true
+	verdict.Reason = model.VerdictReasonCorrect
+	return verdict
+}
+
+// Convert expresses value in unit from as a value in unit to
+func Convert(value float64, from, to string) (float64, error) {
+	fromQ, err := ParseUnit(from)
+	if err != nil {
+		return 0, fmt.Errorf("parsing unit %q: %w", from, err)
+	}
+	toQ, err := ParseUnit(to)
+	if err != nil {
+		return 0, fmt.Errorf("parsing unit %q: %w", to, err)
+	}
+	if fromQ.Dimension != toQ.Dimension {
+		return 0, fmt.Errorf("unit %q cannot convert to %q", from, to)
+	}
+	return value * fromQ.Factor / toQ.Factor, nil
+}
+
+func withinTolerance(spec model.AnswerSpec, diff float64) bool {
+	relTolerance := spec.RelTolerance
+	if spec.RelTolerance == 0 && spec.AbsTolerance == 0 {
+		relTolerance = defaultRelTolerance
+	}
+	if diff <= spec.AbsTolerance {
+		return true
+	}
+	return diff <= relTolerance*math.Abs(spec.Value)
+}
+
+// splitNumber separates the leading number of an answer from its unit
+func splitNumber(s string) (string, string) {
+	end := 0
+	for end < len(s) {
+		c := rune(s[end])
+		isExp := (c == 'e' || c == 'E') && end > 0 && end+1 < len(s) &&
+			(unicode.IsDigit(rune(s[end+1])) || s[end+1] == '-' || s[end+1] == '+')
+		isSign := (c == '-' || c == '+') && (end == 0 || s[end-1] == 'e' || s[end-1] == 'E')
+		if !unicode.IsDigit(c) && c != '.' && !isExp && !isSign {
+			break
+		}
+		end++
+	}
+	return s[:end], strings.TrimSpace(s[end:])
+}
+
+// CountSigFigs counts the significant figures of a decimal number string,
+// trailing zeros of a number without a decimal point are not significant
+func CountSigFigs(number string) int {
+	mantissa := strings.TrimLeft(number, "+-")
+	if i := strings.IndexAny(mantissa, "eE"); i >= 0 {
+		mantissa = mantissa[:i]
+	}
+	hasPoint := strings.Contains(mantissa, ".")
+	digits := strings.ReplaceAll(mantissa, ".", "")
+	digits = strings.TrimLeft(digits, "0")
+	if !hasPoint {
+		digits = strings.TrimRight(digits, "0")
+	}
+	if digits == "" {
+		return 1
+	}
+	return len(digits)
+}
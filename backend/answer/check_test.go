@@ -0,0 +1,68 @@
+package answer
+
+import (
+	"testing"
+
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+func TestCheck(t *testing.T) {
+	fall := model.AnswerSpec{Value: 19.6, Unit: "m"}
+	fallSpeed := model.AnswerSpec{SymbolicAnswer: "sqrt(2*g*h)", Constants: []string{"g"}}
+	tests := []struct {
+		name      string
+		spec      model.AnswerSpec
+		submitted string
+		want      string
+	}{
+		{"exact", fall, "19.6 m", model.VerdictReasonCorrect},
+		{"other unit", fall, "1960 cm", model.VerdictReasonCorrect},
+		{"within default tolerance", fall, "19.7 m", model.VerdictReasonCorrect},
+		{"outside default tolerance", fall, "18 m", model.VerdictReasonValue},
+		{"exponent", fall, "1.96e1 m", model.VerdictReasonCorrect},
+		{"no number", fall, "m", model.VerdictReasonMalformed},
+		{"wrong dimension", fall, "19.6 s", model.VerdictReasonUnit},
+		{"unknown unit", fall, "19.6 furlong", model.VerdictReasonUnit},
+		{"missing unit", fall, "19.6", model.VerdictReasonUnit},
+		{"absolute tolerance", model.AnswerSpec{Value: 0, Unit: "m/s", AbsTolerance: 0.1}, "0.05 m/s", model.VerdictReasonCorrect},
+		{"relative tolerance", model.AnswerSpec{Value: 100, Unit: "N", RelTolerance: 0.001}, "100.2 N", model.VerdictReasonValue},
+		{"sig figs", model.AnswerSpec{Value: 9.81, Unit: "m/s^2", SigFigs: 3}, "9.810 m/s^2", model.VerdictReasonSigFigs},
+		{"sig fig slack", model.AnswerSpec{Value: 9.81, Unit: "m/s^2", SigFigs: 3, SigFigSlack: 1}, "9.810 m/s^2", model.VerdictReasonCorrect},
+		{"formula", fallSpeed, "sqrt(2*h*g)", model.VerdictReasonCorrect},
+		{"formula with constant written out", fallSpeed, "sqrt(19.6133*h)", model.VerdictReasonCorrect},
+		{"wrong formula", fallSpeed, "2*g*h", model.VerdictReasonFormula},
+		{"height is not planck's constant", fallSpeed, "sqrt(2*g*h)+h", model.VerdictReasonFormula},
+		{"formula with unknown symbol", fallSpeed, "sqrt(2*g*z)", model.VerdictReasonSymbol},
+		{"malformed formula", fallSpeed, "sqrt(2*g*h", model.VerdictReasonMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict := Check(tt.spec, tt.submitted)
+			if verdict.Reason != tt.want {
+				t.Fatalf("Check(%q) reason = %q, want %q", tt.submitted, verdict.Reason, tt.want)
+			}
+			if verdict.IsCorrect != (tt.want == model.VerdictReasonCorrect) {
+				t.Errorf("Check(%q) is correct = %t with reason %q", tt.submitted, verdict.IsCorrect, verdict.Reason)
+			}
+		})
+	}
+}
+
+func TestCountSigFigs(t *testing.T) {
+	tests := map[string]int{
+		"9.81":     3,
+		"9.810":    4,
+		"0.0050":   2,
+		"1200":     2,
+		"1200.":    4,
+		"-3.0e8":   2,
+		"0":        1,
+		"100.00":   5,
+		"+6.02e23": 3,
+	}
+	for number, want := range tests {
+		if got := CountSigFigs(number); got != want {
+			t.Errorf("CountSigFigs(%q) = %d, want %d", number, got, want)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package answer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Dimension holds the exponents of the seven SI base quantities:
+// length, mass, time, current, temperature, amount and luminous intensity
+type Dimension [7]int
+
+// Quantity is a unit expressed as a factor of SI base units
+type Quantity struct {
+	Factor    float64
+	Dimension Dimension
+}
+
+type unitDef struct {
+	quantity   Quantity
+	prefixable bool
+}
+
+var (
+	dimLength      = Dimension{1, 0, 0, 0, 0, 0, 0}
+	dimMass        = Dimension{0, 1, 0, 0, 0, 0, 0}
+	dimTime        = Dimension{0, 0, 1, 0, 0, 0, 0}
+	dimCurrent     = Dimension{0, 0, 0, 1, 0, 0, 0}
+	dimTemperature = Dimension{0, 0, 0, 0, 1, 0, 0}
+	dimAmount      = Dimension{0, 0, 0, 0, 0, 1, 0}
+	dimLuminous    = Dimension{0, 0, 0, 0, 0, 0, 1}
+	dimNone        = Dimension{}
+
+	dimForce   = Dimension{1, 1, -2, 0, 0, 0, 0}
+	dimEnergy  = Dimension{2, 1, -2, 0, 0, 0, 0}
+	dimPower   = Dimension{2, 1, -3, 0, 0, 0, 0}
+	dimPress   = Dimension{-1, 1, -2, 0, 0, 0, 0}
+	dimCharge  = Dimension{0, 0, 1, 1, 0, 0, 0}
+	dimVoltage = Dimension{2, 1, -3, -1, 0, 0, 0}
+)
+
+// units is the dimensional-analysis table, every entry is relative to SI base units
+var units = map[string]unitDef{
+	"m":   {Quantity{1, dimLength}, true},
+	"g":   {Quantity{1e-3, dimMass}, true},
+	"s":   {Quantity{1, dimTime}, true},
+	"A":   {Quantity{1, dimCurrent}, true},
+	"K":   {Quantity{1, dimTemperature}, true},
+	"mol": {Quantity{1, dimAmount}, true},
+	"cd":  {Quantity{1, dimLuminous}, true},
+
+	"N":   {Quantity{1, dimForce}, true},
+	"J":   {Quantity{1, dimEnergy}, true},
+	"W":   {Quantity{1, dimPower}, true},
+	"Pa":  {Quantity{1, dimPress}, true},
+	"Hz":  {Quantity{1, Dimension{0, 0, -1, 0, 0, 0, 0}}, true},
+	"C":   {Quantity{1, dimCharge}, true},
+	"V":   {Quantity{1, dimVoltage}, true},
+	"ohm": {Quantity{1, Dimension{2, 1, -3, -2, 0, 0, 0}}, true},
+	"Ω":   {Quantity{1, Dimension{2, 1, -3, -2, 0, 0, 0}}, true},
+	"F":   {Quantity{1, Dimension{-2, -1, 4, 2, 0, 0, 0}}, true},
+	"T":   {Quantity{1, Dimension{0, 1, -2, -1, 0, 0, 0}}, true},
+	"Wb":  {Quantity{1, Dimension{2, 1, -2, -1, 0, 0, 0}}, true},
+	"H":   {Quantity{1, Dimension{2, 1, -2, -2, 0, 0, 0}}, true},
+	"eV":  {Quantity{1.602176634e-19, dimEnergy}, true},
+	"L":   {Quantity{1e-3, Dimension{3, 0, 0, 0, 0, 0, 0}}, true},
+	"rad": {Quantity{1, dimNone}, false},
+	"sr":  {Quantity{1, dimNone}, false},
+
+	"min": {Quantity{60, dimTime}, false},
+	"h":   {Quantity{3600, dimTime}, false},
+	"cal": {Quantity{4.184, dimEnergy}, true},
+	"atm": {Quantity{101325, dimPress}, false},
+	"bar": {Quantity{1e5, dimPress}, true},
+	"deg": {Quantity{3.141592653589793 / 180, dimNone}, false},
+	"°":   {Quantity{3.141592653589793 / 180, dimNone}, false},
+}
+
+type prefix struct {
+	symbol string
+	factor float64
+}
+
+// prefixes are tried in order, so "da" must come before "d"
+var prefixes = []prefix{
+	{"da", 1e1},
+	{"Y", 1e24}, {"Z", 1e21}, {"E", 1e18}, {"P", 1e15}, {"T", 1e12}, {"G", 1e9},
+	{"M", 1e6}, {"k", 1e3}, {"h", 1e2}, {"d", 1e-1}, {"c", 1e-2},
+	{"m", 1e-3}, {"u", 1e-6}, {"µ", 1e-6}, {"μ", 1e-6}, {"n", 1e-9}, {"p", 1e-12},
+	{"f", 1e-15}, {"a", 1e-18}, {"z", 1e-21}, {"y", 1e-24},
+}
+
+func (d Dimension) add(other Dimension, times int) Dimension {
+	for i := range d {
+		d[i] += other[i] * times
+	}
+	return d
+}
+
+func (q Quantity) pow(exp int) Quantity {
+	result := Quantity{Factor: 1}
+	for range abs(exp) {
+		result.Factor *= q.Factor
+	}
+	if exp < 0 {
+		result.Factor = 1 / result.Factor
+	}
+	result.Dimension = result.Dimension.add(q.Dimension, exp)
+	return result
+}
+
+func (q Quantity) mul(other Quantity) Quantity {
+	return Quantity{
+		Factor:    q.Factor * other.Factor,
+		Dimension: q.Dimension.add(other.Dimension, 1),
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// lookupUnit finds a unit symbol, trying an exact match before an SI prefix
+func lookupUnit(symbol string) (Quantity, error) {
+	if def, ok := units[symbol]; ok {
+		return def.quantity, nil
+	}
+	for _, p := range prefixes {
+		rest, ok := strings.CutPrefix(symbol, p.symbol)
+		if !ok || rest == "" {
+			continue
+		}
+		def, ok := units[rest]
+		if ok && def.prefixable {
+			return Quantity{Factor: p.factor * def.quantity.Factor, Dimension: def.quantity.Dimension}, nil
+		}
+	}
+	return Quantity{}, fmt.Errorf("unknown unit %q", symbol)
+}
+
+// ParseUnit converts a unit expression such as "m/s^2", "cm s^-2" or
+// "kg*m/(s^2)" to a factor and dimension; an empty string is dimensionless
+func ParseUnit(expr string) (Quantity, error) {
+	p := unitParser{input: []rune(strings.TrimSpace(expr))}
+	if len(p.input) == 0 {
+		return Quantity{Factor: 1}, nil
+	}
+	q, err := p.parseProduct()
+	if err != nil {
+		return Quantity{}, err
+	}
+	if p.pos < len(p.input) {
+		return Quantity{}, fmt.Errorf("unexpected %q in unit", string(p.input[p.pos]))
+	}
+	return q, nil
+}
+
+type unitParser struct {
+	input []rune
+	pos   int
+}
+
+func (p *unitParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *unitParser) peek() rune {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+// parseProduct reads factors joined by "*", "·", "/" or plain spaces,
+// a "/" inverts only the factor right after it
+func (p *unitParser) parseProduct() (Quantity, error) {
+	result, err := p.parseFactor()
+	if err != nil {
+		return Quantity{}, err
+	}
+	for {
+		next := p.peek()
+		invert := false
+		switch {
+		case next == '*' || next == '·':
+			p.pos++
+		case next == '/':
+			p.pos++
+			invert = true
+		case next == '(' || isUnitRune(next):
+		default:
+			return result, nil
+		}
+		factor, err := p.parseFactor()
+		if err != nil {
+			return Quantity{}, err
+		}
+		if invert {
+			factor = factor.pow(-1)
+		}
+		result = result.mul(factor)
+	}
+}
+
+func (p *unitParser) parseFactor() (Quantity, error) {
+	var base Quantity
+	next := p.peek()
+	switch {
+	case next == '(':
+		p.pos++
+		inner, err := p.parseProduct()
+		if err != nil {
+			return Quantity{}, err
+		}
+		if p.peek() != ')' {
+			return Quantity{}, fmt.Errorf("missing closing parenthesis in unit")
+		}
+		p.pos++
+		base = inner
+	case isUnitRune(next):
+		start := p.pos
+		for p.pos < len(p.input) && isUnitRune(p.input[p.pos]) {
+			p.pos++
+		}
+		q, err := lookupUnit(string(p.input[start:p.pos]))
+		if err != nil {
+			return Quantity{}, err
+		}
+		base = q
+	default:
+		return Quantity{}, fmt.Errorf("expected unit at position %d", p.pos)
+	}
+
+	exp, err := p.parseExponent()
+	if err != nil {
+		return Quantity{}, err
+	}
+	return base.pow(exp), nil
+}
+
+// parseExponent reads an optional "^n" or "**n" after a factor
+func (p *unitParser) parseExponent() (int, error) {
+	rest := string(p.input[p.pos:])
+	switch {
+	case strings.HasPrefix(rest, "^"):
+		p.pos++
+	case strings.HasPrefix(rest, "**"):
+		p.pos += 2
+	default:
+		return 1, nil
+	}
+	start := p.pos
+	if p.pos < len(p.input) && (p.input[p.pos] == '-' || p.input[p.pos] == '+') {
+		p.pos++
+	}
+	for p.pos < len(p.input) && unicode.IsDigit(p.input[p.pos]) {
+		p.pos++
+	}
+	exp, err := strconv.Atoi(string(p.input[start:p.pos]))
+	if err != nil {
+		return 0, fmt.Errorf("invalid unit exponent: %w", err)
+	}
+	return exp, nil
+}
+
+func isUnitRune(r rune) bool {
+	return unicode.IsLetter(r) || r == 'Ω' || r == '°' || r == 'µ'
+}
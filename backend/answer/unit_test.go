@@ -0,0 +1,89 @@
+package answer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseUnit(t *testing.T) {
+	tests := []struct {
+		expr      string
+		factor    float64
+		dimension Dimension
+	}{
+		{"", 1, dimNone},
+		{"m", 1, dimLength},
+		{"km", 1e3, dimLength},
+		{"dam", 10, dimLength},
+		{"dm", 0.1, dimLength},
+		{"daN", 10, dimForce},
+		{"mm", 1e-3, dimLength},
+		{"Mm", 1e6, dimLength},
+		{"µs", 1e-6, dimTime},
+		{"μs", 1e-6, dimTime},
+		{"us", 1e-6, dimTime},
+		{"mmol", 1e-3, dimAmount},
+		{"Pa", 1, dimPress},
+		{"kPa", 1e3, dimPress},
+		{"min", 60, dimTime},
+		{"h", 3600, dimTime},
+		{"cd", 1, dimLuminous},
+		{"m/s^2", 1, Dimension{1, 0, -2, 0, 0, 0, 0}},
+		{"cm s^-2", 1e-2, Dimension{1, 0, -2, 0, 0, 0, 0}},
+		{"kg*m/(s^2)", 1, dimForce},
+		{"kg·m**2/s**2", 1, dimEnergy},
+		{"kW h", 3.6e6, dimEnergy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			// every run looks the prefixes up again, an order that depends on
+			// map iteration would show up as a flaky result
+			for range 20 {
+				q, err := ParseUnit(tt.expr)
+				if err != nil {
+					t.Fatalf("ParseUnit(%q) = %v", tt.expr, err)
+				}
+				if math.Abs(q.Factor-tt.factor) > 1e-9*tt.factor || q.Dimension != tt.dimension {
+					t.Fatalf("ParseUnit(%q) = %+v, want factor %g and dimension %v", tt.expr, q, tt.factor, tt.dimension)
+				}
+			}
+		})
+	}
+}
+
+func TestParseUnitErrors(t *testing.T) {
+	for _, expr := range []string{"furlong", "kmin", "krad", "m^", "m^x", "(m/s", "m)", "m/"} {
+		if q, err := ParseUnit(expr); err == nil {
+			t.Errorf("ParseUnit(%q) = %+v, want an error", expr, q)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		value    float64
+		from, to string
+		want     float64
+	}{
+		{1, "km", "m", 1000},
+		{90, "km/h", "m/s", 25},
+		{1, "atm", "kPa", 101.325},
+		{180, "deg", "rad", math.Pi},
+		{2, "L", "cm^3", 2000},
+		{1, "eV", "J", 1.602176634e-19},
+	}
+	for _, tt := range tests {
+		got, err := Convert(tt.value, tt.from, tt.to)
+		if err != nil {
+			t.Errorf("Convert(%g, %q, %q) = %v", tt.value, tt.from, tt.to, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9*math.Abs(tt.want) {
+			t.Errorf("Convert(%g, %q, %q) = %g, want %g", tt.value, tt.from, tt.to, got, tt.want)
+		}
+	}
+
+	if _, err := Convert(1, "m", "s"); err == nil {
+		t.Error("Convert from m to s succeeded, want a dimension error")
+	}
+}
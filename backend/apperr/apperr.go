@@ -0,0 +1,111 @@
+// Package apperr holds the domain errors shared by repos, handlers and middleware,
+// each kind is turned into one http status by the problem package
+package apperr
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrValidation   = errors.New("validation failed")
+	ErrRateLimited  = errors.New("too many requests")
+)
+
+// Error is a domain error of one Kind whose Message and Fields are safe to
+// show to the client, Err is the cause that only goes to the log
+type Error struct {
+	Kind    error
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+// FieldError explains why one field of the request is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Kind.Error())
+	if e.Message != "" {
+		b.WriteString(": " + e.Message)
+	}
+	for _, f := range e.Fields {
+		b.WriteString("; " + f.Field + " " + f.Message)
+	}
+	if e.Err != nil {
+		b.WriteString(": " + e.Err.Error())
+	}
+	return b.String()
+}
+
+// Unwrap lets errors.Is match both the kind and the cause
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// Wrap returns a copy of e with err as its cause
+func (e *Error) Wrap(err error) *Error {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+func NotFound(message string) *Error {
+	return &Error{Kind: ErrNotFound, Message: message}
+}
+
+func Conflict(message string) *Error {
+	return &Error{Kind: ErrConflict, Message: message}
+}
+
+func Unauthorized(message string) *Error {
+	return &Error{Kind: ErrUnauthorized, Message: message}
+}
+
+func Forbidden(message string) *Error {
+	return &Error{Kind: ErrForbidden, Message: message}
+}
+
+func RateLimited(message string) *Error {
+	return &Error{Kind: ErrRateLimited, Message: message}
+}
+
+// BadRequest is a validation error about the request as a whole, such as a body that is not JSON
+func BadRequest(message string) *Error {
+	return &Error{Kind: ErrValidation, Message: message}
+}
+
+// Invalid is a validation error about one field
+func Invalid(field, message string) *Error {
+	return &Error{
+		Kind:    ErrValidation,
+		Message: "request has invalid fields",
+		Fields:  []FieldError{{Field: field, Message: message}},
+	}
+}
+
+// FieldErrors collects the invalid fields of a request
+type FieldErrors []FieldError
+
+func (fe *FieldErrors) Add(field, message string) {
+	*fe = append(*fe, FieldError{Field: field, Message: message})
+}
+
+// Err returns a validation error listing every field, or nil when none was added
+func (fe FieldErrors) Err() error {
+	if len(fe) == 0 {
+		return nil
+	}
+	return &Error{Kind: ErrValidation, Message: "request has invalid fields", Fields: fe}
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/suryasaputra2016/course/backend/utils"
+)
+
+// base url of the front-end used in email links, APP_BASE_URL overrides the default
+func AppBaseURL() string {
+	godotenv.Load()
+	baseURL := os.Getenv("APP_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8081"
+	}
+	return strings.TrimRight(baseURL, "/")
+}
+
+// email of the user made admin at start up while nobody holds the admin role,
+// ADMIN_EMAIL is empty by default so no user is
+func AdminEmail() string {
+	godotenv.Load()
+	return utils.NormalizeEmail(os.Getenv("ADMIN_EMAIL"))
+}
+
+// RelyingParty is where passkeys are valid
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// load the passkey relying party from environment, PASSKEY_RP_ID defaults to
+// the host of AppBaseURL, PASSKEY_RP_NAME to Course and PASSKEY_ORIGINS, a
+// comma separated list, to the origin of AppBaseURL
+func LoadRelyingParty() RelyingParty {
+	godotenv.Load()
+	baseURL, err := url.Parse(AppBaseURL())
+	if err != nil {
+		baseURL = &url.URL{}
+	}
+	rp := RelyingParty{
+		ID:      os.Getenv("PASSKEY_RP_ID"),
+		Name:    os.Getenv("PASSKEY_RP_NAME"),
+		Origins: []string{baseURL.Scheme + "://" + baseURL.Host},
+	}
+	if rp.ID == "" {
+		rp.ID = baseURL.Hostname()
+	}
+	if rp.Name == "" {
+		rp.Name = "Course"
+	}
+	if origins := os.Getenv("PASSKEY_ORIGINS"); origins != "" {
+		rp.Origins = nil
+		for _, origin := range strings.Split(origins, ",") {
+			rp.Origins = append(rp.Origins, strings.TrimRight(strings.TrimSpace(origin), "/"))
+		}
+	}
+	return rp
+}
+
+// OIDCProvider is an OpenID Connect provider users can log in with
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// load the OpenID Connect providers from environment. OIDC_PROVIDERS is a
+// comma separated list of names, each configured by OIDC_<NAME>_ISSUER,
+// OIDC_<NAME>_CLIENT_ID and OIDC_<NAME>_CLIENT_SECRET. OIDC_<NAME>_SCOPES
+// defaults to "email profile" and OIDC_<NAME>_REDIRECT_URL to the page
+// /oauth/<name>/callback of AppBaseURL.
+func LoadOIDCProviders() []OIDCProvider {
+	godotenv.Load()
+	var providers []OIDCProvider
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := OIDCProvider{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if provider.RedirectURL == "" {
+			provider.RedirectURL = AppBaseURL() + "/oauth/" + name + "/callback"
+		}
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = []string{"email", "profile"}
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
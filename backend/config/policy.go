@@ -0,0 +1,93 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// LoginPolicy holds the rules LoginUser enforces beyond a correct password
+type LoginPolicy struct {
+	RequireVerifiedEmail bool
+	// LockoutThreshold failed logins in a row lock the account for
+	// LockoutBase, doubling with every further failure up to LockoutMax.
+	// A zero threshold never locks.
+	LockoutThreshold int
+	LockoutBase      time.Duration
+	LockoutMax       time.Duration
+}
+
+// load login policy from environment, REQUIRE_VERIFIED_EMAIL defaults to false,
+// LOGIN_LOCKOUT_THRESHOLD to 5, LOGIN_LOCKOUT_BASE to 1m and LOGIN_LOCKOUT_MAX to 1h
+func LoadLoginPolicy() LoginPolicy {
+	godotenv.Load()
+	requireVerified, _ := strconv.ParseBool(os.Getenv("REQUIRE_VERIFIED_EMAIL"))
+	return LoginPolicy{
+		RequireVerifiedEmail: requireVerified,
+		LockoutThreshold:     envInt("LOGIN_LOCKOUT_THRESHOLD", 5),
+		LockoutBase:          envDuration("LOGIN_LOCKOUT_BASE", time.Minute),
+		LockoutMax:           envDuration("LOGIN_LOCKOUT_MAX", time.Hour),
+	}
+}
+
+// Lockout is how long an account is locked after failures failed logins in a row
+func (p LoginPolicy) Lockout(failures int) time.Duration {
+	if p.LockoutThreshold <= 0 || failures < p.LockoutThreshold {
+		return 0
+	}
+	lockout := p.LockoutBase
+	for range failures - p.LockoutThreshold {
+		if lockout >= p.LockoutMax {
+			break
+		}
+		lockout *= 2
+	}
+	return min(lockout, p.LockoutMax)
+}
+
+// PasswordPolicy holds the rules a new password must follow
+type PasswordPolicy struct {
+	MinLength int
+	// MaxBytes can't be more than 72, bcrypt ignores anything after it
+	MaxBytes int
+	// MinClasses is how many of lowercase, uppercase, digits and symbols a
+	// password mixes
+	MinClasses     int
+	RejectBreached bool
+}
+
+// load password policy from environment, PASSWORD_MIN_LENGTH defaults to 8,
+// PASSWORD_MAX_BYTES to 72, PASSWORD_MIN_CLASSES to 2 and
+// PASSWORD_REJECT_BREACHED to true
+func LoadPasswordPolicy() PasswordPolicy {
+	godotenv.Load()
+	policy := PasswordPolicy{
+		MinLength:      envInt("PASSWORD_MIN_LENGTH", 8),
+		MaxBytes:       min(envInt("PASSWORD_MAX_BYTES", 72), 72),
+		MinClasses:     envInt("PASSWORD_MIN_CLASSES", 2),
+		RejectBreached: true,
+	}
+	rejectBreached, err := strconv.ParseBool(os.Getenv("PASSWORD_REJECT_BREACHED"))
+	if err == nil {
+		policy.RejectBreached = rejectBreached
+	}
+	return policy
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return d
+}
+
+func envInt(key string, fallback int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return n
+}
@@ -0,0 +1,93 @@
+package expression
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Node is a parsed expression
+type Node interface {
+	// Eval computes the node with variables taken from env
+	Eval(env Env) (float64, error)
+	String() string
+}
+
+// Env maps variable names to their values
+type Env map[string]float64
+
+type Number struct {
+	Value float64
+}
+
+type Variable struct {
+	Name string
+}
+
+type Unary struct {
+	Op string
+	X  Node
+}
+
+type Binary struct {
+	Op    string
+	Left  Node
+	Right Node
+}
+
+type Call struct {
+	Func string
+	Args []Node
+}
+
+func (n Number) String() string {
+	return strconv.FormatFloat(n.Value, 'g', -1, 64)
+}
+
+func (v Variable) String() string {
+	return v.Name
+}
+
+func (u Unary) String() string {
+	return "(" + u.Op + u.X.String() + ")"
+}
+
+func (b Binary) String() string {
+	return "(" + b.Left.String() + " " + b.Op + " " + b.Right.String() + ")"
+}
+
+func (c Call) String() string {
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = arg.String()
+	}
+	return c.Func + "(" + strings.Join(args, ", ") + ")"
+}
+
+// Variables returns the sorted names of the variables used in node
+func Variables(node Node) []string {
+	seen := map[string]bool{}
+	collectVariables(node, seen)
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func collectVariables(node Node, seen map[string]bool) {
+	switch n := node.(type) {
+	case Variable:
+		seen[n.Name] = true
+	case Unary:
+		collectVariables(n.X, seen)
+	case Binary:
+		collectVariables(n.Left, seen)
+		collectVariables(n.Right, seen)
+	case Call:
+		for _, arg := range n.Args {
+			collectVariables(arg, seen)
+		}
+	}
+}
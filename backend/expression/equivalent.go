@@ -0,0 +1,76 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+const (
+	// samplePoints is how many random points two formulas are compared at
+	samplePoints = 20
+	// equivalentTolerance is the relative difference allowed at each point
+	equivalentTolerance = 1e-9
+)
+
+// ErrUnknownSymbol is returned when a submitted formula uses a symbol the
+// reference formula does not
+var ErrUnknownSymbol = errors.New("unknown symbol")
+
+// Equivalent checks whether submitted and reference are the same formula by
+// evaluating both at random points. Every symbol of reference is sampled as a
+// variable, so the h of "sqrt(2*g*h)" is a height and not Planck's constant,
+// except the built-in constants listed in constants: with g listed the formula
+// accepts "sqrt(19.6133*h)". Other symbols of submitted must be constants.
+func Equivalent(submitted, reference Node, constants []string, seed uint64) (bool, error) {
+	var free []string
+	isFree := map[string]bool{}
+	for _, name := range Variables(reference) {
+		if slices.Contains(constants, name) && IsConstant(name) {
+			continue
+		}
+		free = append(free, name)
+		isFree[name] = true
+	}
+	for _, name := range Variables(submitted) {
+		if !isFree[name] && !IsConstant(name) {
+			return false, fmt.Errorf("%w %s", ErrUnknownSymbol, name)
+		}
+	}
+
+	rng := rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15))
+	compared := 0
+	// domain errors such as sqrt of a negative are skipped, so allow extra tries
+	for try := 0; try < samplePoints*5 && compared < samplePoints; try++ {
+		env := Env{}
+		for _, name := range free {
+			// positive values keep sqrt and log in their domain most of the time
+			env[name] = 0.5 + 2.5*rng.Float64()
+		}
+
+		want, refErr := reference.Eval(env)
+		got, subErr := submitted.Eval(env)
+		if refErr != nil && subErr != nil {
+			continue
+		}
+		if refErr != nil || subErr != nil {
+			return false, nil
+		}
+		if !closeEnough(got, want) {
+			return false, nil
+		}
+		compared++
+	}
+	if compared == 0 {
+		return false, errors.New("reference formula has no valid sample point")
+	}
+	return true, nil
+}
+
+func closeEnough(got, want float64) bool {
+	diff := math.Abs(got - want)
+	scale := math.Max(math.Abs(got), math.Abs(want))
+	return diff <= equivalentTolerance*scale || diff < 1e-300
+}
@@ -0,0 +1,66 @@
+package expression
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEquivalent(t *testing.T) {
+	g := []string{"g"}
+	tests := []struct {
+		name      string
+		submitted string
+		reference string
+		constants []string
+		want      bool
+		wantErr   error
+	}{
+		{"same", "sqrt(2*g*h)", "sqrt(2*g*h)", nil, true, nil},
+		{"reordered", "sqrt(h*g*2)", "sqrt(2*g*h)", g, true, nil},
+		{"rewritten", "sqrt(2*g)*sqrt(h)", "sqrt(2*g*h)", g, true, nil},
+		{"constant written out", "sqrt(19.6133*h)", "sqrt(2*g*h)", g, true, nil},
+		{"unlisted constant is a variable", "sqrt(19.6133*h)", "sqrt(2*g*h)", nil, false, nil},
+		{"constant rounded", "sqrt(19.6*h)", "sqrt(2*g*h)", g, false, nil},
+		{"height named like planck's constant", "sqrt(2*g*h)+h", "sqrt(2*g*h)", g, false, nil},
+		{"only built-in constants are kept", "x", "x", []string{"x"}, true, nil},
+		{"constant only", "2*pi", "6.283185307179586", nil, true, nil},
+		{"identity", "sin(x)^2 + cos(x)^2", "x/x", nil, true, nil},
+		{"within tolerance", "x*(1+1e-12)", "x", nil, true, nil},
+		{"outside tolerance", "x*(1+1e-6)", "x", nil, false, nil},
+		{"different", "x^2", "x^3", nil, false, nil},
+		{"unknown symbol", "x + z", "x", nil, false, ErrUnknownSymbol},
+		{"constant in submission", "x + 0*c", "x", nil, true, nil},
+		{"zero at some points", "(x-1)/(x-1)*x", "x", nil, true, nil},
+		{"undefined only in submission", "x/(x-x)", "x", nil, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			submitted, err := Parse(tt.submitted)
+			if err != nil {
+				t.Fatalf("Parse(%q) = %v", tt.submitted, err)
+			}
+			reference, err := Parse(tt.reference)
+			if err != nil {
+				t.Fatalf("Parse(%q) = %v", tt.reference, err)
+			}
+			got, err := Equivalent(submitted, reference, tt.constants, 42)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Equivalent(%q, %q) error = %v, want %v", tt.submitted, tt.reference, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Equivalent(%q, %q) = %t, want %t", tt.submitted, tt.reference, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEquivalentWithoutSamplePoint(t *testing.T) {
+	reference, err := Parse("1/(x-x)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := Equivalent(reference, reference, nil, 42)
+	if ok || err == nil {
+		t.Errorf("Equivalent of a formula undefined everywhere = %t, %v, want an error", ok, err)
+	}
+}
@@ -0,0 +1,147 @@
+package expression
+
+import (
+	"fmt"
+	"math"
+)
+
+type function struct {
+	arity int
+	fn    func(args []float64) float64
+}
+
+// functions are the only calls an expression may make, log is the natural logarithm
+var functions = map[string]function{
+	"sqrt":  {1, func(a []float64) float64 { return math.Sqrt(a[0]) }},
+	"cbrt":  {1, func(a []float64) float64 { return math.Cbrt(a[0]) }},
+	"abs":   {1, func(a []float64) float64 { return math.Abs(a[0]) }},
+	"exp":   {1, func(a []float64) float64 { return math.Exp(a[0]) }},
+	"ln":    {1, func(a []float64) float64 { return math.Log(a[0]) }},
+	"log":   {1, func(a []float64) float64 { return math.Log(a[0]) }},
+	"log10": {1, func(a []float64) float64 { return math.Log10(a[0]) }},
+	"sin":   {1, func(a []float64) float64 { return math.Sin(a[0]) }},
+	"cos":   {1, func(a []float64) float64 { return math.Cos(a[0]) }},
+	"tan":   {1, func(a []float64) float64 { return math.Tan(a[0]) }},
+	"asin":  {1, func(a []float64) float64 { return math.Asin(a[0]) }},
+	"acos":  {1, func(a []float64) float64 { return math.Acos(a[0]) }},
+	"atan":  {1, func(a []float64) float64 { return math.Atan(a[0]) }},
+	"sinh":  {1, func(a []float64) float64 { return math.Sinh(a[0]) }},
+	"cosh":  {1, func(a []float64) float64 { return math.Cosh(a[0]) }},
+	"tanh":  {1, func(a []float64) float64 { return math.Tanh(a[0]) }},
+	"atan2": {2, func(a []float64) float64 { return math.Atan2(a[0], a[1]) }},
+	"hypot": {2, func(a []float64) float64 { return math.Hypot(a[0], a[1]) }},
+	"pow":   {2, func(a []float64) float64 { return math.Pow(a[0], a[1]) }},
+	"min":   {2, func(a []float64) float64 { return math.Min(a[0], a[1]) }},
+	"max":   {2, func(a []float64) float64 { return math.Max(a[0], a[1]) }},
+}
+
+// constants are in SI units, a variable of the same name in Env takes precedence
+var constants = map[string]float64{
+	"pi":       math.Pi,
+	"e":        math.E,
+	"g":        9.80665,
+	"c":        299792458,
+	"h":        6.62607015e-34,
+	"hbar":     1.054571817e-34,
+	"G":        6.67430e-11,
+	"k_B":      1.380649e-23,
+	"N_A":      6.02214076e23,
+	"R":        8.314462618,
+	"q_e":      1.602176634e-19,
+	"m_e":      9.1093837015e-31,
+	"m_p":      1.67262192369e-27,
+	"epsilon0": 8.8541878128e-12,
+	"mu0":      1.25663706212e-6,
+	"sigma":    5.670374419e-8,
+}
+
+// IsConstant reports whether name is a built-in constant
+func IsConstant(name string) bool {
+	_, ok := constants[name]
+	return ok
+}
+
+func (n Number) Eval(env Env) (float64, error) {
+	return n.Value, nil
+}
+
+func (v Variable) Eval(env Env) (float64, error) {
+	if value, ok := env[v.Name]; ok {
+		return value, nil
+	}
+	if value, ok := constants[v.Name]; ok {
+		return value, nil
+	}
+	return 0, fmt.Errorf("undefined variable %q", v.Name)
+}
+
+func (u Unary) Eval(env Env) (float64, error) {
+	x, err := u.X.Eval(env)
+	if err != nil {
+		return 0, err
+	}
+	return -x, nil
+}
+
+func (b Binary) Eval(env Env) (float64, error) {
+	left, err := b.Left.Eval(env)
+	if err != nil {
+		return 0, err
+	}
+	right, err := b.Right.Eval(env)
+	if err != nil {
+		return 0, err
+	}
+
+	var result float64
+	switch b.Op {
+	case "+":
+		result = left + right
+	case "-":
+		result = left - right
+	case "*":
+		result = left * right
+	case "/":
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero in %s", b)
+		}
+		result = left / right
+	case "^":
+		result = math.Pow(left, right)
+	default:
+		return 0, fmt.Errorf("unknown operator %q", b.Op)
+	}
+	return checkFinite(result, b)
+}
+
+func (c Call) Eval(env Env) (float64, error) {
+	fn, ok := functions[c.Func]
+	if !ok {
+		return 0, fmt.Errorf("unknown function %q", c.Func)
+	}
+	args := make([]float64, len(c.Args))
+	for i, arg := range c.Args {
+		value, err := arg.Eval(env)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = value
+	}
+	return checkFinite(fn.fn(args), c)
+}
+
+func checkFinite(value float64, node Node) (float64, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("%s is not a finite number", node)
+	}
+	return value, nil
+}
+
+// Evaluate parses and evaluates src in one step
+func Evaluate(src string, env Env) (float64, error) {
+	node, err := Parse(src)
+	if err != nil {
+		return 0, err
+	}
+	return node.Eval(env)
+}
@@ -0,0 +1,74 @@
+package expression
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	env := Env{"x": 2, "y": 3, "g": 10}
+	tests := []struct {
+		src  string
+		want float64
+	}{
+		{"1 + 2*3", 7},
+		{"(1 + 2)*3", 9},
+		{"2^3^2", 512},
+		{"-2^2", -4},
+		{"2x y", 12},
+		{"2(x+1)", 6},
+		{"1.5e3", 1500},
+		{"x/y*y", 2},
+		{"sqrt(2*g*x)", math.Sqrt(40)},
+		{"hypot(3, 4)", 5},
+		{"pi", math.Pi},
+		{"c", 299792458},
+		{"g", 10},
+	}
+	for _, tt := range tests {
+		got, err := Evaluate(tt.src, env)
+		if err != nil {
+			t.Errorf("Evaluate(%q) = %v", tt.src, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-12*math.Max(1, math.Abs(tt.want)) {
+			t.Errorf("Evaluate(%q) = %g, want %g", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"1 +",
+		"(1",
+		"1)",
+		"x / 0",
+		"sqrt(-1)",
+		"log(0)",
+		"unknown(1)",
+		"sqrt(1, 2)",
+		"z",
+		"10^400",
+		strings.Repeat("(", maxDepth+1) + "1" + strings.Repeat(")", maxDepth+1),
+		strings.Repeat("1+", maxLength),
+	}
+	for _, src := range tests {
+		if got, err := Evaluate(src, Env{"x": 1}); err == nil {
+			t.Errorf("Evaluate(%.20q) = %g, want an error", src, got)
+		}
+	}
+}
+
+func TestVariables(t *testing.T) {
+	node, err := Parse("sqrt(2*g*y) + y/x - pi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"g", "pi", "x", "y"}
+	if got := Variables(node); !slices.Equal(got, want) {
+		t.Errorf("Variables = %v, want %v", got, want)
+	}
+}
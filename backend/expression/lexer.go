@@ -0,0 +1,89 @@
+package expression
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenIdent
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+	tokenComma
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	number float64
+	pos    int
+}
+
+// lex splits src into tokens, it accepts numbers like 2, 0.5 and 6.02e23,
+// identifiers, the operators + - * / ^, parentheses and commas
+func lex(src string) ([]token, error) {
+	runes := []rune(src)
+	var tokens []token
+	pos := 0
+	for pos < len(runes) {
+		r := runes[pos]
+		switch {
+		case unicode.IsSpace(r):
+			pos++
+		case unicode.IsDigit(r) || r == '.':
+			start := pos
+			for pos < len(runes) && (unicode.IsDigit(runes[pos]) || runes[pos] == '.') {
+				pos++
+			}
+			if pos < len(runes) && (runes[pos] == 'e' || runes[pos] == 'E') {
+				next := pos + 1
+				if next < len(runes) && (runes[next] == '+' || runes[next] == '-') {
+					next++
+				}
+				if next < len(runes) && unicode.IsDigit(runes[next]) {
+					pos = next
+					for pos < len(runes) && unicode.IsDigit(runes[pos]) {
+						pos++
+					}
+				}
+			}
+			text := string(runes[start:pos])
+			number, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", text, start)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: text, number: number, pos: start})
+		case unicode.IsLetter(r) || r == '_':
+			start := pos
+			for pos < len(runes) && (unicode.IsLetter(runes[pos]) || unicode.IsDigit(runes[pos]) || runes[pos] == '_') {
+				pos++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[start:pos]), pos: start})
+		case r == '*' && pos+1 < len(runes) && runes[pos+1] == '*':
+			tokens = append(tokens, token{kind: tokenOperator, text: "^", pos: pos})
+			pos += 2
+		case r == '+' || r == '-' || r == '*' || r == '/' || r == '^':
+			tokens = append(tokens, token{kind: tokenOperator, text: string(r), pos: pos})
+			pos++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLeftParen, text: "(", pos: pos})
+			pos++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRightParen, text: ")", pos: pos})
+			pos++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: pos})
+			pos++
+		default:
+			return nil, fmt.Errorf("unexpected %q at position %d", string(r), pos)
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: pos})
+	return tokens, nil
+}
@@ -0,0 +1,230 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// maxLength and maxDepth bound the work done on untrusted input
+	maxLength = 1000
+	maxDepth  = 100
+)
+
+// Parse turns src into an expression tree, following the usual precedence:
+// ^ binds tighter than unary minus, which binds tighter than * and /, then + and -.
+// Juxtaposition such as "2g h" or "2(x+1)" is multiplication.
+func Parse(src string) (Node, error) {
+	if len(src) > maxLength {
+		return nil, fmt.Errorf("expression longer than %d characters", maxLength)
+	}
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, fmt.Errorf("lexing expression: %w", err)
+	}
+	p := parser{tokens: tokens}
+	node, err := p.parseSum()
+	if err != nil {
+		return nil, fmt.Errorf("parsing expression: %w", err)
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, fmt.Errorf("parsing expression: unexpected %q at position %d", p.peek().text, p.peek().pos)
+	}
+	return node, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isOperator(ops ...string) bool {
+	t := p.peek()
+	if t.kind != tokenOperator {
+		return false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+// startsOperand reports whether the next token begins an implicitly multiplied operand
+func (p *parser) startsOperand() bool {
+	switch p.peek().kind {
+	case tokenNumber, tokenIdent, tokenLeftParen:
+		return true
+	}
+	return false
+}
+
+func (p *parser) enter() error {
+	p.depth++
+	if p.depth > maxDepth {
+		return errors.New("expression nested too deeply")
+	}
+	return nil
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
+
+func (p *parser) parseSum() (Node, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("+", "-") {
+		op := p.next().text
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = Binary{Op: op, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseProduct() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("*", "/") || p.startsOperand() {
+		op := "*"
+		if !p.startsOperand() {
+			op = p.next().text
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = Binary{Op: op, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if p.isOperator("+", "-") {
+		err := p.enter()
+		if err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		op := p.next().text
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if op == "+" {
+			return x, nil
+		}
+		return Unary{Op: op, X: x}, nil
+	}
+	return p.parsePower()
+}
+
+// parsePower is right associative, so 2^3^2 is 2^(3^2)
+func (p *parser) parsePower() (Node, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOperator("^") {
+		return base, nil
+	}
+	p.next()
+	err = p.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	exponent, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return Binary{Op: "^", Left: base, Right: exponent}, nil
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		return Number{Value: t.number}, nil
+	case tokenIdent:
+		// a variable followed by "(" is implicit multiplication, not a call
+		if _, ok := functions[t.text]; !ok || p.peek().kind != tokenLeftParen {
+			return Variable{Name: t.text}, nil
+		}
+		p.next()
+		return p.parseCall(t)
+	case tokenLeftParen:
+		err := p.enter()
+		if err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		inner, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokenRightParen {
+			return nil, fmt.Errorf("missing closing parenthesis for position %d", t.pos)
+		}
+		return inner, nil
+	case tokenEOF:
+		return nil, errors.New("unexpected end of expression")
+	default:
+		return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+	}
+}
+
+func (p *parser) parseCall(name token) (Node, error) {
+	err := p.enter()
+	if err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	call := Call{Func: name.text}
+	if p.peek().kind == tokenRightParen {
+		p.next()
+	} else {
+		for {
+			arg, err := p.parseSum()
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, arg)
+			t := p.next()
+			if t.kind == tokenRightParen {
+				break
+			}
+			if t.kind != tokenComma {
+				return nil, fmt.Errorf("expected , or ) at position %d", t.pos)
+			}
+		}
+	}
+
+	fn := functions[call.Func]
+	if len(call.Args) != fn.arity {
+		return nil, fmt.Errorf("function %s takes %d arguments, got %d", call.Func, fn.arity, len(call.Args))
+	}
+	return call, nil
+}
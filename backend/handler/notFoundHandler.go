@@ -2,8 +2,11 @@ package handler
 
 import (
 	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/problem"
 )
 
 type NotFoundHandler struct{}
@@ -13,13 +16,7 @@ func NewNotFoundHandler() *NotFoundHandler {
 }
 
 func (nfh NotFoundHandler) PageNotFound(w http.ResponseWriter, r *http.Request) {
-	err := json.NewEncoder(w).Encode(map[string]string{"message": "page not found"})
-	if err != nil {
-		log.Printf("encoding message: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
-		return
-	}
-	w.WriteHeader(http.StatusNotFound)
+	problem.Write(w, r, apperr.NotFound("page not found"))
 }
 
 func (nfh NotFoundHandler) Home(w http.ResponseWriter, r *http.Request) {
@@ -32,8 +29,7 @@ func (nfh NotFoundHandler) Home(w http.ResponseWriter, r *http.Request) {
 	}
 	err := json.NewEncoder(w).Encode(home)
 	if err != nil {
-		log.Printf("encoding message: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		problem.Write(w, r, fmt.Errorf("encoding message: %w", err))
 		return
 	}
 }
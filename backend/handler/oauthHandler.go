@@ -0,0 +1,289 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/oidc"
+	"github.com/suryasaputra2016/course/backend/problem"
+	"github.com/suryasaputra2016/course/backend/repo"
+	"github.com/suryasaputra2016/course/backend/utils"
+)
+
+const (
+	// oauthStateLifetime is how long a login can stay at the provider
+	oauthStateLifetime = 10 * time.Minute
+	// oauthBindingCookie ties a login to the browser that started it, so a
+	// callback URL passed to someone else doesn't log them in
+	oauthBindingCookie = "oauth_binding"
+)
+
+var (
+	errOAuthLogin       = apperr.Unauthorized("login with the provider failed, try again")
+	errOAuthEmail       = apperr.Forbidden("the provider has not verified your email address")
+	errProviderNotFound = apperr.NotFound("login provider not found")
+)
+
+// OAuthHandler logs users in with OpenID Connect providers. A provider
+// account is linked to the user with its verified email, or to a new user.
+type OAuthHandler struct {
+	providers    map[string]*oidc.Provider
+	osr          repo.OAuthStateStore
+	sr           repo.SessionStore
+	tfr          repo.TwoFactorStore
+	lcr          repo.LoginChallengeStore
+	uow          repo.Transactor
+	secureCookie bool
+}
+
+func NewOAuthHandler(
+	providers map[string]*oidc.Provider,
+	osr repo.OAuthStateStore,
+	sr repo.SessionStore,
+	tfr repo.TwoFactorStore,
+	lcr repo.LoginChallengeStore,
+	uow repo.Transactor,
+	secureCookie bool,
+) *OAuthHandler {
+	return &OAuthHandler{
+		providers:    providers,
+		osr:          osr,
+		sr:           sr,
+		tfr:          tfr,
+		lcr:          lcr,
+		uow:          uow,
+		secureCookie: secureCookie,
+	}
+}
+
+// StartLogin answers the provider URL the browser goes to and sets the
+// cookie the callback is checked against
+func (oh OAuthHandler) StartLogin(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	name := r.PathValue("provider")
+	provider, ok := oh.providers[name]
+	if !ok {
+		problem.Write(w, r, errProviderNotFound)
+		return
+	}
+
+	var state, nonce, verifier, binding string
+	for _, value := range []*string{&state, &nonce, &verifier, &binding} {
+		var err error
+		*value, err = oidc.Random()
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("building authorization url of %s: %w", name, err))
+		return
+	}
+
+	expiresAt := time.Now().Add(oauthStateLifetime)
+	err = oh.osr.Create(ctx, &model.OAuthState{
+		StateHash:    utils.HashToken(state),
+		BindingHash:  utils.HashToken(binding),
+		Provider:     name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    expiresAt,
+	})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("creating oauth state in handler: %w", err))
+		return
+	}
+
+	oh.setBindingCookie(w, binding, expiresAt)
+	err = json.NewEncoder(w).Encode(map[string]string{"authorization_url": authURL})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding authorization url: %w", err))
+		return
+	}
+}
+
+// FinishLogin redeems the code the provider sent back and logs in the user of
+// the provider account, like LoginUser it may only earn a login challenge
+func (oh OAuthHandler) FinishLogin(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	var callback model.OAuthCallback
+	err := decodeJSON(w, r, &callback)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	name := r.PathValue("provider")
+	provider, ok := oh.providers[name]
+	if !ok {
+		problem.Write(w, r, errProviderNotFound)
+		return
+	}
+
+	binding, err := r.Cookie(oauthBindingCookie)
+	if err != nil {
+		problem.Write(w, r, errOAuthLogin.Wrap(err))
+		return
+	}
+	state, err := oh.osr.Consume(ctx, utils.HashToken(callback.State))
+	if err == nil && (state.Provider != name || state.BindingHash != utils.HashToken(binding.Value)) {
+		err = fmt.Errorf("oauth state of another login: %w", apperr.ErrNotFound)
+	}
+	if err == nil && time.Now().After(state.ExpiresAt) {
+		err = fmt.Errorf("oauth state expired: %w", apperr.ErrNotFound)
+	}
+	if errors.Is(err, apperr.ErrNotFound) {
+		problem.Write(w, r, errOAuthLogin.Wrap(err))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("consuming oauth state: %w", err))
+		return
+	}
+	oh.setBindingCookie(w, "", time.Time{})
+
+	claims, err := provider.Login(r.Context(), callback.Code, state.CodeVerifier, state.Nonce)
+	if errors.Is(err, oidc.ErrVerification) {
+		problem.Write(w, r, errOAuthLogin.Wrap(err))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("logging in with %s: %w", name, err))
+		return
+	}
+
+	userID, err := oh.linkUser(ctx, name, claims)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	// the provider stands in for the password, a second factor is still asked
+	enrolment, err := oh.tfr.GetTOTP(ctx, userID)
+	if err != nil && !errors.Is(err, apperr.ErrNotFound) {
+		problem.Write(w, r, fmt.Errorf("getting totp in handler: %w", err))
+		return
+	}
+	if err == nil && enrolment.IsConfirmed() {
+		challengeToken, err := startChallenge(ctx, oh.lcr, userID)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+		err = json.NewEncoder(w).Encode(map[string]any{
+			"two_factor_required": true,
+			"challenge_token":     challengeToken,
+		})
+		if err != nil {
+			problem.Write(w, r, fmt.Errorf("encoding challenge: %w", err))
+			return
+		}
+		return
+	}
+
+	token, err := startSession(ctx, oh.sr, r, userID)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(map[string]string{"token": token})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding token: %w", err))
+		return
+	}
+}
+
+// linkUser returns the user a provider account logs in as. An account seen
+// before keeps its user even when its email changed, a new one is linked by
+// email only when the provider verified it.
+func (oh OAuthHandler) linkUser(ctx context.Context, provider string, claims *oidc.Claims) (int, error) {
+	var userID int
+	err := oh.uow.Do(ctx, func(tx repo.Repos) error {
+		identity, err := tx.OAuthIdentities.GetBySubject(ctx, provider, claims.Subject)
+		if err == nil {
+			userID = identity.UserID
+			return nil
+		}
+		if !errors.Is(err, apperr.ErrNotFound) {
+			return err
+		}
+		if claims.Email == "" || !claims.EmailVerified {
+			return errOAuthEmail
+		}
+
+		email := utils.NormalizeEmail(claims.Email)
+		user, err := tx.Users.GetByEmail(ctx, email)
+		switch {
+		case err == nil && !user.IsVerified:
+			err = claimUnverified(ctx, tx, user.ID)
+		case errors.Is(err, apperr.ErrNotFound):
+			user = &model.User{Email: email, Roles: []string{model.RoleStudent}}
+			err = tx.Users.Create(ctx, user)
+			if err == nil {
+				err = tx.Users.UpdateEmailVerification(ctx, user.ID)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		userID = user.ID
+		return tx.OAuthIdentities.Create(ctx, &model.OAuthIdentity{
+			UserID:   user.ID,
+			Provider: provider,
+			Subject:  claims.Subject,
+			Email:    email,
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("linking %s account: %w", provider, err)
+	}
+	return userID, nil
+}
+
+// claimUnverified hands an account whose email was never verified to the
+// owner of the email. Whoever registered it may not own the address and may
+// be waiting for the owner to link it, so its password and sessions go.
+func claimUnverified(ctx context.Context, tx repo.Repos, userID int) error {
+	err := tx.Users.UpdateEmailVerification(ctx, userID)
+	if err != nil {
+		return err
+	}
+	err = tx.Users.UpdatePassword(ctx, userID, "")
+	if err != nil {
+		return err
+	}
+	return tx.Sessions.DeleteByUserID(ctx, userID)
+}
+
+// setBindingCookie sets the binding cookie until expiresAt, or deletes it
+// when value is empty
+func (oh OAuthHandler) setBindingCookie(w http.ResponseWriter, value string, expiresAt time.Time) {
+	cookie := http.Cookie{
+		Name:     oauthBindingCookie,
+		Value:    value,
+		Path:     "/oauth/",
+		Expires:  expiresAt,
+		Secure:   oh.secureCookie,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if value == "" {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, &cookie)
+}
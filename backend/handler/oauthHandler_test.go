@@ -0,0 +1,241 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/suryasaputra2016/course/backend/config"
+	"github.com/suryasaputra2016/course/backend/handler"
+	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/oidc"
+	"github.com/suryasaputra2016/course/backend/oidc/mockprovider"
+)
+
+// withOAuth adds the routes of an OAuthHandler with one provider, "school",
+// served by the returned mock
+func (app *testApp) withOAuth() *mockprovider.Provider {
+	app.t.Helper()
+	mock, err := mockprovider.New("course", "secret")
+	if err != nil {
+		app.t.Fatal(err)
+	}
+	app.t.Cleanup(mock.Close)
+	providers := map[string]*oidc.Provider{
+		"school": oidc.NewProvider(oidc.Config{
+			Issuer:       mock.Issuer(),
+			ClientID:     "course",
+			ClientSecret: "secret",
+			RedirectURL:  testBaseURL + "/oauth/school/callback",
+			Scopes:       []string{"email"},
+		}, http.DefaultClient),
+	}
+	r := app.db.Repos()
+	oah := handler.NewOAuthHandler(providers, r.OAuthStates, r.Sessions, r.TwoFactor, r.LoginChallenges, app.db, false)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth/{provider}/start", oah.StartLogin)
+	mux.HandleFunc("POST /oauth/{provider}/callback", oah.FinishLogin)
+	mux.Handle("/", app.handler)
+	app.handler = mux
+	return mock
+}
+
+// oauthStart starts a login with provider and returns the authorization URL
+// and the binding cookie
+func (app *testApp) oauthStart(provider string) (string, *http.Cookie) {
+	app.t.Helper()
+	rec := app.do("POST", "/oauth/"+provider+"/start", "", nil)
+	if rec.Code != http.StatusOK {
+		app.t.Fatalf("start status = %d, body %q", rec.Code, rec.Body)
+	}
+	var body struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "oauth_binding" {
+			return body.AuthorizationURL, cookie
+		}
+	}
+	app.t.Fatal("start set no binding cookie")
+	return "", nil
+}
+
+// oauthCallback posts what the provider sent back, with binding when it is not nil
+func (app *testApp) oauthCallback(provider string, callback model.OAuthCallback, binding *http.Cookie) *httptest.ResponseRecorder {
+	app.t.Helper()
+	encoded, _ := json.Marshal(callback)
+	req := httptest.NewRequest("POST", "/oauth/"+provider+"/callback", strings.NewReader(string(encoded)))
+	if binding != nil {
+		req.AddCookie(binding)
+	}
+	rec := httptest.NewRecorder()
+	app.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// oauthLogin logs in at mock and answers the callback response
+func (app *testApp) oauthLogin(mock *mockprovider.Provider) *httptest.ResponseRecorder {
+	app.t.Helper()
+	authURL, binding := app.oauthStart("school")
+	code, state, err := mock.Authorize(authURL)
+	if err != nil {
+		app.t.Fatalf("authorizing: %s", err)
+	}
+	return app.oauthCallback("school", model.OAuthCallback{State: state, Code: code}, binding)
+}
+
+// oauthSession logs in at mock and returns the session token
+func (app *testApp) oauthSession(mock *mockprovider.Provider) string {
+	app.t.Helper()
+	rec := app.oauthLogin(mock)
+	var body map[string]string
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusOK || body["token"] == "" {
+		app.t.Fatalf("oauth login: status %d, body %q", rec.Code, rec.Body)
+	}
+	return body["token"]
+}
+
+func TestOAuthLogin(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{RequireVerifiedEmail: true})
+	mock := app.withOAuth()
+	mock.User = mockprovider.User{Subject: "42", Email: "ada@school.test", EmailVerified: true}
+
+	session := app.oauthSession(mock)
+	rec := app.do("GET", "/dashboard/passkeys", session, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("dashboard with oauth session status = %d, body %q", rec.Code, rec.Body)
+	}
+	user, err := app.db.Repos().Users.GetByEmail(context.Background(), "ada@school.test")
+	if err != nil {
+		t.Fatalf("getting created user: %s", err)
+	}
+	if !user.IsVerified || !user.HasRole(model.RoleStudent) {
+		t.Errorf("created user = %+v, want a verified student", user)
+	}
+
+	// the provider account keeps its user when its email changes
+	mock.User.Email = "ada.lovelace@school.test"
+	app.oauthSession(mock)
+	_, err = app.db.Repos().Users.GetByEmail(context.Background(), "ada.lovelace@school.test")
+	if err == nil {
+		t.Error("changed provider email created a second user")
+	}
+
+	app.enableTOTP(user.ID)
+	rec = app.oauthLogin(mock)
+	var body struct {
+		TwoFactorRequired bool   `json:"two_factor_required"`
+		ChallengeToken    string `json:"challenge_token"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusOK || !body.TwoFactorRequired || body.ChallengeToken == "" {
+		t.Errorf("oauth login with totp: status %d, want a two-factor challenge", rec.Code)
+	}
+}
+
+func TestOAuthLinksByEmail(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+	mock := app.withOAuth()
+
+	verified := app.register("ada@example.com", "first-password")
+	rec := app.do("PUT", "/verifyemail", "", model.VerifyEmail{Token: app.lastToken("ada@example.com", "/verifyemail")})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("verify status = %d, body %q", rec.Code, rec.Body)
+	}
+	// providers keep the case the address was typed in
+	mock.User = mockprovider.User{Subject: "1", Email: "Ada@Example.com", EmailVerified: true}
+	app.oauthSession(mock)
+	identity, err := app.db.Repos().OAuthIdentities.GetBySubject(context.Background(), "school", "1")
+	if err != nil || identity.UserID != verified.ID {
+		t.Fatalf("identity = %+v, %v, want one linked to user %d", identity, err, verified.ID)
+	}
+	app.login("ada@example.com", "first-password")
+
+	// whoever registered an address they never verified loses the account to
+	// its owner, along with the password and sessions they set up
+	squatted := app.register("bob@example.com", "squatter-password")
+	squatterSession := app.login("bob@example.com", "squatter-password")
+	mock.User = mockprovider.User{Subject: "2", Email: "bob@example.com", EmailVerified: true}
+	app.oauthSession(mock)
+	user, _ := app.db.Repos().Users.GetByID(context.Background(), squatted.ID)
+	if !user.IsVerified {
+		t.Error("linked account is not verified")
+	}
+	rec = app.do("POST", "/login", "", model.LoginUser{Email: "bob@example.com", Password: "squatter-password"})
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("squatter login status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	rec = app.do("DELETE", "/dashboard/logout", squatterSession, nil)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("squatter session status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestOAuthRefusedLogins(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+	mock := app.withOAuth()
+	mock.User = mockprovider.User{Subject: "42", Email: "ada@school.test", EmailVerified: true}
+
+	t.Run("unverified email", func(t *testing.T) {
+		mock.User.EmailVerified = false
+		defer func() { mock.User.EmailVerified = true }()
+		rec := app.oauthLogin(mock)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+		}
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		rec := app.do("POST", "/oauth/elsewhere/start", "", nil)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("missing binding cookie", func(t *testing.T) {
+		authURL, _ := app.oauthStart("school")
+		code, state, _ := mock.Authorize(authURL)
+		rec := app.oauthCallback("school", model.OAuthCallback{State: state, Code: code}, nil)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("binding cookie of another login", func(t *testing.T) {
+		authURL, _ := app.oauthStart("school")
+		_, otherBinding := app.oauthStart("school")
+		code, state, _ := mock.Authorize(authURL)
+		rec := app.oauthCallback("school", model.OAuthCallback{State: state, Code: code}, otherBinding)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("replayed state", func(t *testing.T) {
+		authURL, binding := app.oauthStart("school")
+		code, state, _ := mock.Authorize(authURL)
+		rec := app.oauthCallback("school", model.OAuthCallback{State: state, Code: code}, binding)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("first callback status = %d, body %q", rec.Code, rec.Body)
+		}
+		rec = app.oauthCallback("school", model.OAuthCallback{State: state, Code: code}, binding)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("replayed status = %d, want %d", rec.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		authURL, binding := app.oauthStart("school")
+		_, state, _ := mock.Authorize(authURL)
+		rec := app.oauthCallback("school", model.OAuthCallback{State: state, Code: "guessed"}, binding)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/problem"
+	"github.com/suryasaputra2016/course/backend/repo"
+)
+
+type OutboxHandler struct {
+	obr repo.OutboxStore
+}
+
+func NewOutboxHandler(obr repo.OutboxStore) *OutboxHandler {
+	return &OutboxHandler{obr: obr}
+}
+
+func (oh OutboxHandler) ListEmails(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", model.OutboxStatusPending, model.OutboxStatusSent, model.OutboxStatusDead:
+	default:
+		problem.Write(w, r, apperr.Invalid("status", "unknown status"))
+		return
+	}
+
+	limit, offset := pagination(r, 50, 200)
+	emails, err := oh.obr.List(ctx, status, limit, offset)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("listing emails from handler: %w", err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(emails)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding emails: %w", err))
+		return
+	}
+}
+
+func (oh OutboxHandler) ResendEmail(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	emailID, err := strconv.Atoi(r.PathValue("emailid"))
+	if err != nil {
+		problem.Write(w, r, apperr.Invalid("emailid", "must be a number").Wrap(err))
+		return
+	}
+
+	err = oh.obr.Requeue(ctx, emailID)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("requeuing email from handler: %w", err))
+		return
+	}
+
+	response, err := json.Marshal(map[string]string{"message": "email queued"})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("marshaling data to json: %w", err))
+		return
+	}
+	w.Write(response)
+}
@@ -0,0 +1,395 @@
+package handler
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/config"
+	"github.com/suryasaputra2016/course/backend/middleware"
+	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/problem"
+	"github.com/suryasaputra2016/course/backend/repo"
+	"github.com/suryasaputra2016/course/backend/utils"
+	"github.com/suryasaputra2016/course/backend/webauthn"
+)
+
+// maxPasskeys caps the passkeys of one account
+const maxPasskeys = 20
+
+var (
+	errPasskeyLogin    = apperr.Unauthorized("passkey login failed, try again")
+	errPasskeyInvalid  = apperr.Invalid("credential", "passkey could not be verified, try again")
+	errPasskeyTaken    = apperr.Conflict("passkey is already registered")
+	errTooManyPasskeys = apperr.Conflict(fmt.Sprintf("an account can have at most %d passkeys", maxPasskeys))
+)
+
+// PasskeyHandler logs users in with WebAuthn credentials, as an alternative
+// to a password, and lets them manage their passkeys
+type PasskeyHandler struct {
+	pr     repo.PasskeyStore
+	pcr    repo.PasskeyChallengeStore
+	ur     repo.UserStore
+	sr     repo.SessionStore
+	rp     webauthn.RelyingParty
+	policy config.LoginPolicy
+}
+
+func NewPasskeyHandler(
+	pr repo.PasskeyStore,
+	pcr repo.PasskeyChallengeStore,
+	ur repo.UserStore,
+	sr repo.SessionStore,
+	rp webauthn.RelyingParty,
+	policy config.LoginPolicy,
+) *PasskeyHandler {
+	return &PasskeyHandler{
+		pr:     pr,
+		pcr:    pcr,
+		ur:     ur,
+		sr:     sr,
+		rp:     rp,
+		policy: policy,
+	}
+}
+
+// BeginRegistration answers the options for navigator.credentials.create
+func (ph PasskeyHandler) BeginRegistration(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	passkeys, err := ph.pr.ListByUser(ctx, user.ID)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("listing passkeys in handler: %w", err))
+		return
+	}
+	if len(passkeys) >= maxPasskeys {
+		problem.Write(w, r, errTooManyPasskeys)
+		return
+	}
+	exclude := [][]byte{}
+	for _, p := range passkeys {
+		exclude = append(exclude, p.CredentialID)
+	}
+
+	challenge, err := ph.startCeremony(ctx, user.ID, model.PasskeyCeremonyRegister)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	options := ph.rp.CreationOptions(challenge, webauthn.User{
+		ID:          userHandle(user.ID),
+		Name:        user.Email,
+		DisplayName: user.Email,
+	}, exclude)
+
+	err = json.NewEncoder(w).Encode(options)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding creation options: %w", err))
+		return
+	}
+}
+
+// FinishRegistration stores the passkey the browser created
+func (ph PasskeyHandler) FinishRegistration(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	var registration model.PasskeyRegistration
+	err := decodeJSON(w, r, &registration)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	challenge, err := registration.Credential.Challenge()
+	if err != nil {
+		problem.Write(w, r, errPasskeyInvalid.Wrap(err))
+		return
+	}
+	ceremony, err := ph.pcr.Consume(ctx, utils.HashToken(challenge), model.PasskeyCeremonyRegister)
+	if err == nil && (ceremony.UserID != user.ID || time.Now().After(ceremony.ExpiresAt)) {
+		err = fmt.Errorf("passkey challenge expired or of another user: %w", apperr.ErrNotFound)
+	}
+	if err != nil {
+		problem.Write(w, r, invalidCeremony(err, errPasskeyInvalid))
+		return
+	}
+
+	credential, err := ph.rp.VerifyRegistration(registration.Credential, challenge)
+	if err != nil {
+		problem.Write(w, r, invalidCeremony(err, errPasskeyInvalid))
+		return
+	}
+
+	passkey := model.Passkey{
+		UserID:         user.ID,
+		CredentialID:   credential.ID,
+		PublicKey:      credential.PublicKey,
+		SignCount:      credential.SignCount,
+		Transports:     credential.Transports,
+		Name:           registration.Name,
+		BackupEligible: credential.BackupEligible,
+		BackedUp:       credential.BackedUp,
+	}
+	err = ph.pr.Create(ctx, &passkey)
+	if errors.Is(err, apperr.ErrConflict) {
+		err = errPasskeyTaken.Wrap(err)
+	}
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("creating passkey in handler: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(passkey)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding passkey: %w", err))
+		return
+	}
+}
+
+// BeginLogin answers the options for navigator.credentials.get. Any passkey
+// of the site is allowed, so the email is not needed and not revealed.
+func (ph PasskeyHandler) BeginLogin(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	challenge, err := ph.startCeremony(ctx, 0, model.PasskeyCeremonyLogin)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(ph.rp.RequestOptions(challenge))
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding request options: %w", err))
+		return
+	}
+}
+
+// FinishLogin checks the assertion of a passkey and starts a session for its
+// user. The passkey verified the user, so no password or second factor is
+// asked, and an account locked for wrong passwords can still log in this way.
+func (ph PasskeyHandler) FinishLogin(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	var assertion webauthn.AssertionResponse
+	err := decodeJSON(w, r, &assertion)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	challenge, err := assertion.Challenge()
+	if err != nil {
+		problem.Write(w, r, errPasskeyLogin.Wrap(err))
+		return
+	}
+	ceremony, err := ph.pcr.Consume(ctx, utils.HashToken(challenge), model.PasskeyCeremonyLogin)
+	if err == nil && time.Now().After(ceremony.ExpiresAt) {
+		err = fmt.Errorf("passkey challenge expired: %w", apperr.ErrNotFound)
+	}
+	if err != nil {
+		problem.Write(w, r, invalidCeremony(err, errPasskeyLogin))
+		return
+	}
+
+	credentialID, err := assertion.CredentialID()
+	if err != nil {
+		problem.Write(w, r, errPasskeyLogin.Wrap(err))
+		return
+	}
+	passkey, err := ph.pr.GetByCredentialID(ctx, credentialID)
+	if err != nil {
+		problem.Write(w, r, invalidCeremony(err, errPasskeyLogin))
+		return
+	}
+	handle, err := assertion.UserHandle()
+	if err == nil && len(handle) != 0 && string(handle) != string(userHandle(passkey.UserID)) {
+		err = fmt.Errorf("%w: user handle doesn't match the passkey", webauthn.ErrVerification)
+	}
+	if err != nil {
+		problem.Write(w, r, errPasskeyLogin.Wrap(err))
+		return
+	}
+
+	verified, err := ph.rp.VerifyAssertion(assertion, challenge, passkey.PublicKey, passkey.SignCount)
+	if err != nil {
+		problem.Write(w, r, invalidCeremony(err, errPasskeyLogin))
+		return
+	}
+
+	user, err := ph.ur.GetByID(ctx, passkey.UserID)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("getting user in handler: %w", err))
+		return
+	}
+	if ph.policy.RequireVerifiedEmail && !user.IsVerified {
+		problem.Write(w, r, apperr.Forbidden("email is not verified"))
+		return
+	}
+
+	// the sign count was checked against a read that a concurrent login with
+	// the same count may have overtaken, the store only takes a count that
+	// still grows and anything else is treated as a cloned authenticator
+	err = ph.pr.RecordUse(ctx, passkey.ID, verified.SignCount, verified.BackedUp)
+	if err != nil {
+		problem.Write(w, r, invalidCeremony(fmt.Errorf("recording passkey use: %w", err), errPasskeyLogin))
+		return
+	}
+
+	token, err := startSession(ctx, ph.sr, r, user.ID)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(map[string]string{"token": token})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding user: %w", err))
+		return
+	}
+}
+
+func (ph PasskeyHandler) ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	passkeys, err := ph.pr.ListByUser(ctx, user.ID)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("listing passkeys in handler: %w", err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(passkeys)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding passkeys: %w", err))
+		return
+	}
+}
+
+func (ph PasskeyHandler) RenamePasskey(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	passkeyID, err := strconv.Atoi(r.PathValue("passkeyid"))
+	if err != nil {
+		problem.Write(w, r, apperr.Invalid("passkeyid", "must be a number").Wrap(err))
+		return
+	}
+
+	var rename model.PasskeyName
+	err = decodeJSON(w, r, &rename)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	err = ph.pr.Rename(ctx, user.ID, passkeyID, rename.Name)
+	if err != nil {
+		problem.Write(w, r, notFoundAs(err, "passkey not found"))
+		return
+	}
+
+	response, err := json.Marshal(map[string]string{"message": "passkey renamed"})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("marshaling data to json: %w", err))
+		return
+	}
+	w.Write(response)
+}
+
+func (ph PasskeyHandler) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	passkeyID, err := strconv.Atoi(r.PathValue("passkeyid"))
+	if err != nil {
+		problem.Write(w, r, apperr.Invalid("passkeyid", "must be a number").Wrap(err))
+		return
+	}
+
+	err = ph.pr.Delete(ctx, user.ID, passkeyID)
+	if err != nil {
+		problem.Write(w, r, notFoundAs(err, "passkey not found"))
+		return
+	}
+
+	response, err := json.Marshal(map[string]string{"message": "passkey deleted"})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("marshaling data to json: %w", err))
+		return
+	}
+	w.Write(response)
+}
+
+// startCeremony stores a fresh challenge for ceremony and returns it
+func (ph PasskeyHandler) startCeremony(ctx context.Context, userID int, ceremony string) (string, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", err
+	}
+	stored := model.PasskeyChallenge{
+		UserID:        userID,
+		ChallengeHash: utils.HashToken(challenge),
+		Ceremony:      ceremony,
+		ExpiresAt:     time.Now().Add(webauthn.Timeout),
+	}
+	err = ph.pcr.Create(ctx, &stored)
+	if err != nil {
+		return "", fmt.Errorf("creating passkey challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+// invalidCeremony answers with as for a response that didn't verify or a
+// challenge or passkey that doesn't exist, and passes other errors on
+func invalidCeremony(err error, as *apperr.Error) error {
+	if errors.Is(err, webauthn.ErrVerification) || errors.Is(err, apperr.ErrNotFound) {
+		return as.Wrap(err)
+	}
+	return err
+}
+
+// userHandle is the WebAuthn user handle of a user, its id as 8 bytes
+func userHandle(userID int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(userID))
+}
@@ -0,0 +1,126 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/suryasaputra2016/course/backend/config"
+	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/webauthn"
+	"github.com/suryasaputra2016/course/backend/webauthn/softauthn"
+)
+
+// addPasskey registers a passkey of authenticator for the user of session
+func (app *testApp) addPasskey(session string, authenticator *softauthn.Authenticator, name string) model.Passkey {
+	app.t.Helper()
+	rec := app.do("POST", "/dashboard/passkeys/register/begin", session, nil)
+	if rec.Code != http.StatusOK {
+		app.t.Fatalf("begin registration: status %d, body %q", rec.Code, rec.Body)
+	}
+	var options webauthn.CreationOptions
+	json.NewDecoder(rec.Body).Decode(&options)
+	credential, err := authenticator.Create(options)
+	if err != nil {
+		app.t.Fatalf("creating credential: %s", err)
+	}
+
+	rec = app.do("POST", "/dashboard/passkeys/register/finish", session, model.PasskeyRegistration{Name: name, Credential: credential})
+	if rec.Code != http.StatusCreated {
+		app.t.Fatalf("finish registration: status %d, body %q", rec.Code, rec.Body)
+	}
+	var passkey model.Passkey
+	json.NewDecoder(rec.Body).Decode(&passkey)
+	return passkey
+}
+
+// passkeyLogin runs a login ceremony with authenticator and returns the response
+func (app *testApp) passkeyLogin(authenticator *softauthn.Authenticator) (*webauthn.AssertionResponse, int, string) {
+	app.t.Helper()
+	rec := app.do("POST", "/login/passkey/begin", "", nil)
+	if rec.Code != http.StatusOK {
+		app.t.Fatalf("begin login: status %d, body %q", rec.Code, rec.Body)
+	}
+	var options webauthn.RequestOptions
+	json.NewDecoder(rec.Body).Decode(&options)
+	assertion, err := authenticator.Get(options)
+	if err != nil {
+		app.t.Fatalf("getting assertion: %s", err)
+	}
+
+	rec = app.do("POST", "/login/passkey/finish", "", assertion)
+	var body map[string]string
+	json.NewDecoder(rec.Body).Decode(&body)
+	return &assertion, rec.Code, body["token"]
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+	app.register("ada@example.com", "first-password")
+	session := app.login("ada@example.com", "first-password")
+
+	authenticator := softauthn.New(testBaseURL)
+	passkey := app.addPasskey(session, authenticator, "laptop")
+
+	assertion, status, token := app.passkeyLogin(authenticator)
+	if status != http.StatusOK || token == "" {
+		t.Fatalf("passkey login status = %d, token %q", status, token)
+	}
+	rec := app.do("GET", "/dashboard/passkeys", token, nil)
+	var passkeys []model.Passkey
+	json.NewDecoder(rec.Body).Decode(&passkeys)
+	if len(passkeys) != 1 || passkeys[0].Name != "laptop" || passkeys[0].LastUsedAt == nil {
+		t.Fatalf("passkeys after login = %+v, want laptop, used", passkeys)
+	}
+
+	// the challenge of a finished login can't be used again
+	rec = app.do("POST", "/login/passkey/finish", "", assertion)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("replayed assertion status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	// a clone of the authenticator lags behind the sign count
+	authenticator.SetSignCount(0)
+	if _, status, _ := app.passkeyLogin(authenticator); status != http.StatusUnauthorized {
+		t.Errorf("cloned authenticator status = %d, want %d", status, http.StatusUnauthorized)
+	}
+	authenticator.SetSignCount(100)
+
+	rec = app.do("PUT", fmt.Sprintf("/dashboard/passkeys/%d", passkey.ID), session, model.PasskeyName{Name: "work laptop"})
+	if rec.Code != http.StatusOK {
+		t.Errorf("rename status = %d, body %q", rec.Code, rec.Body)
+	}
+	rec = app.do("DELETE", fmt.Sprintf("/dashboard/passkeys/%d", passkey.ID), session, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete status = %d, body %q", rec.Code, rec.Body)
+	}
+	if _, status, _ := app.passkeyLogin(authenticator); status != http.StatusUnauthorized {
+		t.Errorf("deleted passkey login status = %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestPasskeysBelongToTheirUser(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+	app.register("ada@example.com", "first-password")
+	app.register("bob@example.com", "second-password")
+	ada := app.login("ada@example.com", "first-password")
+	bob := app.login("bob@example.com", "second-password")
+
+	passkey := app.addPasskey(ada, softauthn.New(testBaseURL), "phone")
+
+	rec := app.do("DELETE", fmt.Sprintf("/dashboard/passkeys/%d", passkey.ID), bob, nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("deleting another user's passkey status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	// a registration started by ada can't be finished by bob
+	rec = app.do("POST", "/dashboard/passkeys/register/begin", ada, nil)
+	var options webauthn.CreationOptions
+	json.NewDecoder(rec.Body).Decode(&options)
+	credential, _ := softauthn.New(testBaseURL).Create(options)
+	rec = app.do("POST", "/dashboard/passkeys/register/finish", bob, model.PasskeyRegistration{Name: "stolen", Credential: credential})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("finishing another user's registration status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,319 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/suryasaputra2016/course/backend/answer"
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/expression"
+	"github.com/suryasaputra2016/course/backend/middleware"
+	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/problem"
+	"github.com/suryasaputra2016/course/backend/repo"
+	"github.com/suryasaputra2016/course/backend/variant"
+)
+
+type QuestionHandler struct {
+	qr repo.QuestionStore
+	rr repo.RoleStore
+}
+
+func NewQuestionHandler(qr repo.QuestionStore, rr repo.RoleStore) *QuestionHandler {
+	return &QuestionHandler{
+		qr: qr,
+		rr: rr,
+	}
+}
+
+func (qh QuestionHandler) CreateQuestion(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	var input model.QuestionInput
+	err := decodeJSON(w, r, &input)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	err = checkQuestionInput(input)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	question := model.Question{
+		AuthorID:        user.ID,
+		Title:           input.Title,
+		Statement:       input.Statement,
+		Topic:           input.Topic,
+		Difficulty:      input.Difficulty,
+		AnswerSpec:      input.AnswerSpec,
+		Variables:       input.Variables,
+		MaxAttempts:     input.MaxAttempts,
+		CooldownSeconds: input.CooldownSeconds,
+	}
+	err = qh.qr.Create(ctx, &question)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("creating question in handler: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(question)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding question: %w", err))
+		return
+	}
+}
+
+func (qh QuestionHandler) ListQuestions(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	limit, offset := pagination(r, 20, 100)
+	questions, err := qh.qr.List(ctx, r.URL.Query().Get("topic"), limit, offset)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("listing questions in handler: %w", err))
+		return
+	}
+
+	canSeeAll, err := qh.rr.HasPermission(ctx, user.ID, model.PermEditAnyQuestion)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("checking permission: %w", err))
+		return
+	}
+	// one broken template leaves the list rather than failing it for everyone
+	visible := questions[:0]
+	for _, question := range questions {
+		if !canSeeAll && question.AuthorID != user.ID {
+			err = studentView(&question, user.ID)
+			if err != nil {
+				log.Printf("hiding question %d from students: %s", question.ID, err)
+				continue
+			}
+		}
+		visible = append(visible, question)
+	}
+	questions = visible
+
+	err = json.NewEncoder(w).Encode(questions)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding questions: %w", err))
+		return
+	}
+}
+
+func (qh QuestionHandler) GetQuestion(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	question, ok := qh.questionFromPath(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	canEdit, err := qh.canManage(ctx, user, question, model.PermEditAnyQuestion)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("checking permission: %w", err))
+		return
+	}
+	if !canEdit {
+		err = studentView(question, user.ID)
+		if err != nil {
+			problem.Write(w, r, fmt.Errorf("rendering question for student: %w", err))
+			return
+		}
+	}
+
+	err = json.NewEncoder(w).Encode(question)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding question: %w", err))
+		return
+	}
+}
+
+func (qh QuestionHandler) UpdateQuestion(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	question, ok := qh.questionFromPath(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	canEdit, err := qh.canManage(ctx, user, question, model.PermEditAnyQuestion)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("checking permission: %w", err))
+		return
+	}
+	if !canEdit {
+		problem.Write(w, r, apperr.Forbidden("not allowed to edit this question"))
+		return
+	}
+
+	var input model.QuestionInput
+	err = decodeJSON(w, r, &input)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	err = checkQuestionInput(input)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	question.Title = input.Title
+	question.Statement = input.Statement
+	question.Topic = input.Topic
+	question.Difficulty = input.Difficulty
+	question.AnswerSpec = input.AnswerSpec
+	question.Variables = input.Variables
+	question.MaxAttempts = input.MaxAttempts
+	question.CooldownSeconds = input.CooldownSeconds
+	err = qh.qr.Update(ctx, question)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("updating question in handler: %w", err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(question)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding question: %w", err))
+		return
+	}
+}
+
+func (qh QuestionHandler) DeleteQuestion(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	question, ok := qh.questionFromPath(ctx, w, r)
+	if !ok {
+		return
+	}
+
+	canDelete, err := qh.canManage(ctx, user, question, model.PermDeleteAnyQuestion)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("checking permission: %w", err))
+		return
+	}
+	if !canDelete {
+		problem.Write(w, r, apperr.Forbidden("not allowed to delete this question"))
+		return
+	}
+
+	err = qh.qr.Delete(ctx, question.ID)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("deleting question in handler: %w", err))
+		return
+	}
+
+	response, err := json.Marshal(map[string]string{"message": "question deleted"})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("marshaling data to json: %w", err))
+		return
+	}
+	w.Write(response)
+}
+
+// questionFromPath loads the question named by {questionid} and writes the
+// error response itself when it cannot
+func (qh QuestionHandler) questionFromPath(ctx context.Context, w http.ResponseWriter, r *http.Request) (*model.Question, bool) {
+	questionID, err := strconv.Atoi(r.PathValue("questionid"))
+	if err != nil {
+		problem.Write(w, r, apperr.Invalid("questionid", "must be a number").Wrap(err))
+		return nil, false
+	}
+
+	question, err := qh.qr.GetByID(ctx, questionID)
+	if err != nil {
+		problem.Write(w, r, notFoundAs(err, "question not found"))
+		return nil, false
+	}
+	return question, true
+}
+
+// canManage reports whether user is the author of question or holds permission
+func (qh QuestionHandler) canManage(ctx context.Context, user *model.User, question *model.Question, permission string) (bool, error) {
+	if question.AuthorID == user.ID {
+		return true, nil
+	}
+	return qh.rr.HasPermission(ctx, user.ID, permission)
+}
+
+// checkQuestionInput checks what the validate tags cannot, that the answer
+// spec and variables make a question that can be answered
+func checkQuestionInput(input model.QuestionInput) error {
+	var invalid apperr.FieldErrors
+	_, err := answer.ParseUnit(input.AnswerSpec.Unit)
+	if err != nil {
+		invalid.Add("answer_spec.unit", err.Error())
+	}
+	if input.AnswerSpec.SymbolicAnswer != "" {
+		_, err = expression.Parse(input.AnswerSpec.SymbolicAnswer)
+		if err != nil {
+			invalid.Add("answer_spec.symbolic_answer", err.Error())
+		}
+	}
+	for _, name := range input.AnswerSpec.Constants {
+		if !expression.IsConstant(name) {
+			invalid.Add("answer_spec.constants", name+" is not a built-in constant")
+		}
+	}
+	err = variant.Validate(input.Statement, input.Variables, *input.AnswerSpec)
+	if err != nil {
+		invalid.Add("variables", err.Error())
+	}
+	return invalid.Err()
+}
+
+// studentView replaces a question template with the variant of userID and
+// hides the expected answer
+func studentView(question *model.Question, userID int) error {
+	v, err := variant.Generate(*question, userID)
+	if err != nil {
+		return err
+	}
+	question.Statement = v.Statement
+	question.AnswerSpec = nil
+	question.Variables = nil
+	return nil
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/validate"
+)
+
+// requestTimeout bounds the database work of one request
+const requestTimeout = 5 * time.Second
+
+// requestContext derives the context for repo calls from the request, so a
+// client disconnect or the timeout cancels running queries
+func requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), requestTimeout)
+}
+
+// maxBodyBytes bounds the size of a JSON request body
+const maxBodyBytes = 1 << 20
+
+// decodeJSON reads the request body into v and checks it against its validate
+// tags. A body that is not valid JSON, has fields v doesn't know or values of
+// the wrong type is a validation error.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err == nil && decoder.More() {
+		err = errors.New("data after the JSON value")
+	}
+	if err != nil {
+		return decodeError(err)
+	}
+	return validate.Struct(v)
+}
+
+// decodeError tells the client what is wrong with the body it sent
+func decodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	var sizeErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return apperr.Invalid(typeErr.Field, "must be a "+jsonType(typeErr.Type)).Wrap(err)
+	case errors.As(err, &sizeErr):
+		return apperr.BadRequest(fmt.Sprintf("request body is larger than %d bytes", sizeErr.Limit)).Wrap(err)
+	case errors.Is(err, io.EOF):
+		return apperr.BadRequest("request body is empty").Wrap(err)
+	}
+	// the decoder has no typed error for unknown fields
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return apperr.Invalid(strings.Trim(field, `"`), "unknown field").Wrap(err)
+	}
+	return apperr.BadRequest("request body is not valid JSON").Wrap(err)
+}
+
+// jsonType names the JSON type a Go type is decoded from
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "whole number"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	}
+	return "object"
+}
+
+// notFoundAs gives a missing row the client facing message, any other error
+// is returned unchanged
+func notFoundAs(err error, message string) error {
+	if errors.Is(err, apperr.ErrNotFound) {
+		return apperr.NotFound(message).Wrap(err)
+	}
+	return err
+}
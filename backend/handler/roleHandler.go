@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/middleware"
+	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/problem"
+	"github.com/suryasaputra2016/course/backend/repo"
+)
+
+type RoleHandler struct {
+	rr  repo.RoleStore
+	ur  repo.UserStore
+	uow repo.Transactor
+}
+
+func NewRoleHandler(rr repo.RoleStore, ur repo.UserStore, uow repo.Transactor) *RoleHandler {
+	return &RoleHandler{
+		rr:  rr,
+		ur:  ur,
+		uow: uow,
+	}
+}
+
+func (rh RoleHandler) GrantRole(w http.ResponseWriter, r *http.Request) {
+	rh.changeRole(w, r, model.RoleActionGrant)
+}
+
+func (rh RoleHandler) RevokeRole(w http.ResponseWriter, r *http.Request) {
+	rh.changeRole(w, r, model.RoleActionRevoke)
+}
+
+func (rh RoleHandler) changeRole(w http.ResponseWriter, r *http.Request, action string) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	actor, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	userID, err := strconv.Atoi(r.PathValue("userid"))
+	if err != nil {
+		problem.Write(w, r, apperr.Invalid("userid", "must be a number").Wrap(err))
+		return
+	}
+
+	var roleChange model.RoleChange
+	err = decodeJSON(w, r, &roleChange)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	_, err = rh.ur.GetByID(ctx, userID)
+	if err != nil {
+		problem.Write(w, r, notFoundAs(err, "user not found"))
+		return
+	}
+
+	if action == model.RoleActionGrant {
+		err = rh.rr.Grant(ctx, userID, roleChange.Role, actor.ID)
+	} else {
+		err = rh.revoke(ctx, userID, roleChange.Role, actor.ID)
+	}
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("changing role from handler: %w", err))
+		return
+	}
+
+	user, err := rh.ur.GetByID(ctx, userID)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("getting user from handler: %w", err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(user)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding user: %w", err))
+		return
+	}
+}
+
+// revoke takes role from the user unless that leaves nobody holding the admin
+// role, as then nobody could grant it again
+func (rh RoleHandler) revoke(ctx context.Context, userID int, role string, actorID int) error {
+	return rh.uow.Do(ctx, func(tx repo.Repos) error {
+		err := tx.Roles.Revoke(ctx, userID, role, actorID)
+		if err != nil || role != model.RoleAdmin {
+			return err
+		}
+		admins, err := tx.Roles.CountHolders(ctx, model.RoleAdmin)
+		if err != nil {
+			return err
+		}
+		if admins == 0 {
+			return apperr.Conflict("cannot revoke the admin role from the last admin")
+		}
+		return nil
+	})
+}
+
+func (rh RoleHandler) ListRoleAudits(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	limit, offset := pagination(r, 50, 200)
+
+	audits, err := rh.rr.ListAudits(ctx, limit, offset)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("listing role audits from handler: %w", err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(audits)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding role audits: %w", err))
+		return
+	}
+}
+
+// pagination reads limit and offset query values, falling back to defaultLimit
+// and capping limit at maxLimit
+func pagination(r *http.Request, defaultLimit, maxLimit int) (int, int) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultLimit
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
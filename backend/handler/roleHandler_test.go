@@ -0,0 +1,48 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/suryasaputra2016/course/backend/config"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+func TestRevokeLastAdmin(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+	ada := app.register("ada@example.com", "first-password")
+	bob := app.register("bob@example.com", "first-password")
+	err := app.db.Repos().Roles.Grant(context.Background(), ada.ID, model.RoleAdmin, 0)
+	if err != nil {
+		t.Fatalf("granting admin: %s", err)
+	}
+	session := app.login("ada@example.com", "first-password")
+	admin := model.RoleChange{Role: model.RoleAdmin}
+	adaPath := "/dashboard/admin/roles/" + strconv.Itoa(ada.ID)
+	bobPath := "/dashboard/admin/roles/" + strconv.Itoa(bob.ID)
+
+	rec := app.do("DELETE", adaPath, session, admin)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("revoke the only admin status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	rec = app.do("DELETE", bobPath, session, admin)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("revoke admin from a non admin status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	rec = app.do("POST", bobPath, session, admin)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("grant admin status = %d, body %q", rec.Code, rec.Body)
+	}
+	rec = app.do("DELETE", adaPath, session, admin)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("revoke one of two admins status = %d, body %q", rec.Code, rec.Body)
+	}
+
+	admins, err := app.db.Repos().Roles.CountHolders(context.Background(), model.RoleAdmin)
+	if err != nil || admins != 1 {
+		t.Errorf("admins = %d, %v, want 1", admins, err)
+	}
+}
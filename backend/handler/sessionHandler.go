@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/middleware"
+	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/problem"
+)
+
+// maxUserAgentBytes bounds the user agent kept with a session
+const maxUserAgentBytes = 512
+
+// ListSessions answers the devices the user is logged in on, the one asking
+// marked current
+func (uh UserHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	current, ok := middleware.SessionFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	sessions, err := uh.sr.ListByUser(ctx, current.UserID)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("listing sessions in handler: %w", err))
+		return
+	}
+
+	devices := make([]model.SessionDevice, 0, len(sessions))
+	for _, session := range sessions {
+		devices = append(devices, model.SessionDevice{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == current.ID,
+		})
+	}
+
+	err = json.NewEncoder(w).Encode(devices)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding sessions: %w", err))
+		return
+	}
+}
+
+// RevokeSession logs the user out on one device, revoking the current
+// session is the same as LogoutUser
+func (uh UserHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	current, ok := middleware.SessionFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	sessionID, err := strconv.Atoi(r.PathValue("sessionid"))
+	if err != nil {
+		problem.Write(w, r, apperr.Invalid("sessionid", "must be a number").Wrap(err))
+		return
+	}
+
+	err = uh.sr.Delete(ctx, current.UserID, sessionID)
+	if err != nil {
+		problem.Write(w, r, notFoundAs(err, "session not found"))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(map[string]string{"message": "session revoked"})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding message: %w", err))
+		return
+	}
+}
+
+// RevokeOtherSessions logs the user out everywhere but the device asking
+func (uh UserHandler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	current, ok := middleware.SessionFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	revoked, err := uh.sr.DeleteOthers(ctx, current.UserID, current.ID)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("deleting other sessions in handler: %w", err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(map[string]int64{"revoked": revoked})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding revoked count: %w", err))
+		return
+	}
+}
+
+// userAgent is the User-Agent of r cut to maxUserAgentBytes, as valid UTF-8
+// since headers may carry any byte
+func userAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentBytes {
+		ua = ua[:maxUserAgentBytes]
+	}
+	return strings.ToValidUTF8(ua, "")
+}
@@ -0,0 +1,146 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/suryasaputra2016/course/backend/config"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+// loginFrom logs in with the User-Agent header set to userAgent
+func (app *testApp) loginFrom(email, password, userAgent string) string {
+	app.t.Helper()
+	encoded, _ := json.Marshal(model.LoginUser{Email: email, Password: password})
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(string(encoded)))
+	req.Header.Set("User-Agent", userAgent)
+	rec := httptest.NewRecorder()
+	app.handler.ServeHTTP(rec, req)
+	var body map[string]string
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusOK || body["token"] == "" {
+		app.t.Fatalf("login %s: status %d, body %q", email, rec.Code, rec.Body)
+	}
+	return body["token"]
+}
+
+func (app *testApp) sessions(session string) []model.SessionDevice {
+	app.t.Helper()
+	rec := app.do("GET", "/dashboard/sessions", session, nil)
+	if rec.Code != http.StatusOK {
+		app.t.Fatalf("list sessions status = %d, body %q", rec.Code, rec.Body)
+	}
+	var devices []model.SessionDevice
+	err := json.NewDecoder(rec.Body).Decode(&devices)
+	if err != nil {
+		app.t.Fatalf("decoding sessions: %s", err)
+	}
+	return devices
+}
+
+func TestListSessions(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+	app.register("ada@example.com", "first-password")
+	app.register("bob@example.com", "first-password")
+	laptop := app.loginFrom("ada@example.com", "first-password", "Firefox on Linux")
+	phone := app.loginFrom("ada@example.com", "first-password", "Safari on iOS")
+	app.login("bob@example.com", "first-password")
+
+	devices := app.sessions(phone)
+	if len(devices) != 2 {
+		t.Fatalf("sessions = %+v, want the two of ada", devices)
+	}
+	agents := map[string]bool{}
+	for _, device := range devices {
+		agents[device.UserAgent] = device.Current
+		if device.IP == "" || device.CreatedAt.IsZero() || device.LastSeenAt.IsZero() {
+			t.Errorf("session %+v misses its ip or timestamps", device)
+		}
+	}
+	if current, ok := agents["Safari on iOS"]; !ok || !current {
+		t.Errorf("sessions = %+v, want the phone marked current", devices)
+	}
+	if current, ok := agents["Firefox on Linux"]; !ok || current {
+		t.Errorf("sessions = %+v, want the laptop not marked current", devices)
+	}
+
+	rec := app.do("GET", "/dashboard/sessions", laptop, nil)
+	if strings.Contains(rec.Body.String(), "token") {
+		t.Errorf("session list shows tokens: %s", rec.Body)
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+	app.register("ada@example.com", "first-password")
+	app.register("bob@example.com", "first-password")
+	laptop := app.loginFrom("ada@example.com", "first-password", "Firefox on Linux")
+	phone := app.loginFrom("ada@example.com", "first-password", "Safari on iOS")
+	bob := app.login("bob@example.com", "first-password")
+
+	var laptopID int
+	for _, device := range app.sessions(phone) {
+		if !device.Current {
+			laptopID = device.ID
+		}
+	}
+	path := "/dashboard/sessions/" + strconv.Itoa(laptopID)
+
+	rec := app.do("DELETE", path, bob, nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("revoke session of another user status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	rec = app.do("DELETE", "/dashboard/sessions/laptop", phone, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("revoke with a bad id status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	rec = app.do("DELETE", path, phone, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("revoke status = %d, body %q", rec.Code, rec.Body)
+	}
+	rec = app.do("GET", "/dashboard/sessions", laptop, nil)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked session status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	rec = app.do("DELETE", path, phone, nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("revoke again status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+	app.register("ada@example.com", "first-password")
+	app.register("bob@example.com", "first-password")
+	others := []string{
+		app.login("ada@example.com", "first-password"),
+		app.login("ada@example.com", "first-password"),
+	}
+	current := app.login("ada@example.com", "first-password")
+	bob := app.login("bob@example.com", "first-password")
+
+	rec := app.do("DELETE", "/dashboard/sessions/others", current, nil)
+	var body struct {
+		Revoked int `json:"revoked"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusOK || body.Revoked != 2 {
+		t.Fatalf("log out elsewhere: status %d, revoked %d, want 2", rec.Code, body.Revoked)
+	}
+
+	for _, session := range others {
+		rec = app.do("GET", "/dashboard/sessions", session, nil)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("other session status = %d, want %d", rec.Code, http.StatusUnauthorized)
+		}
+	}
+	if devices := app.sessions(current); len(devices) != 1 || !devices[0].Current {
+		t.Errorf("sessions = %+v, want only the current one", devices)
+	}
+	app.sessions(bob)
+}
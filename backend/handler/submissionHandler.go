@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/answer"
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/middleware"
+	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/problem"
+	"github.com/suryasaputra2016/course/backend/repo"
+	"github.com/suryasaputra2016/course/backend/variant"
+)
+
+var (
+	errNoAttemptsLeft = apperr.Forbidden("no attempts left")
+	errCooldown       = errors.New("attempt during cooldown")
+)
+
+type SubmissionHandler struct {
+	sbr repo.SubmissionStore
+	qr  repo.QuestionStore
+	uow repo.Transactor
+}
+
+func NewSubmissionHandler(sbr repo.SubmissionStore, qr repo.QuestionStore, uow repo.Transactor) *SubmissionHandler {
+	return &SubmissionHandler{
+		sbr: sbr,
+		qr:  qr,
+		uow: uow,
+	}
+}
+
+func (sh SubmissionHandler) SubmitAnswer(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	questionID, err := strconv.Atoi(r.PathValue("questionid"))
+	if err != nil {
+		problem.Write(w, r, apperr.Invalid("questionid", "must be a number").Wrap(err))
+		return
+	}
+
+	var input model.SubmissionInput
+	err = decodeJSON(w, r, &input)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	question, err := sh.qr.GetByID(ctx, questionID)
+	if err != nil {
+		problem.Write(w, r, notFoundAs(err, "question not found"))
+		return
+	}
+
+	// template questions are checked against the values this user was shown
+	v, err := variant.Generate(*question, user.ID)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("generating question variant: %w", err))
+		return
+	}
+
+	submission := model.Submission{
+		UserID:     user.ID,
+		QuestionID: question.ID,
+		Answer:     input.Answer,
+		Verdict:    answer.Check(v.AnswerSpec, input.Answer),
+	}
+
+	// counting attempts and storing the submission in one transaction keeps
+	// concurrent submissions from going over the attempt limit
+	var nextAttemptAt time.Time
+	err = sh.uow.Do(ctx, func(tx repo.Repos) error {
+		stats, err := tx.Submissions.AttemptStats(ctx, user.ID, question.ID)
+		if err != nil {
+			return err
+		}
+
+		if question.MaxAttempts > 0 && stats.Count >= question.MaxAttempts {
+			return errNoAttemptsLeft
+		}
+
+		cooldown := time.Duration(question.CooldownSeconds) * time.Second
+		nextAttemptAt = stats.LastAttemptAt.Add(cooldown)
+		if stats.Count > 0 && time.Now().Before(nextAttemptAt) {
+			return errCooldown
+		}
+
+		return tx.Submissions.Create(ctx, &submission)
+	})
+	if errors.Is(err, errCooldown) {
+		middleware.SetRetryAfter(w, time.Until(nextAttemptAt))
+		err = apperr.RateLimited(fmt.Sprintf("try again after %s", nextAttemptAt.Format(time.RFC3339)))
+	}
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("creating submission in handler: %w", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(submission.ForStudent())
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding submission: %w", err))
+		return
+	}
+}
+
+func (sh SubmissionHandler) ListSubmissions(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	questionID := 0
+	if questionIDString := r.URL.Query().Get("question_id"); questionIDString != "" {
+		var err error
+		questionID, err = strconv.Atoi(questionIDString)
+		if err != nil {
+			problem.Write(w, r, apperr.Invalid("question_id", "must be a number").Wrap(err))
+			return
+		}
+	}
+
+	limit, offset := pagination(r, 20, 100)
+	submissions, err := sh.sbr.ListByUser(ctx, user.ID, questionID, limit, offset)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("listing submissions in handler: %w", err))
+		return
+	}
+
+	shown := make([]model.StudentSubmission, 0, len(submissions))
+	for _, submission := range submissions {
+		shown = append(shown, submission.ForStudent())
+	}
+
+	err = json.NewEncoder(w).Encode(shown)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding submissions: %w", err))
+		return
+	}
+}
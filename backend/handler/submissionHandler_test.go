@@ -0,0 +1,124 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/suryasaputra2016/course/backend/config"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+func TestSubmissionHidesExpectedValue(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+	author := app.register("ada@example.com", "first-password")
+	err := app.db.Repos().Roles.Grant(context.Background(), author.ID, model.RoleAuthor, author.ID)
+	if err != nil {
+		t.Fatalf("granting author role: %s", err)
+	}
+	student := app.register("bob@example.com", "second-password")
+	authorSession := app.login("ada@example.com", "first-password")
+	studentSession := app.login("bob@example.com", "second-password")
+
+	rec := app.do("POST", "/dashboard/questions", authorSession, model.QuestionInput{
+		Title:      "Free fall",
+		Statement:  "How far does a stone fall in 2 s?",
+		Topic:      "kinematics",
+		Difficulty: 1,
+		AnswerSpec: &model.AnswerSpec{Value: 19.6, Unit: "m"},
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create question status = %d, body %q", rec.Code, rec.Body)
+	}
+	var question model.Question
+	err = json.NewDecoder(rec.Body).Decode(&question)
+	if err != nil {
+		t.Fatalf("decoding question: %s", err)
+	}
+
+	// converted_value and relative_error together give the expected answer away
+	wantVerdict := map[string]bool{"is_correct": true, "reason": true}
+	checkVerdict := func(what string, verdict map[string]any) {
+		t.Helper()
+		if len(verdict) != len(wantVerdict) {
+			t.Errorf("%s verdict = %v, want only is_correct and reason", what, verdict)
+		}
+		for key := range verdict {
+			if !wantVerdict[key] {
+				t.Errorf("%s verdict shows %s", what, key)
+			}
+		}
+	}
+
+	rec = app.do("POST", "/dashboard/questions/"+strconv.Itoa(question.ID)+"/submissions", studentSession, model.SubmissionInput{Answer: "1800 cm"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("submit status = %d, body %q", rec.Code, rec.Body)
+	}
+	var submitted struct {
+		Verdict map[string]any `json:"verdict"`
+	}
+	err = json.NewDecoder(rec.Body).Decode(&submitted)
+	if err != nil {
+		t.Fatalf("decoding submission: %s", err)
+	}
+	checkVerdict("submitted", submitted.Verdict)
+	if submitted.Verdict["is_correct"] != false || submitted.Verdict["reason"] != model.VerdictReasonValue {
+		t.Errorf("submitted verdict = %v, want a wrong value", submitted.Verdict)
+	}
+
+	rec = app.do("GET", "/dashboard/submissions", studentSession, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list submissions status = %d, body %q", rec.Code, rec.Body)
+	}
+	var listed []struct {
+		Verdict map[string]any `json:"verdict"`
+	}
+	err = json.NewDecoder(rec.Body).Decode(&listed)
+	if err != nil || len(listed) != 1 {
+		t.Fatalf("listed submissions = %v, %v, want one", listed, err)
+	}
+	checkVerdict("listed", listed[0].Verdict)
+
+	// the full verdict is still stored
+	stored, err := app.db.Repos().Submissions.ListByUser(context.Background(), student.ID, question.ID, 10, 0)
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("stored submissions = %v, %v, want one", stored, err)
+	}
+	if stored[0].Verdict.ConvertedValue != 18 {
+		t.Errorf("stored converted value = %g, want 18", stored[0].Verdict.ConvertedValue)
+	}
+}
+
+func TestBrokenTemplateLeavesQuestionList(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+	author := app.register("ada@example.com", "first-password")
+	app.register("bob@example.com", "second-password")
+	studentSession := app.login("bob@example.com", "second-password")
+
+	// stored straight in the repo, as templates saved before Validate bounded
+	// the step count were
+	questions := app.db.Repos().Questions
+	for _, question := range []model.Question{
+		{AuthorID: author.ID, Title: "Fine", Statement: "Fall for {{t}} s", Topic: "kinematics", Difficulty: 1,
+			Variables: []model.Variable{{Name: "t", Min: 1, Max: 3, Step: 0.5}}, AnswerSpec: &model.AnswerSpec{Formula: "g*t^2/2", Unit: "m"}},
+		{AuthorID: author.ID, Title: "Broken", Statement: "Fall for {{t}} s", Topic: "kinematics", Difficulty: 1,
+			Variables: []model.Variable{{Name: "t", Max: 1e12, Step: 1e-9}}, AnswerSpec: &model.AnswerSpec{Formula: "g*t^2/2", Unit: "m"}},
+	} {
+		err := questions.Create(context.Background(), &question)
+		if err != nil {
+			t.Fatalf("creating question: %s", err)
+		}
+	}
+
+	rec := app.do("GET", "/dashboard/questions", studentSession, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list questions status = %d, body %q", rec.Code, rec.Body)
+	}
+	var listed []model.Question
+	json.NewDecoder(rec.Body).Decode(&listed)
+	if len(listed) != 1 || listed[0].Title != "Fine" {
+		t.Errorf("listed questions = %+v, want only the one that renders", listed)
+	}
+}
@@ -0,0 +1,462 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/middleware"
+	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/problem"
+	"github.com/suryasaputra2016/course/backend/qrcode"
+	"github.com/suryasaputra2016/course/backend/repo"
+	"github.com/suryasaputra2016/course/backend/totp"
+	"github.com/suryasaputra2016/course/backend/utils"
+)
+
+const (
+	// totpIssuer names the account in authenticator apps
+	totpIssuer = "Course"
+	// challengeLifetime is how long the second step of a login can take
+	challengeLifetime = 5 * time.Minute
+	// maxChallengeAttempts is how many wrong codes end a login challenge
+	maxChallengeAttempts = 5
+	// recoveryCodeCount is how many recovery codes a user gets at a time
+	recoveryCodeCount = 10
+	// recoveryCodeBytes makes an 80 bit code, 16 base32 characters
+	recoveryCodeBytes = 10
+	// qrScale is the width in pixels of one module of the enrolment QR code
+	qrScale = 6
+)
+
+var (
+	errChallengeInvalid = apperr.Unauthorized("login challenge is invalid or expired, log in again")
+	errWrongCode        = apperr.Unauthorized("two-factor code is incorrect")
+	errCodeInvalid      = apperr.Invalid("code", "code is incorrect")
+	errTOTPEnabled      = apperr.Conflict("two-factor authentication is already enabled")
+	errTOTPNotEnabled   = apperr.NotFound("two-factor authentication is not enabled")
+)
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// LoginSecondFactor finishes a login started by LoginUser with a code from
+// the authenticator app or an unused recovery code
+func (uh UserHandler) LoginSecondFactor(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	var second model.LoginSecondFactor
+	err := decodeJSON(w, r, &second)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	if (second.Code == "") == (second.RecoveryCode == "") {
+		problem.Write(w, r, apperr.Invalid("code", "send either code or recovery_code"))
+		return
+	}
+
+	challenge, err := uh.lcr.GetFromTokenHash(ctx, utils.HashToken(second.ChallengeToken))
+	if errors.Is(err, apperr.ErrNotFound) {
+		problem.Write(w, r, errChallengeInvalid.Wrap(err))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("getting login challenge: %w", err))
+		return
+	}
+	if challenge.Attempts >= maxChallengeAttempts {
+		problem.Write(w, r, errChallengeInvalid)
+		return
+	}
+
+	user, err := uh.ur.GetByID(ctx, challenge.UserID)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("getting user in handler: %w", err))
+		return
+	}
+	now := time.Now()
+	if user.IsLocked(now) {
+		middleware.SetRetryAfter(w, user.LockedUntil.Sub(now))
+		problem.Write(w, r, errLockedOut)
+		return
+	}
+
+	if second.Code != "" {
+		err = uh.useTOTPCode(ctx, user.ID, second.Code)
+	} else {
+		err = uh.tfr.UseRecoveryCode(ctx, user.ID, hashRecoveryCode(second.RecoveryCode))
+	}
+	if errors.Is(err, apperr.ErrNotFound) {
+		failErr := uh.recordChallengeFailure(ctx, challenge, user)
+		if failErr != nil {
+			problem.Write(w, r, failErr)
+			return
+		}
+		problem.Write(w, r, errWrongCode.Wrap(err))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("checking second factor: %w", err))
+		return
+	}
+
+	// deleting the challenge makes it single use, a concurrent request that
+	// also had a right code loses here
+	err = uh.lcr.Delete(ctx, challenge.ID)
+	if errors.Is(err, apperr.ErrNotFound) {
+		problem.Write(w, r, errChallengeInvalid.Wrap(err))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("deleting login challenge: %w", err))
+		return
+	}
+
+	if user.FailedLogins > 0 {
+		err = uh.ur.ResetLoginFailures(ctx, user.ID)
+		if err != nil {
+			problem.Write(w, r, fmt.Errorf("resetting login failures: %w", err))
+			return
+		}
+	}
+
+	token, err := startSession(ctx, uh.sr, r, user.ID)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(map[string]string{"token": token})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding user: %w", err))
+		return
+	}
+}
+
+// startChallenge stores a login challenge for user and returns its token
+func startChallenge(ctx context.Context, lcr repo.LoginChallengeStore, userID int) (string, error) {
+	token, err := utils.GenerateToken(32)
+	if err != nil {
+		return "", fmt.Errorf("generating token: %w", err)
+	}
+	challenge := model.LoginChallenge{
+		UserID:    userID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(challengeLifetime),
+	}
+	err = lcr.Create(ctx, &challenge)
+	if err != nil {
+		return "", fmt.Errorf("creating login challenge: %w", err)
+	}
+	return token, nil
+}
+
+// recordChallengeFailure counts a wrong code against the challenge and, like
+// a wrong password, against the account, so a stolen password doesn't allow
+// guessing codes with one challenge after another
+func (uh UserHandler) recordChallengeFailure(ctx context.Context, challenge *model.LoginChallenge, user *model.User) error {
+	attempts, err := uh.lcr.RecordAttempt(ctx, challenge.ID)
+	if err != nil && !errors.Is(err, apperr.ErrNotFound) {
+		return fmt.Errorf("recording challenge attempt: %w", err)
+	}
+	if attempts >= maxChallengeAttempts {
+		err = uh.lcr.Delete(ctx, challenge.ID)
+		if err != nil && !errors.Is(err, apperr.ErrNotFound) {
+			return fmt.Errorf("deleting login challenge: %w", err)
+		}
+	}
+	return uh.recordLoginFailure(ctx, user)
+}
+
+// useTOTPCode accepts code for a user with a confirmed enrolment, a wrong,
+// reused or missing code is reported as apperr.ErrNotFound
+func (uh UserHandler) useTOTPCode(ctx context.Context, userID int, code string) error {
+	enrolment, err := uh.tfr.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !enrolment.IsConfirmed() {
+		return fmt.Errorf("checking totp code: %w", apperr.ErrNotFound)
+	}
+	step, ok, err := totp.Verify(enrolment.Secret, code, time.Now(), enrolment.LastUsedStep)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("checking totp code: %w", apperr.ErrNotFound)
+	}
+	// the update only succeeds for a newer step, so a code is accepted once
+	// even when two requests check it at the same time
+	return uh.tfr.UseTOTPStep(ctx, userID, step)
+}
+
+// EnrollTOTP starts adding an authenticator app, it returns the secret and
+// the otpauth URI the app imports. Two-factor login starts with ConfirmTOTP.
+func (uh UserHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	enrolment := model.TOTP{UserID: user.ID, Secret: secret}
+	err = uh.tfr.UpsertTOTP(ctx, &enrolment)
+	if errors.Is(err, apperr.ErrConflict) {
+		err = errTOTPEnabled.Wrap(err)
+	}
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("enrolling totp from handler: %w", err))
+		return
+	}
+
+	response := model.TOTPEnrolment{
+		Secret: secret,
+		URI:    totp.URI(totpIssuer, user.Email, secret),
+	}
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding totp enrolment: %w", err))
+		return
+	}
+}
+
+// TOTPQRCode draws the otpauth URI of an unconfirmed enrolment as a PNG QR code
+func (uh UserHandler) TOTPQRCode(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	enrolment, err := uh.tfr.GetTOTP(ctx, user.ID)
+	if err != nil {
+		problem.Write(w, r, notFoundAs(err, "no two-factor enrolment was started"))
+		return
+	}
+	// the secret is only shown until it is confirmed
+	if enrolment.IsConfirmed() {
+		problem.Write(w, r, errTOTPEnabled)
+		return
+	}
+
+	code, err := qrcode.New(totp.URI(totpIssuer, user.Email, enrolment.Secret))
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding totp qr code: %w", err))
+		return
+	}
+	png, err := code.PNG(qrScale)
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("drawing totp qr code: %w", err))
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(png)
+}
+
+// ConfirmTOTP turns two-factor login on once a code from the app checks out,
+// it answers with the recovery codes, which are never shown again
+func (uh UserHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	var code model.TOTPCode
+	err := decodeJSON(w, r, &code)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	err = uh.uow.Do(ctx, func(tx repo.Repos) error {
+		enrolment, err := tx.TwoFactor.GetTOTP(ctx, user.ID)
+		if err != nil {
+			return notFoundAs(err, "no two-factor enrolment was started")
+		}
+		if enrolment.IsConfirmed() {
+			return errTOTPEnabled
+		}
+		step, ok, err := totp.Verify(enrolment.Secret, code.Code, time.Now(), enrolment.LastUsedStep)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errCodeInvalid
+		}
+		err = tx.TwoFactor.ConfirmTOTP(ctx, user.ID, step)
+		if err != nil {
+			return err
+		}
+		return tx.TwoFactor.ReplaceRecoveryCodes(ctx, user.ID, hashes)
+	})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("confirming totp from handler: %w", err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding recovery codes: %w", err))
+		return
+	}
+}
+
+// DisableTOTP turns two-factor login off, it takes a current code so a
+// stolen session alone can't do it
+func (uh UserHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	var code model.TOTPCode
+	err := decodeJSON(w, r, &code)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	err = uh.uow.Do(ctx, func(tx repo.Repos) error {
+		err := uh.checkCurrentCode(ctx, tx, user.ID, code.Code)
+		if err != nil {
+			return err
+		}
+		return tx.TwoFactor.DeleteTOTP(ctx, user.ID)
+	})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("disabling totp from handler: %w", err))
+		return
+	}
+
+	response, err := json.Marshal(map[string]string{"message": "two-factor authentication disabled"})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("marshaling data to json: %w", err))
+		return
+	}
+	w.Write(response)
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of the user, used or
+// not, with new ones
+func (uh UserHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
+
+	var code model.TOTPCode
+	err := decodeJSON(w, r, &code)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	err = uh.uow.Do(ctx, func(tx repo.Repos) error {
+		err := uh.checkCurrentCode(ctx, tx, user.ID, code.Code)
+		if err != nil {
+			return err
+		}
+		return tx.TwoFactor.ReplaceRecoveryCodes(ctx, user.ID, hashes)
+	})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("regenerating recovery codes from handler: %w", err))
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(map[string][]string{"recovery_codes": codes})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("encoding recovery codes: %w", err))
+		return
+	}
+}
+
+// checkCurrentCode checks code in tx for a user with two-factor login on
+func (uh UserHandler) checkCurrentCode(ctx context.Context, tx repo.Repos, userID int, code string) error {
+	enrolment, err := tx.TwoFactor.GetTOTP(ctx, userID)
+	if errors.Is(err, apperr.ErrNotFound) || (err == nil && !enrolment.IsConfirmed()) {
+		return errTOTPNotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	step, ok, err := totp.Verify(enrolment.Secret, code, time.Now(), enrolment.LastUsedStep)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errCodeInvalid
+	}
+	err = tx.TwoFactor.UseTOTPStep(ctx, userID, step)
+	if errors.Is(err, apperr.ErrNotFound) {
+		return errCodeInvalid.Wrap(err)
+	}
+	return err
+}
+
+// newRecoveryCodes returns codes to show the user and the hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	raw := make([]byte, recoveryCodeBytes)
+	for i := range codes {
+		_, err := rand.Read(raw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("generating recovery code: %w", err)
+		}
+		code := strings.ToLower(recoveryEncoding.EncodeToString(raw))
+		codes[i] = code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+		hashes[i] = hashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a code the way it was stored, however it was typed
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return utils.HashToken(code)
+}
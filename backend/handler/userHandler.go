@@ -1,359 +1,714 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"strconv"
+	"sync"
 	"time"
 
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/config"
+	"github.com/suryasaputra2016/course/backend/mailer"
+	"github.com/suryasaputra2016/course/backend/middleware"
 	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/outbox"
+	"github.com/suryasaputra2016/course/backend/password"
+	"github.com/suryasaputra2016/course/backend/problem"
 	"github.com/suryasaputra2016/course/backend/repo"
 	"github.com/suryasaputra2016/course/backend/utils"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	// verificationLifetime is how long an email verification token is valid
+	verificationLifetime = 24 * time.Hour
+	// verificationCooldown is the minimum wait between two verification emails
+	verificationCooldown = time.Minute
+	// maxVerificationSends caps verification emails per repo.VerificationSendWindow
+	maxVerificationSends = 5
+	// passwordResetLifetime is how long a password reset token is valid
+	passwordResetLifetime = 5 * time.Minute
+)
+
+// accountExistsLimit is how often the owner of an address is told that
+// someone tried to sign up with it
+var accountExistsLimit = model.RateLimit{Burst: 1, Every: time.Hour}
+
+var (
+	// errBadCredentials is the answer to both an unknown email and a wrong
+	// password, so login doesn't reveal which addresses have an account
+	errBadCredentials = apperr.Unauthorized("email or password is incorrect")
+	errLockedOut      = apperr.RateLimited("too many failed logins, try again later")
+	errResetInvalid   = apperr.Invalid("token", "password reset link is invalid")
+	errResetExpired   = apperr.Invalid("token", "password reset link expired")
+	errSamePassword   = apperr.Invalid("new_password", "new password is the same as the old one")
+)
+
+// dummyHash is compared against when the email of a login is unknown, so the
+// request takes as long as one with a wrong password
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// answers that are the same whether or not the email has an account
+const (
+	registeredMessage   = "check your email to verify your account"
+	resetRequestMessage = "if the address has an account, a reset email was sent"
+	verificationMessage = "verification email sent if the account needs one"
+)
+
 type UserHandler struct {
-	ur  *repo.UserRepo
-	sr  *repo.SessionRepo
-	prr *repo.PasswordResetRepo
+	ur        repo.UserStore
+	sr        repo.SessionStore
+	prr       repo.PasswordResetStore
+	evr       repo.EmailVerificationStore
+	tfr       repo.TwoFactorStore
+	lcr       repo.LoginChallengeStore
+	uow       repo.Transactor
+	policy    config.LoginPolicy
+	passwords *password.Checker
+	baseURL   string
+	// background tracks work left running after the answer was sent
+	background *sync.WaitGroup
 }
 
 func NewUserHandler(
-	ur *repo.UserRepo,
-	sr *repo.SessionRepo,
-	prr *repo.PasswordResetRepo,
+	ur repo.UserStore,
+	sr repo.SessionStore,
+	prr repo.PasswordResetStore,
+	evr repo.EmailVerificationStore,
+	tfr repo.TwoFactorStore,
+	lcr repo.LoginChallengeStore,
+	uow repo.Transactor,
+	policy config.LoginPolicy,
+	passwords *password.Checker,
+	baseURL string,
 ) *UserHandler {
 	return &UserHandler{
-		ur:  ur,
-		sr:  sr,
-		prr: prr,
+		ur:         ur,
+		sr:         sr,
+		prr:        prr,
+		evr:        evr,
+		tfr:        tfr,
+		lcr:        lcr,
+		uow:        uow,
+		policy:     policy,
+		passwords:  passwords,
+		baseURL:    baseURL,
+		background: &sync.WaitGroup{},
 	}
 }
 
+// Wait blocks until the work handlers left running in the background is done
+func (uh UserHandler) Wait() {
+	uh.background.Wait()
+}
+
 func (uh UserHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
 	var regUser model.RegisterUser
-	err := json.NewDecoder(r.Body).Decode(&regUser)
+	err := decodeJSON(w, r, &regUser)
 	if err != nil {
-		log.Printf("decoding register user: %s", err)
-		http.Error(w, "bad request", http.StatusBadRequest)
+		problem.Write(w, r, err)
 		return
 	}
+	regUser.Email = utils.NormalizeEmail(regUser.Email)
 
-	if regUser.Email == "" || regUser.Password == "" {
-		log.Printf("empty email or password")
-		http.Error(w, "email or pasword is empty", http.StatusBadRequest)
-		return
-	}
-
-	_, err = uh.ur.GetByEmail(regUser.Email)
-	if err == nil {
-		log.Printf("email used")
-		http.Error(w, "email is already in used", http.StatusBadRequest)
+	err = uh.passwords.Check("password", regUser.Password, regUser.Email)
+	if err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 
+	// hashing before looking the email up makes a taken address answer as
+	// slowly as a free one
 	passwordHash, err := bcrypt.GenerateFromPassword([]byte(regUser.Password), bcrypt.DefaultCost)
 	if err != nil {
-		log.Printf("hashing password: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		problem.Write(w, r, fmt.Errorf("hashing password: %w", err))
 		return
 	}
 
 	newUser := model.User{
 		Email:        regUser.Email,
 		PasswordHash: string(passwordHash),
-		Role:         "user",
-	}
-
-	err = uh.ur.Create(&newUser)
+		Roles:        []string{model.RoleStudent},
+	}
+
+	// the user and its verification email are stored together or not at all,
+	// the owner of a taken address gets a notice instead
+	err = uh.uow.Do(ctx, func(tx repo.Repos) error {
+		existing, err := tx.Users.GetByEmail(ctx, regUser.Email)
+		if err == nil {
+			return uh.queueAccountExists(ctx, tx, existing)
+		}
+		if !errors.Is(err, apperr.ErrNotFound) {
+			return err
+		}
+
+		err = tx.Users.Create(ctx, &newUser)
+		if err != nil {
+			return err
+		}
+		return uh.queueVerification(ctx, tx, &newUser)
+	})
 	if err != nil {
-		log.Printf("creating user in handler: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		problem.Write(w, r, fmt.Errorf("creating user in handler: %w", err))
 		return
 	}
 
-	err = json.NewEncoder(w).Encode(newUser)
+	err = json.NewEncoder(w).Encode(map[string]string{"message": registeredMessage})
 	if err != nil {
-		log.Printf("encoding user: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		problem.Write(w, r, fmt.Errorf("encoding user: %w", err))
 		return
 	}
 }
 
 func (uh UserHandler) LoginUser(w http.ResponseWriter, r *http.Request) {
-	var loginUser model.RegisterUser
-	err := json.NewDecoder(r.Body).Decode(&loginUser)
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	var loginUser model.LoginUser
+	err := decodeJSON(w, r, &loginUser)
 	if err != nil {
-		log.Printf("decoding login user: %s", err)
-		http.Error(w, "bad request", http.StatusBadRequest)
+		problem.Write(w, r, err)
 		return
 	}
 
-	if loginUser.Email == "" || loginUser.Password == "" {
-		log.Printf("empty email or password: %s", err)
-		http.Error(w, "email or pasword is empty", http.StatusBadRequest)
+	user, err := uh.ur.GetByEmail(ctx, utils.NormalizeEmail(loginUser.Email))
+	if errors.Is(err, apperr.ErrNotFound) {
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(loginUser.Password))
+		problem.Write(w, r, errBadCredentials.Wrap(err))
 		return
 	}
-
-	user, err := uh.ur.GetByEmail(loginUser.Email)
 	if err != nil {
-		log.Printf("email not found: %s", err)
-		http.Error(w, "email not found", http.StatusNotFound)
+		problem.Write(w, r, fmt.Errorf("getting user in handler: %w", err))
+		return
+	}
+
+	// a locked account answers like a wrong password, anything else would
+	// tell that the address has an account; its owner learns of the lock by
+	// email
+	if user.IsLocked(time.Now()) {
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(loginUser.Password))
+		problem.Write(w, r, errBadCredentials)
 		return
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(loginUser.Password))
 	if err != nil {
-		log.Printf("password not match: %s", err)
-		http.Error(w, "password doesn't match", http.StatusNotFound)
+		lockErr := uh.recordLoginFailure(ctx, user)
+		if lockErr != nil {
+			problem.Write(w, r, lockErr)
+			return
+		}
+		problem.Write(w, r, errBadCredentials.Wrap(err))
 		return
 	}
 
-	token, err := utils.GenerateToken(32)
-	if err != nil {
-		log.Printf("generating token: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+	if uh.policy.RequireVerifiedEmail && !user.IsVerified {
+		problem.Write(w, r, apperr.Forbidden("email is not verified"))
 		return
 	}
-	tokenHashString := utils.HashToken(token)
 
-	newSession := model.Session{
-		UserID:    user.ID,
-		TokenHash: tokenHashString,
+	// with two-factor login on the password only earns a challenge, failures
+	// are reset once the second step succeeds
+	enrolment, err := uh.tfr.GetTOTP(ctx, user.ID)
+	if err != nil && !errors.Is(err, apperr.ErrNotFound) {
+		problem.Write(w, r, fmt.Errorf("getting totp in handler: %w", err))
+		return
+	}
+	if err == nil && enrolment.IsConfirmed() {
+		challengeToken, err := startChallenge(ctx, uh.lcr, user.ID)
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+		err = json.NewEncoder(w).Encode(map[string]any{
+			"two_factor_required": true,
+			"challenge_token":     challengeToken,
+		})
+		if err != nil {
+			problem.Write(w, r, fmt.Errorf("encoding challenge: %w", err))
+			return
+		}
+		return
 	}
-	err = uh.sr.Create(&newSession)
+
+	if user.FailedLogins > 0 {
+		err = uh.ur.ResetLoginFailures(ctx, user.ID)
+		if err != nil {
+			problem.Write(w, r, fmt.Errorf("resetting login failures: %w", err))
+			return
+		}
+	}
+
+	token, err := startSession(ctx, uh.sr, r, user.ID)
 	if err != nil {
-		log.Printf("creating session: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(map[string]string{"token": token})
 	if err != nil {
-		log.Printf("encoding user: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		problem.Write(w, r, fmt.Errorf("encoding user: %w", err))
 		return
 	}
 }
 
-func (uh UserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
-	userIDString := r.PathValue("userid")
-	userID, err := strconv.Atoi(userIDString)
+// startSession logs a user in and returns the session token
+func startSession(ctx context.Context, sr repo.SessionStore, r *http.Request, userID int) (string, error) {
+	token, err := utils.GenerateToken(32)
 	if err != nil {
-		log.Printf("verifying email, user id not found: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
-		return
+		return "", fmt.Errorf("generating token: %w", err)
 	}
 
-	_, err = uh.ur.GetByID(userID)
+	newSession := model.Session{
+		UserID:    userID,
+		TokenHash: utils.HashToken(token),
+		UserAgent: userAgent(r),
+		IP:        middleware.ByIP(r),
+	}
+	err = sr.Create(ctx, &newSession)
 	if err != nil {
-		log.Printf("user id not found: %s", err)
-		http.Error(w, "user not found", http.StatusNotFound)
-		return
+		return "", fmt.Errorf("creating session: %w", err)
 	}
+	return token, nil
+}
 
-	err = uh.ur.UpdateEmailVerification(userID)
+// recordLoginFailure counts a wrong password against user and locks the
+// account when the login policy says so, telling its owner by email
+func (uh UserHandler) recordLoginFailure(ctx context.Context, user *model.User) error {
+	failures, err := uh.ur.RecordLoginFailure(ctx, user.ID)
 	if err != nil {
-		log.Printf("verifying email: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
-		return
+		return fmt.Errorf("recording login failure: %w", err)
+	}
+	lockout := uh.policy.Lockout(failures)
+	if lockout == 0 {
+		return nil
+	}
+	until := time.Now().Add(lockout)
+	err = uh.uow.Do(ctx, func(tx repo.Repos) error {
+		err := tx.Users.LockUntil(ctx, user.ID, until)
+		if err != nil {
+			return err
+		}
+		return queueLockNotice(ctx, tx, user, failures, until)
+	})
+	if err != nil {
+		return fmt.Errorf("locking user: %w", err)
 	}
+	return nil
+}
 
-	err = json.NewEncoder(w).Encode(map[string]string{"message": "email verification success"})
+// queueLockNotice queues an email in tx telling the owner of user that their
+// account is locked after failures wrong passwords or codes
+func queueLockNotice(ctx context.Context, tx repo.Repos, user *model.User, failures int, until time.Time) error {
+	msg, err := mailer.NotificationMessage(
+		user.Email,
+		"Your account is locked",
+		fmt.Sprintf("Someone failed to log in to your account %d times in a row, so logging in is blocked until %s. "+
+			"If this wasn't you, reset your password once the lock is over.", failures, until.UTC().Format(time.RFC1123)),
+	)
 	if err != nil {
-		log.Printf("encoding user: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
-		return
+		return fmt.Errorf("building lock notice email: %w", err)
+	}
+	email := outbox.FromMessage(msg)
+	err = tx.Outbox.Enqueue(ctx, &email)
+	if err != nil {
+		return fmt.Errorf("queuing lock notice email: %w", err)
 	}
+	return nil
 }
 
-func (uh UserHandler) CheckLoginUser(w http.ResponseWriter, r *http.Request) {
-	var tokenMap map[string]string
-	err := json.NewDecoder(r.Body).Decode(&tokenMap)
+func (uh UserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	var verifyEmail model.VerifyEmail
+	err := decodeJSON(w, r, &verifyEmail)
 	if err != nil {
-		log.Printf("decoding token map: %s", err)
-		http.Error(w, "bad request", http.StatusBadRequest)
+		problem.Write(w, r, err)
 		return
 	}
 
-	if tokenMap["token"] == "" {
-		log.Printf("token map empty")
-		http.Error(w, "bad request", http.StatusBadRequest)
+	tokenHashString := utils.HashToken(verifyEmail.Token)
+
+	verification, err := uh.evr.GetFromTokenHash(ctx, tokenHashString)
+	if errors.Is(err, apperr.ErrNotFound) {
+		err = apperr.Invalid("token", "invalid verification token").Wrap(err)
+	}
+	if err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 
-	tokenHashString := utils.HashToken(tokenMap["token"])
+	expired := time.Now().After(verification.ExpirationTime)
+	if expired {
+		problem.Write(w, r, apperr.Invalid("token", "verification link expired"))
+		return
+	}
 
-	session, err := uh.sr.GetFromTokenHash(tokenHashString)
+	err = uh.ur.UpdateEmailVerification(ctx, verification.UserID)
 	if err != nil {
-		log.Printf("session hash not found: %s", err)
-		http.Error(w, "bad request", http.StatusBadRequest)
+		problem.Write(w, r, fmt.Errorf("verifying email: %w", err))
 		return
 	}
 
-	err = json.NewEncoder(w).Encode(session)
+	err = uh.evr.DeleteByUserID(ctx, verification.UserID)
+	if err != nil {
+		log.Printf("deleting email verification: %s", err)
+	}
+
+	err = json.NewEncoder(w).Encode(map[string]string{"message": "email verification success"})
 	if err != nil {
-		log.Printf("encoding session: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		problem.Write(w, r, fmt.Errorf("encoding user: %w", err))
 		return
 	}
 }
 
-func (uh UserHandler) LogoutUser(w http.ResponseWriter, r *http.Request) {
-	var tokenMap map[string]string
-	err := json.NewDecoder(r.Body).Decode(&tokenMap)
+func (uh UserHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var resend model.ResendVerification
+	err := decodeJSON(w, r, &resend)
 	if err != nil {
-		log.Printf("decoding token map: %s", err)
-		http.Error(w, "bad request", http.StatusBadRequest)
+		problem.Write(w, r, err)
 		return
 	}
 
-	if tokenMap["token"] == "" {
-		log.Printf("token map empty")
-		http.Error(w, "bad request", http.StatusBadRequest)
+	// same answer whether or not the email exists, is verified or was sent
+	// too often, a rate limit error would tell that the account exists
+	response, err := json.Marshal(map[string]string{"message": verificationMessage})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("marshaling data to json: %w", err))
 		return
 	}
 
-	tokenHashString := utils.HashToken(tokenMap["token"])
+	// and as fast, so the lookup and queuing happen after answering
+	uh.background.Add(1)
+	go func() {
+		defer uh.background.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), requestTimeout)
+		defer cancel()
+		err := uh.resendVerification(ctx, utils.NormalizeEmail(resend.Email))
+		if err != nil {
+			log.Printf("queuing verification email: %s", err)
+		}
+	}()
 
-	err = uh.sr.DeleteFromTokenHash(tokenHashString)
+	w.Write(response)
+}
+
+// resendVerification queues a new verification email for the unverified
+// account of email, unless one was sent too recently or too often
+func (uh UserHandler) resendVerification(ctx context.Context, email string) error {
+	user, err := uh.ur.GetByEmail(ctx, email)
+	if errors.Is(err, apperr.ErrNotFound) {
+		return nil
+	}
 	if err != nil {
-		log.Printf("deleting session from handler: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
-		return
+		return err
+	}
+	if user.IsVerified {
+		return nil
 	}
 
-	response, err := json.Marshal(map[string]string{"message": "log out sucessful"})
+	previous, err := uh.evr.GetByUserID(ctx, user.ID)
+	if err == nil {
+		inWindow := time.Since(previous.WindowStartedAt) < repo.VerificationSendWindow
+		if time.Since(previous.LastSentAt) < verificationCooldown || (inWindow && previous.SentCount >= maxVerificationSends) {
+			return nil
+		}
+	}
+
+	return uh.uow.Do(ctx, func(tx repo.Repos) error {
+		return uh.queueVerification(ctx, tx, user)
+	})
+}
+
+// queueVerification stores a fresh verification token for user and queues
+// the email in tx
+func (uh UserHandler) queueVerification(ctx context.Context, tx repo.Repos, user *model.User) error {
+	token, err := utils.GenerateToken(32)
 	if err != nil {
-		log.Printf("marshaling data to json: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
-		return
+		return fmt.Errorf("generating token: %w", err)
 	}
-	w.Write(response)
+
+	verification := model.EmailVerification{
+		UserID:         user.ID,
+		TokenHash:      utils.HashToken(token),
+		ExpirationTime: time.Now().Add(verificationLifetime),
+	}
+	err = tx.EmailVerifications.Upsert(ctx, &verification)
+	if err != nil {
+		return fmt.Errorf("storing email verification: %w", err)
+	}
+
+	link := mailer.TokenLink(uh.baseURL, "/verifyemail", token)
+	msg, err := mailer.VerificationMessage(user.Email, link, verificationLifetime)
+	if err != nil {
+		return fmt.Errorf("building verification email: %w", err)
+	}
+	email := outbox.FromMessage(msg)
+	err = tx.Outbox.Enqueue(ctx, &email)
+	if err != nil {
+		return fmt.Errorf("queuing verification email: %w", err)
+	}
+	return nil
 }
 
-func (uh UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
-	var emailMap map[string]string
-	err := json.NewDecoder(r.Body).Decode(&emailMap)
+func (uh UserHandler) CheckLoginUser(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	var check model.SessionCheck
+	err := decodeJSON(w, r, &check)
 	if err != nil {
-		log.Printf("decoding email map: %s", err)
-		http.Error(w, "bad request", http.StatusBadRequest)
+		problem.Write(w, r, err)
 		return
 	}
 
-	email := emailMap["email"]
-	if email == "" {
-		log.Printf("email map empty")
-		http.Error(w, "bad request", http.StatusBadRequest)
+	tokenHashString := utils.HashToken(check.Token)
+
+	session, err := uh.sr.GetFromTokenHash(ctx, tokenHashString)
+	if errors.Is(err, apperr.ErrNotFound) {
+		err = apperr.Unauthorized("session not found").Wrap(err)
+	}
+	if err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 
-	err = utils.CheckEmailFormat(email)
+	err = json.NewEncoder(w).Encode(session)
 	if err != nil {
-		log.Printf("email not well formatted: %s", err)
-		http.Error(w, "bad request", http.StatusNotFound)
+		problem.Write(w, r, fmt.Errorf("encoding session: %w", err))
 		return
 	}
+}
 
-	user, err := uh.ur.GetByEmail(email)
-	if err != nil {
-		log.Printf("email not found: %s", err)
-		http.Error(w, "email not found", http.StatusNotFound)
+func (uh UserHandler) LogoutUser(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	session, ok := middleware.SessionFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
 		return
 	}
 
-	token, err := utils.GenerateToken(32)
+	err := uh.sr.DeleteFromTokenHash(ctx, session.TokenHash)
 	if err != nil {
-		log.Printf("generating token: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		problem.Write(w, r, fmt.Errorf("deleting session from handler: %w", err))
 		return
 	}
-	tokenHashString := utils.HashToken(token)
 
-	newPasswordReset := model.PasswordReset{
-		UserID:         user.ID,
-		TokenHash:      tokenHashString,
-		ExpirationTime: time.Now().Local().Add(5 * time.Minute),
+	response, err := json.Marshal(map[string]string{"message": "log out sucessful"})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("marshaling data to json: %w", err))
+		return
 	}
-	uh.prr.Create(&newPasswordReset)
+	w.Write(response)
+}
+
+func (uh UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
 
-	// delete previous reset database if any
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		problem.Write(w, r, apperr.Unauthorized("not logged in"))
+		return
+	}
 
-	err = utils.SendPasswordResetEmail(email, token)
+	// the email is queued only if the reset is stored, and sent later by the outbox worker
+	err := uh.uow.Do(ctx, func(tx repo.Repos) error {
+		return uh.queuePasswordReset(ctx, tx, user)
+	})
 	if err != nil {
-		log.Printf("sending email from handler: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		problem.Write(w, r, fmt.Errorf("queuing reset email from handler: %w", err))
 		return
 	}
 
 	response, err := json.Marshal(map[string]string{"message": "reset email sent"})
 	if err != nil {
-		log.Printf("marshaling data to json: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		problem.Write(w, r, fmt.Errorf("marshaling data to json: %w", err))
 		return
 	}
 	w.Write(response)
 }
 
-func (uh UserHandler) UpdatePassword(w http.ResponseWriter, r *http.Request) {
-	var passChange model.PasswordChange
-	err := json.NewDecoder(r.Body).Decode(&passChange)
+// ForgotPassword sends a reset email to an address without logging in, it
+// answers the same whether or not the address has an account. The reset is
+// stored after answering, so a known address doesn't answer slower than an
+// unknown one.
+func (uh UserHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var forgot model.ForgotPassword
+	err := decodeJSON(w, r, &forgot)
 	if err != nil {
-		log.Printf("decoding token: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
 
-	token := passChange.Token
-	if token == "" {
-		log.Printf("empty token")
-		http.Error(w, "internal server error", http.StatusInternalServerError)
-		return
+	response, err := json.Marshal(map[string]string{"message": resetRequestMessage})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("marshaling data to json: %w", err))
+		return
+	}
+
+	uh.background.Add(1)
+	go func() {
+		defer uh.background.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), requestTimeout)
+		defer cancel()
+		err := uh.uow.Do(ctx, func(tx repo.Repos) error {
+			user, err := tx.Users.GetByEmail(ctx, utils.NormalizeEmail(forgot.Email))
+			if errors.Is(err, apperr.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return uh.queuePasswordReset(ctx, tx, user)
+		})
+		if err != nil {
+			log.Printf("queuing reset email: %s", err)
+		}
+	}()
+
+	w.Write(response)
+}
+
+// queuePasswordReset stores a fresh reset token for user and queues the email
+// in tx
+func (uh UserHandler) queuePasswordReset(ctx context.Context, tx repo.Repos, user *model.User) error {
+	token, err := utils.GenerateToken(32)
+	if err != nil {
+		return fmt.Errorf("generating token: %w", err)
 	}
 
-	tokenHashString := utils.HashToken(token)
+	passwordReset := model.PasswordReset{
+		UserID:         user.ID,
+		TokenHash:      utils.HashToken(token),
+		ExpirationTime: time.Now().Local().Add(passwordResetLifetime),
+	}
+	err = tx.PasswordResets.Upsert(ctx, &passwordReset)
+	if err != nil {
+		return fmt.Errorf("storing password reset: %w", err)
+	}
 
-	passResetPtr, err := uh.prr.GetFromTokenHash(tokenHashString)
+	link := mailer.TokenLink(uh.baseURL, "/resetpassword", token)
+	msg, err := mailer.PasswordResetMessage(user.Email, link, passwordResetLifetime)
 	if err != nil {
-		log.Printf("getting password reset from handler: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
-		return
+		return fmt.Errorf("building reset email: %w", err)
 	}
+	email := outbox.FromMessage(msg)
+	err = tx.Outbox.Enqueue(ctx, &email)
+	if err != nil {
+		return fmt.Errorf("queuing reset email: %w", err)
+	}
+	return nil
+}
 
-	// check expiration date
-	expired := time.Now().After(passResetPtr.ExpirationTime)
-	if expired {
-		log.Printf("password reset expired")
-		http.Error(w, "password reset link expired", http.StatusInternalServerError)
-		return
+// queueAccountExists queues an email in tx telling the owner of user that
+// someone tried to sign up with their address, at most as often as
+// accountExistsLimit allows so sign ups can't flood their inbox
+func (uh UserHandler) queueAccountExists(ctx context.Context, tx repo.Repos, user *model.User) error {
+	allowed, _, err := tx.RateLimits.Take(ctx, "account-exists:"+user.Email, accountExistsLimit)
+	if err != nil || !allowed {
+		return err
 	}
 
-	// check if new password is the same as the old one
+	msg, err := mailer.NotificationMessage(
+		user.Email,
+		"Someone tried to sign up with your email",
+		"An account with this email already exists. If this was you, log in or reset your password. Otherwise you can ignore this email.",
+	)
+	if err != nil {
+		return fmt.Errorf("building account exists email: %w", err)
+	}
+	email := outbox.FromMessage(msg)
+	err = tx.Outbox.Enqueue(ctx, &email)
+	if err != nil {
+		return fmt.Errorf("queuing account exists email: %w", err)
+	}
+	return nil
+}
 
-	user, err := uh.ur.GetByID(passResetPtr.UserID)
+func (uh UserHandler) UpdatePassword(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+
+	var passChange model.PasswordChange
+	err := decodeJSON(w, r, &passChange)
 	if err != nil {
-		log.Printf("getting user from handler: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
 
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(passChange.NewPassword), bcrypt.DefaultCost)
+	tokenHashString := utils.HashToken(passChange.Token)
+
+	// bcrypt refuses a password over 72 bytes, so the policy is checked before
+	// hashing; the rule against the email address needs the account and is
+	// checked again once the token is consumed
+	err = uh.passwords.Check("new_password", passChange.NewPassword, "")
 	if err != nil {
-		log.Printf("hashing password: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		problem.Write(w, r, err)
 		return
 	}
 
-	err = uh.ur.UpdatePassword(user.ID, string(passwordHash))
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(passChange.NewPassword), bcrypt.DefaultCost)
 	if err != nil {
-		log.Printf("updating user password: %s", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		problem.Write(w, r, fmt.Errorf("hashing password: %w", err))
+		return
+	}
+
+	// consuming the token, changing the password and logging out every session
+	// happen together, so a token can never be used twice
+	err = uh.uow.Do(ctx, func(tx repo.Repos) error {
+		passResetPtr, err := tx.PasswordResets.Consume(ctx, tokenHashString)
+		if errors.Is(err, apperr.ErrNotFound) {
+			return errResetInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		expired := time.Now().After(passResetPtr.ExpirationTime)
+		if expired {
+			return errResetExpired
+		}
+
+		user, err := tx.Users.GetByID(ctx, passResetPtr.UserID)
+		if err != nil {
+			return err
+		}
+
+		err = uh.passwords.Check("new_password", passChange.NewPassword, user.Email)
+		if err != nil {
+			return err
+		}
+
+		err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(passChange.NewPassword))
+		if err == nil {
+			return errSamePassword
+		}
+
+		err = tx.Users.UpdatePassword(ctx, user.ID, string(passwordHash))
+		if err != nil {
+			return err
+		}
+		return tx.Sessions.DeleteByUserID(ctx, user.ID)
+	})
+	if err != nil {
+		problem.Write(w, r, fmt.Errorf("updating password: %w", err))
 		return
 	}
 
-	// delete reset database
-
 	response, _ := json.Marshal(map[string]string{"message": "password changed success"})
 	w.Write(response)
 }
@@ -0,0 +1,648 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/config"
+	"github.com/suryasaputra2016/course/backend/handler"
+	"github.com/suryasaputra2016/course/backend/middleware"
+	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/password"
+	"github.com/suryasaputra2016/course/backend/problem"
+	"github.com/suryasaputra2016/course/backend/repo/memory"
+	"github.com/suryasaputra2016/course/backend/totp"
+	"github.com/suryasaputra2016/course/backend/webauthn"
+)
+
+const testBaseURL = "http://course.test"
+
+var testRelyingParty = webauthn.RelyingParty{ID: "course.test", Name: "Course", Origins: []string{testBaseURL}}
+
+// testApp wires the user handler to an in-memory database the way main does
+type testApp struct {
+	t       *testing.T
+	db      *memory.DB
+	handler http.Handler
+	// wait lets the work handlers do after answering finish
+	wait func()
+}
+
+func newTestApp(t *testing.T, policy config.LoginPolicy) *testApp {
+	t.Helper()
+	db := memory.New()
+	r := db.Repos()
+	breached, err := password.LoadBundled()
+	if err != nil {
+		t.Fatalf("loading breached passwords: %s", err)
+	}
+	passwords := password.NewChecker(config.PasswordPolicy{MinLength: 8, MaxBytes: 72, MinClasses: 2, RejectBreached: true}, breached)
+	uh := handler.NewUserHandler(r.Users, r.Sessions, r.PasswordResets, r.EmailVerifications, r.TwoFactor, r.LoginChallenges, db, policy, passwords, testBaseURL)
+	ph := handler.NewPasskeyHandler(r.Passkeys, r.PasskeyChallenges, r.Users, r.Sessions, testRelyingParty, policy)
+	qh := handler.NewQuestionHandler(r.Questions, r.Roles)
+	sbh := handler.NewSubmissionHandler(r.Submissions, r.Questions, db)
+	rh := handler.NewRoleHandler(r.Roles, r.Users, db)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /register", uh.RegisterUser)
+	mux.HandleFunc("POST /login", uh.LoginUser)
+	mux.HandleFunc("POST /login/2fa", uh.LoginSecondFactor)
+	mux.HandleFunc("POST /login/passkey/begin", ph.BeginLogin)
+	mux.HandleFunc("POST /login/passkey/finish", ph.FinishLogin)
+	mux.HandleFunc("PUT /verifyemail", uh.VerifyEmail)
+	mux.HandleFunc("POST /forgotpassword", uh.ForgotPassword)
+	mux.HandleFunc("POST /resendverification", uh.ResendVerification)
+	mux.HandleFunc("PUT /updatepassword", uh.UpdatePassword)
+
+	accountMux := http.NewServeMux()
+	accountMux.HandleFunc("DELETE /logout", uh.LogoutUser)
+	accountMux.HandleFunc("GET /sessions", uh.ListSessions)
+	accountMux.HandleFunc("DELETE /sessions/{sessionid}", uh.RevokeSession)
+	accountMux.HandleFunc("DELETE /sessions/others", uh.RevokeOtherSessions)
+	accountMux.HandleFunc("POST /resetpassword", uh.ResetPassword)
+	accountMux.HandleFunc("POST /2fa/totp", uh.EnrollTOTP)
+	accountMux.HandleFunc("GET /2fa/totp/qr", uh.TOTPQRCode)
+	accountMux.HandleFunc("POST /2fa/totp/confirm", uh.ConfirmTOTP)
+	accountMux.HandleFunc("DELETE /2fa/totp", uh.DisableTOTP)
+	accountMux.HandleFunc("POST /passkeys/register/begin", ph.BeginRegistration)
+	accountMux.HandleFunc("POST /passkeys/register/finish", ph.FinishRegistration)
+	accountMux.HandleFunc("GET /passkeys", ph.ListPasskeys)
+	accountMux.HandleFunc("PUT /passkeys/{passkeyid}", ph.RenamePasskey)
+	accountMux.HandleFunc("DELETE /passkeys/{passkeyid}", ph.DeletePasskey)
+	accountMux.HandleFunc("GET /questions", qh.ListQuestions)
+	accountMux.HandleFunc("POST /questions", qh.CreateQuestion)
+	accountMux.HandleFunc("DELETE /questions/{questionid}", qh.DeleteQuestion)
+	accountMux.HandleFunc("POST /questions/{questionid}/submissions", sbh.SubmitAnswer)
+	accountMux.HandleFunc("GET /submissions", sbh.ListSubmissions)
+	accountMux.HandleFunc("POST /admin/roles/{userid}", rh.GrantRole)
+	accountMux.HandleFunc("DELETE /admin/roles/{userid}", rh.RevokeRole)
+	auth := middleware.NewAuthMid(r.Sessions, r.Users)
+	mux.Handle("/dashboard/", http.StripPrefix("/dashboard", auth.Authorize(accountMux)))
+
+	return &testApp{t: t, db: db, handler: mux, wait: uh.Wait}
+}
+
+// do sends body as JSON, with token as the session cookie when it is not empty
+func (app *testApp) do(method, path, token string, body any) *httptest.ResponseRecorder {
+	app.t.Helper()
+	var reader *strings.Reader
+	if body == nil {
+		reader = strings.NewReader("")
+	} else {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			app.t.Fatalf("encoding request body: %s", err)
+		}
+		reader = strings.NewReader(string(encoded))
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if token != "" {
+		req.AddCookie(&http.Cookie{Name: "token", Value: token})
+	}
+	rec := httptest.NewRecorder()
+	app.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func (app *testApp) register(email, password string) model.User {
+	app.t.Helper()
+	rec := app.do("POST", "/register", "", model.RegisterUser{Email: email, Password: password})
+	if rec.Code != http.StatusOK {
+		app.t.Fatalf("register %s: status %d, body %q", email, rec.Code, rec.Body)
+	}
+	user, err := app.db.Repos().Users.GetByEmail(context.Background(), email)
+	if err != nil {
+		app.t.Fatalf("getting registered user: %s", err)
+	}
+	return *user
+}
+
+func (app *testApp) login(email, password string) string {
+	app.t.Helper()
+	rec := app.do("POST", "/login", "", model.RegisterUser{Email: email, Password: password})
+	if rec.Code != http.StatusOK {
+		app.t.Fatalf("login %s: status %d, body %q", email, rec.Code, rec.Body)
+	}
+	var body map[string]string
+	err := json.NewDecoder(rec.Body).Decode(&body)
+	if err != nil {
+		app.t.Fatalf("decoding login token: %s", err)
+	}
+	return body["token"]
+}
+
+var linkRe = regexp.MustCompile(regexp.QuoteMeta(testBaseURL) + `\S+`)
+
+// lastToken returns the token of the newest queued email to address whose link has path
+func (app *testApp) lastToken(address, path string) string {
+	app.t.Helper()
+	app.wait()
+	emails, err := app.db.Repos().Outbox.List(context.Background(), model.OutboxStatusPending, 100, 0)
+	if err != nil {
+		app.t.Fatalf("listing outbox: %s", err)
+	}
+	for _, email := range emails {
+		if email.ToAddress != address {
+			continue
+		}
+		link, err := url.Parse(linkRe.FindString(email.TextBody))
+		if err == nil && link.Path == path {
+			return link.Query().Get("token")
+		}
+	}
+	app.t.Fatalf("no email to %s with a %s link", address, path)
+	return ""
+}
+
+func TestRegisterDoesNotRevealTakenEmail(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+	user := app.register("ada@example.com", "first-password")
+	if !user.HasRole(model.RoleStudent) {
+		t.Errorf("new user roles = %v, want student", user.Roles)
+	}
+
+	fresh := app.do("POST", "/register", "", model.RegisterUser{Email: "bob@example.com", Password: "other-password"})
+	taken := app.do("POST", "/register", "", model.RegisterUser{Email: "ada@example.com", Password: "other-password"})
+	if taken.Code != fresh.Code || taken.Body.String() != fresh.Body.String() {
+		t.Errorf("taken email answered %d %q, free one %d %q", taken.Code, taken.Body, fresh.Code, fresh.Body)
+	}
+
+	// the account keeps its password and its owner is told by email, once
+	// however often someone tries
+	app.login("ada@example.com", "first-password")
+	app.do("POST", "/register", "", model.RegisterUser{Email: "ada@example.com", Password: "third-password"})
+	if app.outboxCount("ada@example.com") != 2 {
+		t.Errorf("emails to ada = %d, want a verification and a sign up notice", app.outboxCount("ada@example.com"))
+	}
+}
+
+func (app *testApp) outboxCount(address string) int {
+	app.t.Helper()
+	app.wait()
+	emails, err := app.db.Repos().Outbox.List(context.Background(), model.OutboxStatusPending, 100, 0)
+	if err != nil {
+		app.t.Fatalf("listing outbox: %s", err)
+	}
+	count := 0
+	for _, email := range emails {
+		if email.ToAddress == address {
+			count++
+		}
+	}
+	return count
+}
+
+func TestLogin(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+	app.register("ada@example.com", "first-password")
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		want     int
+	}{
+		{"correct password", "ada@example.com", "first-password", http.StatusOK},
+		{"wrong password", "ada@example.com", "wrong-password", http.StatusUnauthorized},
+		{"email in other case", " Ada@Example.COM", "first-password", http.StatusOK},
+		{"unknown email", "bob@example.com", "first-password", http.StatusUnauthorized},
+		{"empty password", "ada@example.com", "", http.StatusBadRequest},
+		{"password over 72 bytes", "ada@example.com", "first-password" + strings.Repeat("x", 59), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := app.do("POST", "/login", "", model.RegisterUser{Email: tt.email, Password: tt.password})
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginRefusesWhatBcryptWouldCut(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+	// 72 bytes in 38 characters, bcrypt sees all of it
+	password := strings.Repeat("äö", 17) + "Ab12"
+	app.register("ada@example.com", password)
+	app.login("ada@example.com", password)
+
+	// 46 characters pass a limit of 72 characters, bcrypt would only compare
+	// the first 72 bytes and let them in
+	rec := app.do("POST", "/login", "", model.LoginUser{Email: "ada@example.com", Password: password + "anything"})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("login with a password over 72 bytes status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestLoginRequiresVerifiedEmail(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{RequireVerifiedEmail: true})
+	app.register("ada@example.com", "first-password")
+
+	rec := app.do("POST", "/login", "", model.RegisterUser{Email: "ada@example.com", Password: "first-password"})
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("unverified login status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	token := app.lastToken("ada@example.com", "/verifyemail")
+	rec = app.do("PUT", "/verifyemail", "", model.VerifyEmail{Token: token})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("verify status = %d, body %q", rec.Code, rec.Body)
+	}
+	app.login("ada@example.com", "first-password")
+
+	rec = app.do("PUT", "/verifyemail", "", model.VerifyEmail{Token: token})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("reused verification status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+	app.register("ada@example.com", "first-password")
+	token := app.login("ada@example.com", "first-password")
+
+	rec := app.do("DELETE", "/dashboard/logout", token, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("logout status = %d, body %q", rec.Code, rec.Body)
+	}
+	rec = app.do("DELETE", "/dashboard/logout", token, nil)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("logout with ended session status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+	app.register("ada@example.com", "first-password")
+	session := app.login("ada@example.com", "first-password")
+
+	rec := app.do("POST", "/dashboard/resetpassword", session, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reset status = %d, body %q", rec.Code, rec.Body)
+	}
+	resetToken := app.lastToken("ada@example.com", "/resetpassword")
+
+	rec = app.do("PUT", "/updatepassword", "", model.PasswordChange{Token: resetToken, NewPassword: "first-password"})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("same password status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	// bcrypt can't hash more than 72 bytes, the policy rejects it first
+	tooLong := strings.Repeat("long-password-", 6)
+	rec = app.do("PUT", "/updatepassword", "", model.PasswordChange{Token: resetToken, NewPassword: tooLong})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "new_password") {
+		t.Errorf("password of %d bytes: status %d, body %q, want %d on new_password", len(tooLong), rec.Code, rec.Body, http.StatusBadRequest)
+	}
+	// the failed attempts rolled back, so the token was not consumed
+	rec = app.do("PUT", "/updatepassword", "", model.PasswordChange{Token: resetToken, NewPassword: "second-password"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update password status = %d, body %q", rec.Code, rec.Body)
+	}
+	rec = app.do("PUT", "/updatepassword", "", model.PasswordChange{Token: resetToken, NewPassword: "third-password"})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("reused token status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	rec = app.do("DELETE", "/dashboard/logout", session, nil)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("old session after reset status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	rec = app.do("POST", "/login", "", model.RegisterUser{Email: "ada@example.com", Password: "first-password"})
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("login with old password status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	app.login("ada@example.com", "second-password")
+}
+
+func TestForgotPassword(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+	app.register("ada@example.com", "first-password")
+
+	known := app.do("POST", "/forgotpassword", "", model.ForgotPassword{Email: "ada@example.com"})
+	unknown := app.do("POST", "/forgotpassword", "", model.ForgotPassword{Email: "bob@example.com"})
+	if known.Code != http.StatusOK || unknown.Code != known.Code || unknown.Body.String() != known.Body.String() {
+		t.Errorf("known email answered %d %q, unknown one %d %q", known.Code, known.Body, unknown.Code, unknown.Body)
+	}
+	if app.outboxCount("bob@example.com") != 0 {
+		t.Errorf("emails to unknown address = %d, want 0", app.outboxCount("bob@example.com"))
+	}
+
+	resetToken := app.lastToken("ada@example.com", "/resetpassword")
+	rec := app.do("PUT", "/updatepassword", "", model.PasswordChange{Token: resetToken, NewPassword: "second-password"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update password status = %d, body %q", rec.Code, rec.Body)
+	}
+	app.login("ada@example.com", "second-password")
+}
+
+func TestResendVerification(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+	// stored without the verification email registering sends, so nothing
+	// holds the resend back
+	user := model.User{Email: "ada@example.com", Roles: []string{model.RoleStudent}}
+	err := app.db.Repos().Users.Create(context.Background(), &user)
+	if err != nil {
+		t.Fatalf("creating user: %s", err)
+	}
+
+	unverified := app.do("POST", "/resendverification", "", model.ResendVerification{Email: "Ada@example.com"})
+	unknown := app.do("POST", "/resendverification", "", model.ResendVerification{Email: "bob@example.com"})
+	if unverified.Code != http.StatusOK || unknown.Code != unverified.Code || unknown.Body.String() != unverified.Body.String() {
+		t.Errorf("unverified email answered %d %q, unknown one %d %q", unverified.Code, unverified.Body, unknown.Code, unknown.Body)
+	}
+	if app.outboxCount("ada@example.com") != 1 || app.outboxCount("bob@example.com") != 0 {
+		t.Errorf("emails to ada, bob = %d, %d, want 1, 0", app.outboxCount("ada@example.com"), app.outboxCount("bob@example.com"))
+	}
+
+	rec := app.do("PUT", "/verifyemail", "", model.VerifyEmail{Token: app.lastToken("ada@example.com", "/verifyemail")})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("verify status = %d, body %q", rec.Code, rec.Body)
+	}
+}
+
+func TestDeleteQuestionRemovesSubmissions(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+	author := app.register("ada@example.com", "first-password")
+	err := app.db.Repos().Roles.Grant(context.Background(), author.ID, model.RoleAuthor, author.ID)
+	if err != nil {
+		t.Fatalf("granting author role: %s", err)
+	}
+	app.register("bob@example.com", "second-password")
+	authorSession := app.login("ada@example.com", "first-password")
+	studentSession := app.login("bob@example.com", "second-password")
+
+	rec := app.do("POST", "/dashboard/questions", authorSession, model.QuestionInput{
+		Title:      "Free fall",
+		Statement:  "How far does a stone fall in 2 s?",
+		Topic:      "kinematics",
+		Difficulty: 1,
+		AnswerSpec: &model.AnswerSpec{Value: 19.6, Unit: "m"},
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create question status = %d, body %q", rec.Code, rec.Body)
+	}
+	var question model.Question
+	err = json.NewDecoder(rec.Body).Decode(&question)
+	if err != nil {
+		t.Fatalf("decoding question: %s", err)
+	}
+	questionPath := "/dashboard/questions/" + strconv.Itoa(question.ID)
+
+	rec = app.do("POST", questionPath+"/submissions", studentSession, model.SubmissionInput{Answer: "19.6 m"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("submit status = %d, body %q", rec.Code, rec.Body)
+	}
+	if got := app.submissionCount(studentSession); got != 1 {
+		t.Fatalf("submissions before delete = %d, want 1", got)
+	}
+
+	rec = app.do("DELETE", questionPath, authorSession, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("delete question status = %d, body %q", rec.Code, rec.Body)
+	}
+	if got := app.submissionCount(studentSession); got != 0 {
+		t.Errorf("submissions after delete = %d, want 0", got)
+	}
+}
+
+func (app *testApp) submissionCount(session string) int {
+	app.t.Helper()
+	rec := app.do("GET", "/dashboard/submissions", session, nil)
+	if rec.Code != http.StatusOK {
+		app.t.Fatalf("list submissions status = %d, body %q", rec.Code, rec.Body)
+	}
+	var submissions []model.StudentSubmission
+	err := json.NewDecoder(rec.Body).Decode(&submissions)
+	if err != nil {
+		app.t.Fatalf("decoding submissions: %s", err)
+	}
+	return len(submissions)
+}
+
+func TestErrorsAreProblemDetails(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+
+	req := httptest.NewRequest("PUT", "/updatepassword", strings.NewReader("{not json"))
+	rec := httptest.NewRecorder()
+	app.handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("malformed body status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	rec = app.do("PUT", "/updatepassword", "", model.PasswordChange{})
+	if got := rec.Header().Get("Content-Type"); got != "application/problem+json" {
+		t.Errorf("content type = %q, want application/problem+json", got)
+	}
+	var p problem.Problem
+	err := json.NewDecoder(rec.Body).Decode(&p)
+	if err != nil {
+		t.Fatalf("decoding problem: %s", err)
+	}
+	if p.Status != http.StatusBadRequest || p.Instance != "/updatepassword" {
+		t.Errorf("problem = %+v, want status 400 for /updatepassword", p)
+	}
+	fields := map[string]bool{}
+	for _, f := range p.Errors {
+		fields[f.Field] = true
+	}
+	if !fields["token"] || !fields["new_password"] {
+		t.Errorf("problem fields = %+v, want token and new_password", p.Errors)
+	}
+}
+
+func TestRequestValidation(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+
+	tests := []struct {
+		name   string
+		body   string
+		fields []string
+	}{
+		{"every invalid field", `{"email":"not-an-email","password":""}`, []string{"email", "password"}},
+		{"unknown field", `{"email":"a@example.com","password":"long enough","admin":true}`, []string{"admin"}},
+		{"wrong type", `{"email":"a@example.com","password":12345678}`, []string{"password"}},
+		{"breached password", `{"email":"a@example.com","password":"password123"}`, []string{"password"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/register", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			app.handler.ServeHTTP(rec, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+
+			var p problem.Problem
+			err := json.NewDecoder(rec.Body).Decode(&p)
+			if err != nil {
+				t.Fatalf("decoding problem: %s", err)
+			}
+			var fields []string
+			for _, f := range p.Errors {
+				fields = append(fields, f.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.fields, ",") {
+				t.Errorf("problem fields = %+v, want %v", p.Errors, tt.fields)
+			}
+		})
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{LockoutThreshold: 3, LockoutBase: time.Minute, LockoutMax: time.Hour})
+	app.register("ada@example.com", "first-password")
+
+	wrong := model.RegisterUser{Email: "ada@example.com", Password: "wrong-password"}
+	for range 2 {
+		app.do("POST", "/login", "", wrong)
+	}
+	// a successful login starts the count again
+	app.login("ada@example.com", "first-password")
+	for i := range 3 {
+		rec := app.do("POST", "/login", "", wrong)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong password %d status = %d, want %d", i+1, rec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// the lock shows nowhere but in an email to the owner, to anyone else a
+	// locked account answers like an address without one
+	locked := app.do("POST", "/login", "", model.RegisterUser{Email: "ada@example.com", Password: "first-password"})
+	unknown := app.do("POST", "/login", "", model.RegisterUser{Email: "bob@example.com", Password: "first-password"})
+	if locked.Code != http.StatusUnauthorized {
+		t.Fatalf("locked login status = %d, want %d", locked.Code, http.StatusUnauthorized)
+	}
+	if locked.Code != unknown.Code || locked.Body.String() != unknown.Body.String() {
+		t.Errorf("locked account answered %d %q, unknown one %d %q", locked.Code, locked.Body, unknown.Code, unknown.Body)
+	}
+	for name, values := range locked.Header() {
+		if got := unknown.Header().Values(name); strings.Join(got, ",") != strings.Join(values, ",") {
+			t.Errorf("locked account header %s = %q, unknown one %q", name, values, got)
+		}
+	}
+	if app.outboxCount("ada@example.com") != 2 {
+		t.Errorf("emails to ada = %d, want a verification and a lock notice", app.outboxCount("ada@example.com"))
+	}
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+	app.register("ada@example.com", "first-password")
+	session := app.login("ada@example.com", "first-password")
+
+	rec := app.do("POST", "/dashboard/2fa/totp", session, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("enrol status = %d, body %q", rec.Code, rec.Body)
+	}
+	var enrolment model.TOTPEnrolment
+	json.NewDecoder(rec.Body).Decode(&enrolment)
+	if !strings.HasPrefix(enrolment.URI, "otpauth://totp/") {
+		t.Errorf("enrolment URI = %q, want an otpauth URI", enrolment.URI)
+	}
+	rec = app.do("GET", "/dashboard/2fa/totp/qr", session, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("qr code status = %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	// logins don't ask for a code until the enrolment is confirmed
+	app.login("ada@example.com", "first-password")
+	step := totp.Step(time.Now())
+	code, _ := totp.Code(enrolment.Secret, step)
+	rec = app.do("POST", "/dashboard/2fa/totp/confirm", session, model.TOTPCode{Code: code})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("confirm status = %d, body %q", rec.Code, rec.Body)
+	}
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	json.NewDecoder(rec.Body).Decode(&confirmed)
+	if len(confirmed.RecoveryCodes) != 10 {
+		t.Fatalf("got %d recovery codes, want 10", len(confirmed.RecoveryCodes))
+	}
+
+	challenge := app.challenge("ada@example.com", "first-password")
+	rec = app.do("POST", "/login/2fa", "", model.LoginSecondFactor{ChallengeToken: challenge, Code: code})
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("replayed code status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	next, _ := totp.Code(enrolment.Secret, step+1)
+	rec = app.do("POST", "/login/2fa", "", model.LoginSecondFactor{ChallengeToken: challenge, Code: next})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("second factor status = %d, body %q", rec.Code, rec.Body)
+	}
+	rec = app.do("POST", "/login/2fa", "", model.LoginSecondFactor{ChallengeToken: challenge, Code: next})
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("reused challenge status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	// a recovery code works once, however it is typed
+	recovery := strings.ToUpper(strings.ReplaceAll(confirmed.RecoveryCodes[0], "-", " "))
+	rec = app.do("POST", "/login/2fa", "", model.LoginSecondFactor{
+		ChallengeToken: app.challenge("ada@example.com", "first-password"),
+		RecoveryCode:   recovery,
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("recovery code status = %d, body %q", rec.Code, rec.Body)
+	}
+	rec = app.do("POST", "/login/2fa", "", model.LoginSecondFactor{
+		ChallengeToken: app.challenge("ada@example.com", "first-password"),
+		RecoveryCode:   confirmed.RecoveryCodes[0],
+	})
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("used recovery code status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestTwoFactorChallengeAttempts(t *testing.T) {
+	app := newTestApp(t, config.LoginPolicy{})
+	app.register("ada@example.com", "first-password")
+	user, _ := app.db.Repos().Users.GetByEmail(context.Background(), "ada@example.com")
+	app.enableTOTP(user.ID)
+
+	challenge := app.challenge("ada@example.com", "first-password")
+	for range 5 {
+		app.do("POST", "/login/2fa", "", model.LoginSecondFactor{ChallengeToken: challenge, Code: "000000"})
+	}
+	rec := app.do("POST", "/login/2fa", "", model.LoginSecondFactor{ChallengeToken: challenge, RecoveryCode: "aaaa-aaaa-aaaa-aaaa"})
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "log in again") {
+		t.Errorf("challenge after 5 wrong codes: status %d, body %q", rec.Code, rec.Body)
+	}
+}
+
+// challenge logs in with the password and returns the second factor challenge token
+func (app *testApp) challenge(email, password string) string {
+	app.t.Helper()
+	rec := app.do("POST", "/login", "", model.LoginUser{Email: email, Password: password})
+	var body struct {
+		TwoFactorRequired bool   `json:"two_factor_required"`
+		ChallengeToken    string `json:"challenge_token"`
+	}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusOK || !body.TwoFactorRequired || body.ChallengeToken == "" {
+		app.t.Fatalf("login %s: status %d, want a two-factor challenge", email, rec.Code)
+	}
+	return body.ChallengeToken
+}
+
+// enableTOTP turns two-factor login on for userID directly in the database
+func (app *testApp) enableTOTP(userID int) string {
+	app.t.Helper()
+	ctx := context.Background()
+	secret, _ := totp.NewSecret()
+	r := app.db.Repos()
+	err := r.TwoFactor.UpsertTOTP(ctx, &model.TOTP{UserID: userID, Secret: secret})
+	if err == nil {
+		err = r.TwoFactor.ConfirmTOTP(ctx, userID, 0)
+	}
+	if err != nil {
+		app.t.Fatalf("enabling totp: %s", err)
+	}
+	return secret
+}
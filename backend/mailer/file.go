@@ -0,0 +1,36 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileMailer drops every message as an .eml file in a directory, for development
+type FileMailer struct {
+	dir string
+}
+
+func NewFileMailer(dir string) (*FileMailer, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("creating outbox directory: %w", err)
+	}
+	return &FileMailer{dir: dir}, nil
+}
+
+func (fm FileMailer) Send(msg Message) error {
+	body, err := msg.Bytes()
+	if err != nil {
+		return fmt.Errorf("encoding message: %w", err)
+	}
+	recipient := strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To.Address)
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000000000"), recipient)
+	err = os.WriteFile(filepath.Join(fm.dir, name), body, 0o644)
+	if err != nil {
+		return fmt.Errorf("writing message file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Mailer delivers a message, implementations decide where it goes
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Message is an email with a plain text and an html alternative
+type Message struct {
+	From    mail.Address
+	To      mail.Address
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// FromEnv picks the transport named by MAIL_TRANSPORT: smtp (default), file or memory
+func FromEnv() (Mailer, error) {
+	godotenv.Load()
+	switch transport := os.Getenv("MAIL_TRANSPORT"); transport {
+	case "", "smtp":
+		return NewSMTPMailer(SMTPConfig{
+			Username: os.Getenv("USERNAME"),
+			Password: os.Getenv("PASSWORD"),
+			Host:     os.Getenv("HOST"),
+			Address:  os.Getenv("ADDRESS"),
+		}), nil
+	case "file":
+		dir := os.Getenv("MAIL_OUTBOX_DIR")
+		if dir == "" {
+			dir = "outbox"
+		}
+		return NewFileMailer(dir)
+	case "memory":
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport %q", transport)
+	}
+}
+
+// DefaultFrom is the sender address, MAIL_FROM overrides it
+func DefaultFrom() mail.Address {
+	godotenv.Load()
+	address := os.Getenv("MAIL_FROM")
+	if address == "" {
+		address = "admin@course.com"
+	}
+	return mail.Address{Name: "Course", Address: address}
+}
+
+// Bytes encodes msg as a multipart/alternative MIME message
+func (msg Message) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	headers := []struct{ key, value string }{
+		{"From", msg.From.String()},
+		{"To", msg.To.String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", messageID(msg.From.Address)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + writer.Boundary()},
+	}
+	for _, h := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", h.key, h.value)
+	}
+	buf.WriteString("\r\n")
+
+	parts := []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	}
+	for _, part := range parts {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		partWriter, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, fmt.Errorf("creating message part: %w", err)
+		}
+		qp := quotedprintable.NewWriter(partWriter)
+		_, err = qp.Write([]byte(part.body))
+		if err != nil {
+			return nil, fmt.Errorf("writing message part: %w", err)
+		}
+		err = qp.Close()
+		if err != nil {
+			return nil, fmt.Errorf("closing message part: %w", err)
+		}
+	}
+
+	err := writer.Close()
+	if err != nil {
+		return nil, fmt.Errorf("closing message: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func messageID(from string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = from[i+1:]
+	}
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
@@ -0,0 +1,228 @@
+package mailer
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+// part is one decoded alternative of a message
+type part struct {
+	contentType string
+	body        string
+}
+
+// parse reads msg back the way a mail client would
+func parse(t *testing.T, msg Message) (mail.Header, []part) {
+	t.Helper()
+	raw, err := msg.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes = %v", err)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("reading message: %s", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type = %q, %v, want multipart/alternative", parsed.Header.Get("Content-Type"), err)
+	}
+
+	var parts []part
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	for {
+		p, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading part: %s", err)
+		}
+		// the reader decodes quoted-printable and drops the header when it does
+		if encoding := p.Header.Get("Content-Transfer-Encoding"); encoding != "" {
+			t.Errorf("part left %s encoded", encoding)
+		}
+		body, err := io.ReadAll(p)
+		if err != nil {
+			t.Fatalf("reading part body: %s", err)
+		}
+		parts = append(parts, part{p.Header.Get("Content-Type"), string(body)})
+	}
+	return parsed.Header, parts
+}
+
+func TestMessageBytes(t *testing.T) {
+	// long enough for quoted-printable to wrap it, with = that it must escape
+	long := strings.Repeat("a=b ", 40) + "end"
+	msg := Message{
+		From:    mail.Address{Name: "Course", Address: "admin@course.com"},
+		To:      mail.Address{Address: "ada@example.com"},
+		Subject: "Reset your password",
+		Text:    "Open the link.\n" + long,
+		HTML:    "<p>Open the link.</p>",
+	}
+	header, parts := parse(t, msg)
+
+	if from, err := header.AddressList("From"); err != nil || len(from) != 1 || *from[0] != msg.From {
+		t.Errorf("From = %v, %v, want %v", from, err, msg.From)
+	}
+	if to, err := header.AddressList("To"); err != nil || len(to) != 1 || to[0].Address != "ada@example.com" {
+		t.Errorf("To = %v, %v, want ada@example.com", to, err)
+	}
+	if header.Get("Subject") != msg.Subject {
+		t.Errorf("Subject = %q, want %q", header.Get("Subject"), msg.Subject)
+	}
+	if date, err := header.Date(); err != nil || time.Since(date) > time.Minute {
+		t.Errorf("Date = %v, %v, want about now", date, err)
+	}
+	if id := header.Get("Message-ID"); !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@course.com>") {
+		t.Errorf("Message-ID = %q, want one at the sender's domain", id)
+	}
+	if header.Get("MIME-Version") != "1.0" {
+		t.Errorf("MIME-Version = %q, want 1.0", header.Get("MIME-Version"))
+	}
+
+	// line breaks go out as CRLF, as SMTP wants them
+	want := []part{
+		{"text/plain; charset=utf-8", strings.ReplaceAll(msg.Text, "\n", "\r\n")},
+		{"text/html; charset=utf-8", msg.HTML},
+	}
+	if len(parts) != len(want) {
+		t.Fatalf("parts = %+v, want text and html", parts)
+	}
+	for i := range want {
+		if parts[i] != want[i] {
+			t.Errorf("part %d = %+v, want %+v", i, parts[i], want[i])
+		}
+	}
+}
+
+func TestMessageBytesNonASCII(t *testing.T) {
+	msg := Message{
+		From:    mail.Address{Name: "Kursus Fisika", Address: "admin@course.com"},
+		To:      mail.Address{Name: "Ádám Ö", Address: "adam@example.com"},
+		Subject: "Atur ulang kata sandi — ünïcödé ✓",
+		Text:    "Grüße, ½ m/s² → 9,81 m/s²",
+		HTML:    "<p>Grüße, ½ m/s² → 9,81 m/s²</p>",
+	}
+	raw, err := msg.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes = %v", err)
+	}
+	for i, b := range raw {
+		if b > 127 {
+			t.Fatalf("byte %d of the message is not ascii: %q", i, raw[max(0, i-20):i+1])
+		}
+	}
+
+	header, parts := parse(t, msg)
+	var decoder mime.WordDecoder
+	subject, err := decoder.DecodeHeader(header.Get("Subject"))
+	if err != nil || subject != msg.Subject {
+		t.Errorf("Subject = %q, %v, want %q", subject, err, msg.Subject)
+	}
+	if to, err := header.AddressList("To"); err != nil || len(to) != 1 || to[0].Name != msg.To.Name {
+		t.Errorf("To = %v, %v, want %q", to, err, msg.To.Name)
+	}
+	if len(parts) != 2 || parts[0].body != msg.Text || parts[1].body != msg.HTML {
+		t.Errorf("parts = %+v, want the text and html unchanged", parts)
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	link := TokenLink("https://course.example", "/resetpassword", "abc123")
+	if link != "https://course.example/resetpassword?token=abc123" {
+		t.Fatalf("TokenLink = %q", link)
+	}
+
+	tests := []struct {
+		name    string
+		build   func() (Message, error)
+		subject string
+		// want is in both the text and the html body
+		want []string
+	}{
+		{"reset", func() (Message, error) {
+			return PasswordResetMessage("ada@example.com", link, 15*time.Minute)
+		}, "Reset your password", []string{link, "15 minutes"}},
+		{"verification", func() (Message, error) {
+			return VerificationMessage("ada@example.com", link, 24*time.Hour)
+		}, "Verify your email", []string{link, "24 hours"}},
+		{"notification", func() (Message, error) {
+			return NotificationMessage("ada@example.com", "Your account is locked", "Wait an hour.")
+		}, "Your account is locked", []string{"Your account is locked", "Wait an hour."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := tt.build()
+			if err != nil {
+				t.Fatalf("building message: %s", err)
+			}
+			if msg.To.Address != "ada@example.com" || msg.Subject != tt.subject || msg.From != DefaultFrom() {
+				t.Errorf("message = %+v, want to ada with subject %q", msg, tt.subject)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(msg.Text, want) {
+					t.Errorf("text %q doesn't contain %q", msg.Text, want)
+				}
+				if !strings.Contains(msg.HTML, want) {
+					t.Errorf("html %q doesn't contain %q", msg.HTML, want)
+				}
+			}
+			if !strings.HasPrefix(msg.HTML, "<!DOCTYPE html>") && !strings.Contains(msg.HTML, "<html") {
+				t.Errorf("html %q is not inside the layout", msg.HTML)
+			}
+		})
+	}
+}
+
+func TestNotificationEscapesHTML(t *testing.T) {
+	msg, err := NotificationMessage("ada@example.com", "Hi <b>", "Tom & <script>x</script>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(msg.HTML, "<script>") || strings.Contains(msg.HTML, "<b>") {
+		t.Errorf("html %q isn't escaped", msg.HTML)
+	}
+	if !strings.Contains(msg.Text, "Tom & <script>x</script>") {
+		t.Errorf("text %q was escaped, want it as written", msg.Text)
+	}
+}
+
+func TestHumanDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		15 * time.Minute: "15 minutes",
+		90 * time.Minute: "90 minutes",
+		time.Hour:        "1 hours",
+		48 * time.Hour:   "48 hours",
+	}
+	for d, want := range tests {
+		if got := humanDuration(d); got != want {
+			t.Errorf("humanDuration(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestMemoryMailer(t *testing.T) {
+	mm := NewMemoryMailer()
+	var _ Mailer = mm
+	for _, to := range []string{"ada@example.com", "bob@example.com"} {
+		err := mm.Send(Message{To: mail.Address{Address: to}, Subject: "Hello"})
+		if err != nil {
+			t.Fatalf("Send = %v", err)
+		}
+	}
+	messages := mm.Messages()
+	if len(messages) != 2 || messages[0].To.Address != "ada@example.com" || messages[1].To.Address != "bob@example.com" {
+		t.Fatalf("messages = %+v, want ada then bob", messages)
+	}
+	messages[0].Subject = "changed"
+	if mm.Messages()[0].Subject != "Hello" {
+		t.Error("Messages returned the mailer's own slice")
+	}
+}
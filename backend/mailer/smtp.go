@@ -0,0 +1,39 @@
+package mailer
+
+import (
+	"fmt"
+	"net/smtp"
+)
+
+type SMTPConfig struct {
+	Username string
+	Password string
+	Host     string
+	// Address is host:port of the smtp server
+	Address string
+}
+
+// SMTPMailer sends through an smtp server with plain auth
+type SMTPMailer struct {
+	config SMTPConfig
+	auth   smtp.Auth
+}
+
+func NewSMTPMailer(config SMTPConfig) *SMTPMailer {
+	return &SMTPMailer{
+		config: config,
+		auth:   smtp.PlainAuth("", config.Username, config.Password, config.Host),
+	}
+}
+
+func (sm SMTPMailer) Send(msg Message) error {
+	body, err := msg.Bytes()
+	if err != nil {
+		return fmt.Errorf("encoding message: %w", err)
+	}
+	err = smtp.SendMail(sm.config.Address, sm.auth, msg.From.Address, []string{msg.To.Address}, body)
+	if err != nil {
+		return fmt.Errorf("sending email: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"net/mail"
+	"net/url"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// LinkData fills the reset and verification templates
+type LinkData struct {
+	Link      string
+	ExpiresIn string
+}
+
+// NotificationData fills the notification template
+type NotificationData struct {
+	Title string
+	Body  string
+}
+
+// render executes templates/<name>.txt and templates/<name>.html with data,
+// the html one inside templates/layout.html
+func render(name string, data any) (string, string, error) {
+	textTmpl, err := texttemplate.ParseFS(templateFS, "templates/"+name+".txt")
+	if err != nil {
+		return "", "", fmt.Errorf("parsing text template %s: %w", name, err)
+	}
+	var text bytes.Buffer
+	err = textTmpl.Execute(&text, data)
+	if err != nil {
+		return "", "", fmt.Errorf("executing text template %s: %w", name, err)
+	}
+
+	htmlTmpl, err := htmltemplate.ParseFS(templateFS, "templates/layout.html", "templates/"+name+".html")
+	if err != nil {
+		return "", "", fmt.Errorf("parsing html template %s: %w", name, err)
+	}
+	var html bytes.Buffer
+	err = htmlTmpl.ExecuteTemplate(&html, "layout", data)
+	if err != nil {
+		return "", "", fmt.Errorf("executing html template %s: %w", name, err)
+	}
+	return text.String(), html.String(), nil
+}
+
+func newMessage(to, subject, name string, data any) (Message, error) {
+	text, html, err := render(name, data)
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{
+		From:    DefaultFrom(),
+		To:      mail.Address{Address: to},
+		Subject: subject,
+		Text:    text,
+		HTML:    html,
+	}, nil
+}
+
+// TokenLink builds <baseURL><path>?token=<token>
+func TokenLink(baseURL, path, token string) string {
+	return baseURL + path + "?" + url.Values{"token": {token}}.Encode()
+}
+
+func PasswordResetMessage(to, link string, expiresIn time.Duration) (Message, error) {
+	return newMessage(to, "Reset your password", "reset", LinkData{Link: link, ExpiresIn: humanDuration(expiresIn)})
+}
+
+func VerificationMessage(to, link string, expiresIn time.Duration) (Message, error) {
+	return newMessage(to, "Verify your email", "verification", LinkData{Link: link, ExpiresIn: humanDuration(expiresIn)})
+}
+
+func NotificationMessage(to, title, body string) (Message, error) {
+	return newMessage(to, title, "notification", NotificationData{Title: title, Body: body})
+}
+
+// humanDuration writes 5m as "5 minutes" and 24h as "24 hours"
+func humanDuration(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	}
+	return fmt.Sprintf("%d minutes", d/time.Minute)
+}
@@ -1,14 +1,27 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/suryasaputra2016/course/backend/config"
 	"github.com/suryasaputra2016/course/backend/handler"
+	"github.com/suryasaputra2016/course/backend/mailer"
 	"github.com/suryasaputra2016/course/backend/middleware"
+	"github.com/suryasaputra2016/course/backend/migration"
+	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/oidc"
+	"github.com/suryasaputra2016/course/backend/outbox"
+	"github.com/suryasaputra2016/course/backend/password"
 	"github.com/suryasaputra2016/course/backend/repo"
+	"github.com/suryasaputra2016/course/backend/webauthn"
 )
 
 func main() {
@@ -21,35 +34,154 @@ func main() {
 	fmt.Println("postgres database connected.")
 
 	// migration
-	err = config.PrepareTables(db)
+	migrator, err := migration.NewMigrator(db)
 	if err != nil {
-		log.Fatal(fmt.Errorf("preparing table from main: %w", err))
+		log.Fatal(fmt.Errorf("creating migrator from main: %w", err))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = migrator.RunCommand(os.Args[2:], os.Stdout)
+		if err != nil {
+			log.Fatal(fmt.Errorf("running migrate command from main: %w", err))
+		}
+		return
+	}
+	err = migrator.Up()
+	if err != nil {
+		log.Fatal(fmt.Errorf("migrating database from main: %w", err))
 	}
 
 	// repos and handlers
 	ur := repo.NewUserRepo(db)
 	sr := repo.NewSessionRepo(db)
 	prr := repo.NewPasswordResetRepo(db)
-	uh := handler.NewUserHandler(ur, sr, prr)
+	evr := repo.NewEmailVerificationRepo(db)
+	rr := repo.NewRoleRepo(db)
+	obr := repo.NewOutboxRepo(db)
+	uow := repo.NewUnitOfWork(db)
+	qr := repo.NewQuestionRepo(db)
+	sbr := repo.NewSubmissionRepo(db)
+	rlr := repo.NewRateLimitRepo(db)
+	tfr := repo.NewTwoFactorRepo(db)
+	lcr := repo.NewLoginChallengeRepo(db)
+	pr := repo.NewPasskeyRepo(db)
+	pcr := repo.NewPasskeyChallengeRepo(db)
+	osr := repo.NewOAuthStateRepo(db)
+	if email := config.AdminEmail(); email != "" {
+		granted, err := repo.BootstrapAdmin(context.Background(), uow, email)
+		if err != nil {
+			log.Fatal(fmt.Errorf("bootstrapping admin from main: %w", err))
+		}
+		if granted {
+			fmt.Printf("granted the admin role to %s.\n", email)
+		}
+	}
+	m, err := mailer.FromEnv()
+	if err != nil {
+		log.Fatal(fmt.Errorf("creating mailer from main: %w", err))
+	}
+	breached, err := password.LoadBundled()
+	if err != nil {
+		log.Fatal(fmt.Errorf("loading breached passwords from main: %w", err))
+	}
+	passwords := password.NewChecker(config.LoadPasswordPolicy(), breached)
+	loginPolicy := config.LoadLoginPolicy()
+	uh := handler.NewUserHandler(ur, sr, prr, evr, tfr, lcr, uow, loginPolicy, passwords, config.AppBaseURL())
+	ph := handler.NewPasskeyHandler(pr, pcr, ur, sr, webauthn.RelyingParty(config.LoadRelyingParty()), loginPolicy)
+	providers := map[string]*oidc.Provider{}
+	oidcClient := &http.Client{Timeout: 10 * time.Second}
+	for _, p := range config.LoadOIDCProviders() {
+		providers[p.Name] = oidc.NewProvider(oidc.Config{
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Scopes:       p.Scopes,
+		}, oidcClient)
+	}
+	oah := handler.NewOAuthHandler(providers, osr, sr, tfr, lcr, uow, strings.HasPrefix(config.AppBaseURL(), "https://"))
+	oh := handler.NewOutboxHandler(obr)
+	rh := handler.NewRoleHandler(rr, ur, uow)
+	qh := handler.NewQuestionHandler(qr, rr)
+	sbh := handler.NewSubmissionHandler(sbr, qr, uow)
+
+	// background cleanup of expired sessions and sending of queued emails
+	bgCtx := context.Background()
+	go sr.ReapExpired(bgCtx, 10*time.Minute, 500)
+	go rlr.ReapFull(bgCtx, 10*time.Minute, 500)
+	go lcr.ReapExpired(bgCtx, 10*time.Minute, 500)
+	go pcr.ReapExpired(bgCtx, 10*time.Minute, 500)
+	go osr.ReapExpired(bgCtx, 10*time.Minute, 500)
+	go obr.ReapFinished(bgCtx, time.Hour, 7*24*time.Hour, 500)
+	go outbox.NewWorker(obr, m).Run(bgCtx, 15*time.Second)
 	nfh := handler.NewNotFoundHandler()
 
+	// throttling of the auth endpoints, per client address and per account
+	rl := middleware.NewRateLimitMid(rlr)
+	loginByIP := rl.Limit("login-ip", model.RateLimit{Burst: 20, Every: 30 * time.Second}, middleware.ByIP)
+	loginByAccount := rl.Limit("login-account", model.RateLimit{Burst: 5, Every: time.Minute}, middleware.ByEmail)
+	registerByIP := rl.Limit("register-ip", model.RateLimit{Burst: 5, Every: 10 * time.Minute}, middleware.ByIP)
+	emailByIP := rl.Limit("email-ip", model.RateLimit{Burst: 5, Every: 5 * time.Minute}, middleware.ByIP)
+	emailByAccount := rl.Limit("email-account", model.RateLimit{Burst: 3, Every: 10 * time.Minute}, middleware.ByEmail)
+	secondFactorByIP := rl.Limit("2fa-ip", model.RateLimit{Burst: 10, Every: time.Minute}, middleware.ByIP)
+	resetByUser := rl.Limit("reset-user", model.RateLimit{Burst: 3, Every: 10 * time.Minute}, middleware.ByUser)
+
 	// define routes
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("POST /register", uh.RegisterUser)
-	mux.HandleFunc("POST /login", uh.LoginUser)
-	mux.HandleFunc("PUT /verifyemail/{userid}", uh.VerifyEmail)
+	mux.Handle("POST /register", registerByIP(http.HandlerFunc(uh.RegisterUser)))
+	mux.Handle("POST /login", loginByIP(loginByAccount(http.HandlerFunc(uh.LoginUser))))
+	mux.Handle("POST /login/2fa", secondFactorByIP(http.HandlerFunc(uh.LoginSecondFactor)))
+	mux.Handle("POST /login/passkey/begin", loginByIP(http.HandlerFunc(ph.BeginLogin)))
+	mux.Handle("POST /login/passkey/finish", loginByIP(http.HandlerFunc(ph.FinishLogin)))
+	mux.Handle("POST /oauth/{provider}/start", loginByIP(http.HandlerFunc(oah.StartLogin)))
+	mux.Handle("POST /oauth/{provider}/callback", loginByIP(http.HandlerFunc(oah.FinishLogin)))
+	mux.HandleFunc("PUT /verifyemail", uh.VerifyEmail)
+	mux.Handle("POST /resendverification", emailByIP(emailByAccount(http.HandlerFunc(uh.ResendVerification))))
+	mux.Handle("POST /forgotpassword", emailByIP(emailByAccount(http.HandlerFunc(uh.ForgotPassword))))
 	mux.HandleFunc("PUT /updatepassword", uh.UpdatePassword)
 	mux.HandleFunc("GET /checklogin", uh.CheckLoginUser)
 
 	accountMux := http.NewServeMux()
 	accountMux.HandleFunc("DELETE /logout", uh.LogoutUser)
-	accountMux.HandleFunc("POST /resetpassword", uh.ResetPassword)
+	accountMux.HandleFunc("GET /sessions", uh.ListSessions)
+	accountMux.HandleFunc("DELETE /sessions/{sessionid}", uh.RevokeSession)
+	accountMux.HandleFunc("DELETE /sessions/others", uh.RevokeOtherSessions)
+	accountMux.Handle("POST /resetpassword", resetByUser(http.HandlerFunc(uh.ResetPassword)))
+	accountMux.HandleFunc("POST /2fa/totp", uh.EnrollTOTP)
+	accountMux.HandleFunc("GET /2fa/totp/qr", uh.TOTPQRCode)
+	accountMux.HandleFunc("POST /2fa/totp/confirm", uh.ConfirmTOTP)
+	accountMux.HandleFunc("DELETE /2fa/totp", uh.DisableTOTP)
+	accountMux.HandleFunc("POST /2fa/recoverycodes", uh.RegenerateRecoveryCodes)
+	accountMux.HandleFunc("POST /passkeys/register/begin", ph.BeginRegistration)
+	accountMux.HandleFunc("POST /passkeys/register/finish", ph.FinishRegistration)
+	accountMux.HandleFunc("GET /passkeys", ph.ListPasskeys)
+	accountMux.HandleFunc("PUT /passkeys/{passkeyid}", ph.RenamePasskey)
+	accountMux.HandleFunc("DELETE /passkeys/{passkeyid}", ph.DeletePasskey)
+
+	adminMux := http.NewServeMux()
+	adminMux.HandleFunc("POST /admin/roles/{userid}", rh.GrantRole)
+	adminMux.HandleFunc("DELETE /admin/roles/{userid}", rh.RevokeRole)
+	adminMux.HandleFunc("GET /admin/roleaudits", rh.ListRoleAudits)
+
+	emailAdminMux := http.NewServeMux()
+	emailAdminMux.HandleFunc("GET /admin/emails", oh.ListEmails)
+	emailAdminMux.HandleFunc("POST /admin/emails/{emailid}/resend", oh.ResendEmail)
 
 	publicMux := http.NewServeMux()
 	publicMux.HandleFunc("/", nfh.Home)
 
-	auth := middleware.NewAuthMid(sr)
+	auth := middleware.NewAuthMid(sr, ur)
+	rbac := middleware.NewRBACMid(rr)
+	accountMux.Handle("POST /questions", rbac.RequirePermission(model.PermCreateQuestion)(http.HandlerFunc(qh.CreateQuestion)))
+	accountMux.HandleFunc("GET /questions", qh.ListQuestions)
+	accountMux.HandleFunc("GET /questions/{questionid}", qh.GetQuestion)
+	accountMux.HandleFunc("PUT /questions/{questionid}", qh.UpdateQuestion)
+	accountMux.HandleFunc("DELETE /questions/{questionid}", qh.DeleteQuestion)
+	accountMux.HandleFunc("POST /questions/{questionid}/submissions", sbh.SubmitAnswer)
+	accountMux.HandleFunc("GET /submissions", sbh.ListSubmissions)
+	accountMux.Handle("/admin/", rbac.RequirePermission(model.PermManageRoles)(adminMux))
+	accountMux.Handle("/admin/emails", rbac.RequirePermission(model.PermManageEmails)(emailAdminMux))
+	accountMux.Handle("/admin/emails/", rbac.RequirePermission(model.PermManageEmails)(emailAdminMux))
 	mux.Handle("/dashboard/", http.StripPrefix("/dashboard", auth.Authorize(accountMux)))
 	mux.Handle("/", http.StripPrefix("", publicMux))
 
@@ -59,5 +191,23 @@ func main() {
 		Handler: middleware.SetJSONHeader(mux),
 	}
 	fmt.Println("serving and listening back-end on :8080...")
-	log.Fatal(server.ListenAndServe())
+	stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	<-stop.Done()
+
+	// finish the requests in flight, then the emails they queue after answering
+	fmt.Println("shutting down...")
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelShutdown()
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Printf("shutting down server: %s", err)
+	}
+	uh.Wait()
 }
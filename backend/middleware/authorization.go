@@ -1,46 +1,79 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"time"
 
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/problem"
 	"github.com/suryasaputra2016/course/backend/repo"
 	"github.com/suryasaputra2016/course/backend/utils"
 )
 
+// dbTimeout bounds the database lookups a middleware makes for one request
+const dbTimeout = 5 * time.Second
+
 type AuthMid struct {
-	SessionRepo *repo.SessionRepo
+	SessionRepo repo.SessionStore
+	UserRepo    repo.UserStore
 }
 
-func NewAuthMid(sr *repo.SessionRepo) *AuthMid {
-	return &AuthMid{SessionRepo: sr}
+func NewAuthMid(sr repo.SessionStore, ur repo.UserStore) *AuthMid {
+	return &AuthMid{SessionRepo: sr, UserRepo: ur}
 }
 
-// AccountOnly check if the user is logged in
+// Authorize check if the user is logged in and puts the session and user in the request context
 func (am AuthMid) Authorize(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token, err := r.Cookie("token")
 		if err != nil {
-			log.Printf("getting token from cookie: %s", err)
-			http.Error(w, "bad request", http.StatusBadRequest)
+			problem.Write(w, r, apperr.Unauthorized("not logged in").Wrap(err))
 			return
 		}
 
 		if token.Value == "" {
-			log.Printf("token map empty")
-			http.Error(w, "bad request", http.StatusBadRequest)
+			problem.Write(w, r, apperr.Unauthorized("not logged in"))
 			return
 		}
 
 		tokenHashString := utils.HashToken(token.Value)
 
-		_, err = am.SessionRepo.GetFromTokenHash(tokenHashString)
+		ctx, cancel := context.WithTimeout(r.Context(), dbTimeout)
+		defer cancel()
+
+		session, err := am.SessionRepo.GetFromTokenHash(ctx, tokenHashString)
+		if errors.Is(err, apperr.ErrNotFound) {
+			err = apperr.Unauthorized("session not found").Wrap(err)
+		}
+		if err != nil {
+			problem.Write(w, r, fmt.Errorf("getting session: %w", err))
+			return
+		}
+
+		if session.IsExpired(time.Now()) {
+			problem.Write(w, r, apperr.Unauthorized("session expired"))
+			return
+		}
+
+		// sliding renewal on activity
+		err = am.SessionRepo.Renew(ctx, session)
+		if err != nil {
+			log.Printf("renewing session: %s", err)
+		}
+
+		user, err := am.UserRepo.GetByID(ctx, session.UserID)
+		if errors.Is(err, apperr.ErrNotFound) {
+			err = apperr.Unauthorized("session user not found").Wrap(err)
+		}
 		if err != nil {
-			log.Printf("session hash not found: %s", err)
-			http.Error(w, "bad request", http.StatusBadRequest)
+			problem.Write(w, r, fmt.Errorf("getting session user: %w", err))
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(WithAuth(r.Context(), session, user)))
 	})
 }
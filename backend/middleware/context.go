@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+// contextKey is unexported so no other package can collide with our keys
+type contextKey int
+
+const (
+	sessionKey contextKey = iota
+	userKey
+)
+
+// WithAuth returns a copy of ctx carrying the authenticated session and user
+func WithAuth(ctx context.Context, session *model.Session, user *model.User) context.Context {
+	ctx = context.WithValue(ctx, sessionKey, session)
+	return context.WithValue(ctx, userKey, user)
+}
+
+// SessionFromContext returns the session stored by Authorize
+func SessionFromContext(ctx context.Context) (*model.Session, bool) {
+	session, ok := ctx.Value(sessionKey).(*model.Session)
+	return session, ok && session != nil
+}
+
+// UserFromContext returns the user stored by Authorize
+func UserFromContext(ctx context.Context) (*model.User, bool) {
+	user, ok := ctx.Value(userKey).(*model.User)
+	return user, ok && user != nil
+}
@@ -2,6 +2,8 @@ package middleware
 
 import (
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // SetJSONHeader set content type to json for handler
@@ -11,3 +13,10 @@ func SetJSONHeader(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// SetRetryAfter tells the client how many seconds to wait, rounded up so it
+// doesn't come back too early
+func SetRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+}
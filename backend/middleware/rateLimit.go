@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/problem"
+	"github.com/suryasaputra2016/course/backend/repo"
+	"github.com/suryasaputra2016/course/backend/utils"
+)
+
+// maxPeekBytes bounds how much of a body ByEmail reads
+const maxPeekBytes = 1 << 20
+
+// KeyFunc names the client a request is counted against, an empty key lets
+// the request through uncounted
+type KeyFunc func(r *http.Request) string
+
+type RateLimitMid struct {
+	Store repo.RateLimitStore
+}
+
+func NewRateLimitMid(store repo.RateLimitStore) *RateLimitMid {
+	return &RateLimitMid{Store: store}
+}
+
+// Limit lets a request through while the bucket of name and its key has a
+// token left, otherwise it answers 429 with a Retry-After header
+func (rl RateLimitMid) Limit(name string, limit model.RateLimit, key KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), dbTimeout)
+			defer cancel()
+			allowed, retryAfter, err := rl.Store.Take(ctx, name+":"+k, limit)
+			if err != nil {
+				problem.Write(w, r, fmt.Errorf("checking rate limit %s: %w", name, err))
+				return
+			}
+			if !allowed {
+				SetRetryAfter(w, retryAfter)
+				problem.Write(w, r, apperr.RateLimited("too many requests, try again later"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ByIP counts requests per client address. It uses the connection address,
+// behind a proxy that address must be restored before this middleware runs.
+func ByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ByEmail counts requests per account named by the email field of a JSON
+// body, the handler still reads the whole body
+func ByEmail(r *http.Request) string {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPeekBytes))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+
+	var fields struct {
+		Email string `json:"email"`
+	}
+	json.Unmarshal(body, &fields)
+	return utils.NormalizeEmail(fields.Email)
+}
+
+// ByUser counts requests per logged in user, it must be composed after
+// AuthMid.Authorize
+func ByUser(r *http.Request) string {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		return ""
+	}
+	return strconv.Itoa(user.ID)
+}
@@ -0,0 +1,52 @@
+package middleware_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/middleware"
+	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/repo/memory"
+)
+
+func TestRateLimit(t *testing.T) {
+	rl := middleware.NewRateLimitMid(memory.New().Repos().RateLimits)
+	limit := model.RateLimit{Burst: 2, Every: time.Minute}
+
+	var bodies []string
+	handler := rl.Limit("login", limit, middleware.ByEmail)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+	}))
+	login := func(email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(`{"email":"`+email+`","password":"x"}`))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := range limit.Burst {
+		if rec := login("ada@example.com"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d, want %d", i+1, rec.Code, http.StatusOK)
+		}
+	}
+	rec := login("ADA@example.com")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the burst status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Retry-After = %q, want 60", got)
+	}
+
+	// another account has its own bucket and the handler still sees the body
+	if rec := login("bob@example.com"); rec.Code != http.StatusOK {
+		t.Errorf("other account status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if last := bodies[len(bodies)-1]; !strings.Contains(last, "bob@example.com") {
+		t.Errorf("handler body = %q, want the request body", last)
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/problem"
+	"github.com/suryasaputra2016/course/backend/repo"
+)
+
+type RBACMid struct {
+	RoleRepo repo.RoleStore
+}
+
+func NewRBACMid(rr repo.RoleStore) *RBACMid {
+	return &RBACMid{RoleRepo: rr}
+}
+
+// RequirePermission lets the request through if a role of the user carries permission,
+// it must be composed after AuthMid.Authorize
+func (rm RBACMid) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := UserFromContext(r.Context())
+			if !ok {
+				problem.Write(w, r, apperr.Unauthorized("not logged in"))
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), dbTimeout)
+			defer cancel()
+			has, err := rm.RoleRepo.HasPermission(ctx, user.ID, permission)
+			if err != nil {
+				problem.Write(w, r, fmt.Errorf("checking permission: %w", err))
+				return
+			}
+			if !has {
+				problem.Write(w, r, apperr.Forbidden("requires the permission "+permission))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package migration
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// RunCommand handles `migrate status|up|down|to N` and prints the result to w
+func (m Migrator) RunCommand(args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate status|up|down|to N")
+	}
+
+	var err error
+	switch args[0] {
+	case "status":
+		return m.printStatus(w)
+	case "up":
+		err = m.Up()
+	case "down":
+		err = m.Down()
+	case "to":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: migrate to N")
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			return fmt.Errorf("parsing migration version: %w", convErr)
+		}
+		err = m.To(version)
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+	if err != nil {
+		return err
+	}
+	return m.printStatus(w)
+}
+
+func (m Migrator) printStatus(w io.Writer) error {
+	statuses, err := m.Status()
+	if err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		appliedAt := "pending"
+		if s.IsApplied {
+			appliedAt = "applied " + s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%04d %-30s %s\n", s.Version, s.Name, appliedAt)
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var sqlFS embed.FS
+
+// lockKey is the postgres advisory lock id held while migrating, so two
+// backends starting at the same time do not run the same migration twice
+const lockKey int64 = 7351820461
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	IsApplied bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewMigrator loads the embedded migration files in version order
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(sqlFS, "sql")
+	if err != nil {
+		return nil, fmt.Errorf("loading migrations: %w", err)
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// loadMigrations reads files named <version>_<name>.<up|down>.sql from dir
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading migration directory: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		fileName := entry.Name()
+		base, ok := strings.CutSuffix(fileName, ".sql")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		base, direction := splitDirection(base)
+		if direction == "" {
+			return nil, fmt.Errorf("migration %s has no up or down suffix", fileName)
+		}
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s has no name", fileName)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s has invalid version", fileName)
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, fileName))
+		if err != nil {
+			return nil, fmt.Errorf("reading migration %s: %w", fileName, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration version %d has two names: %s and %s", version, m.Name, name)
+		}
+		script := &m.Down
+		if direction == "up" {
+			script = &m.Up
+		}
+		// 1_name and 0001_name are the same version
+		if *script != "" {
+			return nil, fmt.Errorf("migration %d_%s has two %s files", version, name, direction)
+		}
+		*script = string(content)
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func splitDirection(base string) (string, string) {
+	if name, ok := strings.CutSuffix(base, ".up"); ok {
+		return name, "up"
+	}
+	if name, ok := strings.CutSuffix(base, ".down"); ok {
+		return name, "down"
+	}
+	return base, ""
+}
+
+// Latest returns the highest known migration version
+func (m Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status lists every known migration and whether it has been applied
+func (m Migrator) Status() ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(func(conn *sql.Conn) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			appliedAt, isApplied := applied[mig.Version]
+			statuses = append(statuses, MigrationStatus{
+				Version:   mig.Version,
+				Name:      mig.Name,
+				IsApplied: isApplied,
+				AppliedAt: appliedAt,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting migration status: %w", err)
+	}
+	return statuses, nil
+}
+
+// Up applies every pending migration
+func (m Migrator) Up() error {
+	return m.To(m.Latest())
+}
+
+// Down rolls back the most recently applied migration
+func (m Migrator) Down() error {
+	return m.withLock(func(conn *sql.Conn) error {
+		current, err := currentVersion(conn)
+		if err != nil {
+			return err
+		}
+		if current == 0 {
+			return nil
+		}
+		mig, ok := m.find(current)
+		if !ok {
+			return fmt.Errorf("applied migration %d not found in embedded files", current)
+		}
+		return rollback(conn, mig)
+	})
+}
+
+// find returns the migration with version
+func (m Migrator) find(version int) (Migration, bool) {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return mig, true
+		}
+	}
+	return Migration{}, false
+}
+
+// To migrates up or down until version is the latest applied migration
+func (m Migrator) To(version int) error {
+	if version < 0 || version > m.Latest() {
+		return fmt.Errorf("migration version %d out of range 0..%d", version, m.Latest())
+	}
+	return m.withLock(func(conn *sql.Conn) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+		ups, downs := m.plan(applied, version)
+		for _, mig := range ups {
+			err = apply(conn, mig)
+			if err != nil {
+				return err
+			}
+		}
+		for _, mig := range downs {
+			err = rollback(conn, mig)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// plan returns the migrations To(version) applies, oldest first, and the ones
+// it rolls back, newest first. A gap left below version by a migration added
+// after newer ones were applied is filled too.
+func (m Migrator) plan(applied map[int]time.Time, version int) ([]Migration, []Migration) {
+	var ups, downs []Migration
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; !ok && mig.Version <= version {
+			ups = append(ups, mig)
+		}
+	}
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; ok && mig.Version > version {
+			downs = append(downs, mig)
+		}
+	}
+	return ups, downs
+}
+
+// withLock runs fn on a single connection holding the migration advisory lock
+func (m Migrator) withLock(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("getting connection: %w", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1);`, lockKey)
+	if err != nil {
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1);`, lockKey)
+
+	queryStr := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);`
+	_, err = conn.ExecContext(ctx, queryStr)
+	if err != nil {
+		return fmt.Errorf("creating schema migrations table: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func appliedVersions(conn *sql.Conn) (map[int]time.Time, error) {
+	queryStr := `
+		SELECT version, applied_at
+		FROM schema_migrations;`
+	rows, err := conn.QueryContext(context.Background(), queryStr)
+	if err != nil {
+		return nil, fmt.Errorf("selecting applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scanning applied migration: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating applied migrations: %w", err)
+	}
+	return applied, nil
+}
+
+func currentVersion(conn *sql.Conn) (int, error) {
+	var version int
+	queryStr := `
+		SELECT COALESCE(MAX(version), 0)
+		FROM schema_migrations;`
+	err := conn.QueryRowContext(context.Background(), queryStr).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("selecting current migration version: %w", err)
+	}
+	return version, nil
+}
+
+func apply(conn *sql.Conn, mig Migration) error {
+	return inTx(conn, func(tx *sql.Tx) error {
+		_, err := tx.Exec(mig.Up)
+		if err != nil {
+			return fmt.Errorf("applying migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		queryStr := `
+			INSERT INTO schema_migrations (version, name)
+			VALUES ($1, $2);`
+		_, err = tx.Exec(queryStr, mig.Version, mig.Name)
+		if err != nil {
+			return fmt.Errorf("recording migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		return nil
+	})
+}
+
+func rollback(conn *sql.Conn, mig Migration) error {
+	return inTx(conn, func(tx *sql.Tx) error {
+		_, err := tx.Exec(mig.Down)
+		if err != nil {
+			return fmt.Errorf("rolling back migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		queryStr := `
+			DELETE FROM schema_migrations
+			WHERE version = $1;`
+		_, err = tx.Exec(queryStr, mig.Version)
+		if err != nil {
+			return fmt.Errorf("unrecording migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		return nil
+	})
+}
+
+func inTx(conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("beginning migration transaction: %w", err)
+	}
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing migration transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package migration
+
+import (
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func file(content string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(content)}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    fstest.MapFS
+		versions []int
+		ok       bool
+	}{
+		{"ordered by version", fstest.MapFS{
+			"sql/0010_c.up.sql":   file("up c"),
+			"sql/0010_c.down.sql": file("down c"),
+			"sql/0002_b.up.sql":   file("up b"),
+			"sql/0002_b.down.sql": file("down b"),
+			"sql/0001_a.up.sql":   file("up a"),
+			"sql/0001_a.down.sql": file("down a"),
+		}, []int{1, 2, 10}, true},
+		{"other files skipped", fstest.MapFS{
+			"sql/0001_a.up.sql":   file("up a"),
+			"sql/0001_a.down.sql": file("down a"),
+			"sql/README.md":       file("notes"),
+			"sql/old.sql/x":       file("dir"),
+		}, []int{1}, true},
+		{"empty directory", fstest.MapFS{"sql/README.md": file("notes")}, []int{}, true},
+		{"missing down", fstest.MapFS{"sql/0001_a.up.sql": file("up a")}, nil, false},
+		{"missing up", fstest.MapFS{"sql/0001_a.down.sql": file("down a")}, nil, false},
+		{"empty up", fstest.MapFS{
+			"sql/0001_a.up.sql":   file(""),
+			"sql/0001_a.down.sql": file("down a"),
+		}, nil, false},
+		{"no direction", fstest.MapFS{"sql/0001_a.sql": file("up a")}, nil, false},
+		{"no name", fstest.MapFS{"sql/0001.up.sql": file("up a")}, nil, false},
+		{"version not a number", fstest.MapFS{"sql/one_a.up.sql": file("up a")}, nil, false},
+		{"version zero", fstest.MapFS{"sql/0000_a.up.sql": file("up a")}, nil, false},
+		{"version with two names", fstest.MapFS{
+			"sql/0001_a.up.sql":   file("up a"),
+			"sql/0001_a.down.sql": file("down a"),
+			"sql/0001_b.up.sql":   file("up b"),
+			"sql/0001_b.down.sql": file("down b"),
+		}, nil, false},
+		{"version written twice", fstest.MapFS{
+			"sql/0001_a.up.sql":   file("up a"),
+			"sql/0001_a.down.sql": file("down a"),
+			"sql/1_a.up.sql":      file("other up a"),
+			"sql/1_a.down.sql":    file("other down a"),
+		}, nil, false},
+		{"missing directory", fstest.MapFS{"other/0001_a.up.sql": file("up a")}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := loadMigrations(tt.files, "sql")
+			if (err == nil) != tt.ok {
+				t.Fatalf("loadMigrations error = %v, want ok %t", err, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+			if got := versions(migrations); !slices.Equal(got, tt.versions) {
+				t.Errorf("versions = %v, want %v", got, tt.versions)
+			}
+		})
+	}
+}
+
+func TestLoadMigrationsContent(t *testing.T) {
+	migrations, err := loadMigrations(fstest.MapFS{
+		"sql/0001_create_users.up.sql":   file("CREATE TABLE users ();"),
+		"sql/0001_create_users.down.sql": file("DROP TABLE users;"),
+	}, "sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Migration{Version: 1, Name: "create_users", Up: "CREATE TABLE users ();", Down: "DROP TABLE users;"}
+	if len(migrations) != 1 || migrations[0] != want {
+		t.Errorf("migrations = %+v, want %+v", migrations, want)
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(sqlFS, "sql")
+	if err != nil {
+		t.Fatalf("loading embedded migrations: %s", err)
+	}
+	for i, mig := range migrations {
+		if mig.Version != i+1 {
+			t.Fatalf("migration %d_%s follows version %d, want no gaps", mig.Version, mig.Name, i)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	m := Migrator{}
+	for _, version := range []int{1, 2, 3, 4} {
+		m.migrations = append(m.migrations, Migration{Version: version})
+	}
+	tests := []struct {
+		name    string
+		applied []int
+		version int
+		ups     []int
+		downs   []int
+	}{
+		{"all from nothing", nil, 4, []int{1, 2, 3, 4}, nil},
+		{"part from nothing", nil, 2, []int{1, 2}, nil},
+		{"up to date", []int{1, 2, 3, 4}, 4, nil, nil},
+		{"pending", []int{1, 2}, 4, []int{3, 4}, nil},
+		{"back", []int{1, 2, 3, 4}, 1, nil, []int{4, 3, 2}},
+		{"all back", []int{1, 2, 3, 4}, 0, nil, []int{4, 3, 2, 1}},
+		{"gap filled", []int{1, 3}, 4, []int{2, 4}, nil},
+		{"gap below target filled, above rolled back", []int{1, 3, 4}, 2, []int{2}, []int{4, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applied := map[int]time.Time{}
+			for _, version := range tt.applied {
+				applied[version] = time.Now()
+			}
+			ups, downs := m.plan(applied, tt.version)
+			if got := versions(ups); !slices.Equal(got, tt.ups) {
+				t.Errorf("applied = %v, want %v", got, tt.ups)
+			}
+			if got := versions(downs); !slices.Equal(got, tt.downs) {
+				t.Errorf("rolled back = %v, want %v", got, tt.downs)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	m := Migrator{migrations: []Migration{{Version: 1, Name: "a"}, {Version: 2, Name: "b"}}}
+	if mig, ok := m.find(2); !ok || mig.Name != "b" {
+		t.Errorf("find(2) = %+v, %t, want b", mig, ok)
+	}
+	if _, ok := m.find(3); ok {
+		t.Error("find(3) found a migration that isn't embedded")
+	}
+	if m.Latest() != 2 {
+		t.Errorf("Latest = %d, want 2", m.Latest())
+	}
+}
+
+func versions(migrations []Migration) []int {
+	var got []int
+	for _, mig := range migrations {
+		got = append(got, mig.Version)
+	}
+	return got
+}
@@ -0,0 +1,123 @@
+package migration
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// testDB opens TEST_DATABASE_STRING in a schema of its own that is dropped
+// after the test, and skips the test when no database is configured
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_STRING")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_STRING is not set")
+	}
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("opening postgres: %s", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("migration_test_%d", time.Now().UnixNano())
+	_, err = admin.Exec(`CREATE SCHEMA ` + schema)
+	if err != nil {
+		t.Fatalf("creating schema: %s", err)
+	}
+	t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	// lib/pq sends parameters it doesn't know to the server, search_path
+	// among them
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			t.Fatalf("parsing TEST_DATABASE_STRING: %s", err)
+		}
+		query := u.Query()
+		query.Set("search_path", schema)
+		u.RawQuery = query.Encode()
+		dsn = u.String()
+	} else {
+		dsn += " search_path=" + schema
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("opening postgres in schema: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestLowercaseEmails(t *testing.T) {
+	db := testDB(t)
+	m, err := NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const lowercase = 17
+	err = m.To(lowercase - 1)
+	if err != nil {
+		t.Fatalf("migrating to %d: %s", lowercase-1, err)
+	}
+	_, err = db.Exec(`INSERT INTO users (email) VALUES ('Ada@Example.com'), ('ada@example.com'), ('Bob@Example.com')`)
+	if err != nil {
+		t.Fatalf("seeding users: %s", err)
+	}
+
+	err = m.To(lowercase)
+	if err == nil {
+		t.Fatal("lowercasing emails that differ only in case succeeded")
+	}
+	for _, want := range []string{"merged first", "Ada@Example.com (id 1)", "ada@example.com (id 2)"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q doesn't contain %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "Bob@Example.com") {
+		t.Errorf("error %q lists an email without a duplicate", err)
+	}
+	var email string
+	err = db.QueryRow(`SELECT email FROM users WHERE id = 3`).Scan(&email)
+	if err != nil || email != "Bob@Example.com" {
+		t.Errorf("email of bob after the failed migration = %q, %v, want it unchanged", email, err)
+	}
+
+	// once the duplicate is merged by hand the migration goes through
+	_, err = db.Exec(`DELETE FROM users WHERE id = 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.To(lowercase)
+	if err != nil {
+		t.Fatalf("migrating to %d: %s", lowercase, err)
+	}
+	rows, err := db.Query(`SELECT email FROM users ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var emails []string
+	for rows.Next() {
+		rows.Scan(&email)
+		emails = append(emails, email)
+	}
+	rows.Close()
+	if strings.Join(emails, ",") != "ada@example.com,bob@example.com" {
+		t.Errorf("emails = %v, want them lowercase", emails)
+	}
+	_, err = db.Exec(`INSERT INTO users (email) VALUES ('Eve@Example.com')`)
+	if err == nil {
+		t.Error("inserting a mixed-case email succeeded")
+	}
+
+	err = m.To(lowercase - 1)
+	if err != nil {
+		t.Fatalf("rolling back %d: %s", lowercase, err)
+	}
+}
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	email TEXT UNIQUE NOT NULL,
+	password_hash TEXT,
+	is_verified BOOL DEFAULT FALSE,
+	role VARCHAR(15)
+);
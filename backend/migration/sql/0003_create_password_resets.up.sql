@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS password_resets (
+	id SERIAL PRIMARY KEY,
+	user_id INT UNIQUE NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	token_hash TEXT UNIQUE NOT NULL,
+	expiration_time TIMESTAMPTZ NOT NULL
+);
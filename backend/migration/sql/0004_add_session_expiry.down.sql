@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS sessions_expires_at_idx;
+
+ALTER TABLE sessions
+	DROP COLUMN created_at,
+	DROP COLUMN last_seen_at,
+	DROP COLUMN expires_at,
+	DROP COLUMN absolute_expires_at;
@@ -0,0 +1,12 @@
+-- sessions created before expiry existed are treated as already expired
+ALTER TABLE sessions
+	ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	ADD COLUMN last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	ADD COLUMN expires_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	ADD COLUMN absolute_expires_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+ALTER TABLE sessions
+	ALTER COLUMN expires_at DROP DEFAULT,
+	ALTER COLUMN absolute_expires_at DROP DEFAULT;
+
+CREATE INDEX sessions_expires_at_idx ON sessions (expires_at);
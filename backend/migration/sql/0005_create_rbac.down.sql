@@ -0,0 +1,17 @@
+ALTER TABLE users ADD COLUMN role VARCHAR(15);
+
+UPDATE users u
+SET role = COALESCE((
+	SELECT r.name
+	FROM user_roles ur
+	JOIN roles r ON r.id = ur.role_id
+	WHERE ur.user_id = u.id
+	ORDER BY r.id DESC
+	LIMIT 1
+), 'user');
+
+DROP TABLE IF EXISTS role_audits;
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
@@ -0,0 +1,56 @@
+CREATE TABLE roles (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(15) UNIQUE NOT NULL
+);
+
+CREATE TABLE permissions (
+	id SERIAL PRIMARY KEY,
+	name TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE role_permissions (
+	role_id INT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+	permission_id INT NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+	PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE user_roles (
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role_id INT NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+	granted_by INT REFERENCES users(id) ON DELETE SET NULL,
+	granted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (user_id, role_id)
+);
+
+CREATE TABLE role_audits (
+	id SERIAL PRIMARY KEY,
+	actor_id INT REFERENCES users(id) ON DELETE SET NULL,
+	target_user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role_name VARCHAR(15) NOT NULL,
+	action VARCHAR(10) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO roles (name) VALUES ('student'), ('author'), ('reviewer'), ('admin');
+
+INSERT INTO permissions (name) VALUES
+	('question:create'),
+	('question:edit_any'),
+	('question:delete_any'),
+	('question:review'),
+	('role:manage');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r, permissions p
+WHERE (r.name = 'author' AND p.name = 'question:create')
+	OR (r.name = 'reviewer' AND p.name = 'question:review')
+	OR r.name = 'admin';
+
+-- the old free-text role becomes a row in user_roles, "user" meant student
+INSERT INTO user_roles (user_id, role_id)
+SELECT u.id, r.id
+FROM users u
+JOIN roles r ON r.name = CASE WHEN u.role IN ('author', 'reviewer', 'admin') THEN u.role ELSE 'student' END;
+
+ALTER TABLE users DROP COLUMN role;
@@ -0,0 +1,14 @@
+CREATE TABLE questions (
+	id SERIAL PRIMARY KEY,
+	author_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	title TEXT NOT NULL,
+	statement TEXT NOT NULL,
+	topic VARCHAR(50) NOT NULL,
+	difficulty INT NOT NULL CHECK (difficulty BETWEEN 1 AND 5),
+	answer_spec JSONB NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX questions_topic_idx ON questions (topic);
+CREATE INDEX questions_author_id_idx ON questions (author_id);
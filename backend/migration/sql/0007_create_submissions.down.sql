@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS submissions;
+
+ALTER TABLE questions
+	DROP COLUMN max_attempts,
+	DROP COLUMN cooldown_seconds;
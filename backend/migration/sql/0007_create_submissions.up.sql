@@ -0,0 +1,16 @@
+ALTER TABLE questions
+	ADD COLUMN max_attempts INT NOT NULL DEFAULT 0 CHECK (max_attempts >= 0),
+	ADD COLUMN cooldown_seconds INT NOT NULL DEFAULT 0 CHECK (cooldown_seconds >= 0);
+
+CREATE TABLE submissions (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	question_id INT NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+	answer TEXT NOT NULL,
+	is_correct BOOL NOT NULL,
+	verdict JSONB NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX submissions_user_id_created_at_idx ON submissions (user_id, created_at DESC);
+CREATE INDEX submissions_user_id_question_id_idx ON submissions (user_id, question_id);
@@ -0,0 +1,2 @@
+ALTER TABLE questions
+	ADD COLUMN variables JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,10 @@
+CREATE TABLE email_verifications (
+	id SERIAL PRIMARY KEY,
+	user_id INT UNIQUE NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	token_hash TEXT UNIQUE NOT NULL,
+	expiration_time TIMESTAMPTZ NOT NULL,
+	last_sent_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	-- sent_count counts sends since window_started_at, for resend rate limits
+	sent_count INT NOT NULL DEFAULT 1,
+	window_started_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE name = 'email:manage';
+
+DROP TABLE IF EXISTS email_outbox;
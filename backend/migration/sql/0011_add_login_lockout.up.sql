@@ -0,0 +1,4 @@
+-- failed_logins counts wrong passwords since the last successful login
+ALTER TABLE users
+	ADD COLUMN failed_logins INT NOT NULL DEFAULT 0,
+	ADD COLUMN locked_until TIMESTAMPTZ;
@@ -0,0 +1,8 @@
+-- a token bucket per key, stored as the time it is full again,
+-- rows whose full_at has passed are the same as no row
+CREATE TABLE rate_limits (
+	key TEXT PRIMARY KEY,
+	full_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX rate_limits_full_at_idx ON rate_limits (full_at);
@@ -0,0 +1,25 @@
+CREATE TABLE passkeys (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	credential_id BYTEA UNIQUE NOT NULL,
+	-- COSE_Key of the credential, as the authenticator sent it
+	public_key BYTEA NOT NULL,
+	sign_count BIGINT NOT NULL DEFAULT 0,
+	transports TEXT[] NOT NULL DEFAULT '{}',
+	name TEXT NOT NULL,
+	backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+	backed_up BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX passkeys_user_id_idx ON passkeys (user_id);
+
+CREATE TABLE passkey_challenges (
+	id SERIAL PRIMARY KEY,
+	-- the user adding a passkey, NULL for a login where the user is not known yet
+	user_id INT REFERENCES users(id) ON DELETE CASCADE,
+	challenge_hash TEXT UNIQUE NOT NULL,
+	ceremony TEXT NOT NULL CHECK (ceremony IN ('register', 'login')),
+	expires_at TIMESTAMPTZ NOT NULL
+);
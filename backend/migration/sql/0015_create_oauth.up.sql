@@ -0,0 +1,23 @@
+CREATE TABLE oauth_identities (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	provider TEXT NOT NULL,
+	-- the sub claim, stable for an account at the provider unlike its email
+	subject TEXT NOT NULL,
+	email TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	UNIQUE (provider, subject)
+);
+
+CREATE INDEX oauth_identities_user_id_idx ON oauth_identities (user_id);
+
+CREATE TABLE oauth_states (
+	id SERIAL PRIMARY KEY,
+	state_hash TEXT UNIQUE NOT NULL,
+	-- hash of the cookie that ties the login to the browser that started it
+	binding_hash TEXT NOT NULL,
+	provider TEXT NOT NULL,
+	nonce TEXT NOT NULL,
+	code_verifier TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS sessions_user_id_idx;
+
+ALTER TABLE sessions
+	DROP COLUMN user_agent,
+	DROP COLUMN ip;
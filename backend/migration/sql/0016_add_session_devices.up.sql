@@ -0,0 +1,6 @@
+-- the device a session was started on, as the session list shows it
+ALTER TABLE sessions
+	ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+	ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
@@ -0,0 +1,24 @@
+-- emails are stored lowercase so that logins and linked accounts match them
+-- whatever case they are typed in. Accounts whose emails differ only in case
+-- can't be merged without knowing which one the owner uses, so the migration
+-- stops and lists them; merge or delete them by hand, then run it again.
+DO $$
+DECLARE
+	duplicates TEXT;
+BEGIN
+	SELECT string_agg(accounts, '; ' ORDER BY accounts) INTO duplicates
+	FROM (
+		SELECT string_agg(email || ' (id ' || id || ')', ', ' ORDER BY id) AS accounts
+		FROM users
+		GROUP BY lower(email)
+		HAVING COUNT(*) > 1
+	) AS same_email;
+	IF duplicates IS NOT NULL THEN
+		RAISE EXCEPTION 'users with emails that differ only in case must be merged first: %', duplicates;
+	END IF;
+END $$;
+
+UPDATE users SET email = lower(email) WHERE email <> lower(email);
+
+ALTER TABLE users
+	ADD CONSTRAINT users_email_lowercase CHECK (email = lower(email));
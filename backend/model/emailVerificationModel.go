@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+type EmailVerification struct {
+	ID              int       `json:"-"`
+	UserID          int       `json:"user_id"`
+	TokenHash       string    `json:"token_hash"`
+	ExpirationTime  time.Time `json:"expiration_time"`
+	LastSentAt      time.Time `json:"last_sent_at"`
+	SentCount       int       `json:"sent_count"`
+	WindowStartedAt time.Time `json:"window_started_at"`
+}
+
+type VerifyEmail struct {
+	Token string `json:"token" validate:"required,max=128"`
+}
+
+type ResendVerification struct {
+	Email string `json:"email" validate:"required,email,max=254"`
+}
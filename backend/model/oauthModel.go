@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// OAuthIdentity links an account at an OpenID Connect provider to a user
+type OAuthIdentity struct {
+	ID        int
+	UserID    int
+	Provider  string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
+
+// OAuthState is a login sent to a provider and not back yet
+type OAuthState struct {
+	ID           int
+	StateHash    string
+	BindingHash  string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// OAuthCallback is what the provider sent back to the redirect URL
+type OAuthCallback struct {
+	State string `json:"state" validate:"required,max=256"`
+	Code  string `json:"code" validate:"required,max=2048"`
+}
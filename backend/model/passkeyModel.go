@@ -0,0 +1,50 @@
+package model
+
+import (
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/webauthn"
+)
+
+// ceremonies a passkey challenge is for
+const (
+	PasskeyCeremonyRegister = "register"
+	PasskeyCeremonyLogin    = "login"
+)
+
+// Passkey is a WebAuthn credential a user logs in with instead of a password
+type Passkey struct {
+	ID           int      `json:"id"`
+	UserID       int      `json:"-"`
+	CredentialID []byte   `json:"-"`
+	PublicKey    []byte   `json:"-"`
+	SignCount    uint32   `json:"-"`
+	Transports   []string `json:"transports"`
+	Name         string   `json:"name"`
+	// BackupEligible passkeys can be synced to other devices, BackedUp ones are
+	BackupEligible bool       `json:"backup_eligible"`
+	BackedUp       bool       `json:"backed_up"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+}
+
+// PasskeyChallenge is the server side of one ceremony, the response to it
+// carries the challenge back in its client data
+type PasskeyChallenge struct {
+	ID int
+	// UserID is zero for a login ceremony
+	UserID        int
+	ChallengeHash string
+	Ceremony      string
+	ExpiresAt     time.Time
+}
+
+// PasskeyRegistration finishes adding a passkey
+type PasskeyRegistration struct {
+	Name       string                        `json:"name" validate:"required,max=64"`
+	Credential webauthn.RegistrationResponse `json:"credential" validate:"required"`
+}
+
+type PasskeyName struct {
+	Name string `json:"name" validate:"required,max=64"`
+}
@@ -10,6 +10,10 @@ type PasswordReset struct {
 }
 
 type PasswordChange struct {
-	Token       string `json:"token"`
-	NewPassword string `json:"new_password"`
+	Token       string `json:"token" validate:"required,max=128"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+type ForgotPassword struct {
+	Email string `json:"email" validate:"required,email,max=254"`
 }
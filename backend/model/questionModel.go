@@ -0,0 +1,87 @@
+package model
+
+import "time"
+
+type Question struct {
+	ID         int         `json:"id"`
+	AuthorID   int         `json:"author_id"`
+	Title      string      `json:"title"`
+	Statement  string      `json:"statement"`
+	Topic      string      `json:"topic"`
+	Difficulty int         `json:"difficulty"`
+	AnswerSpec *AnswerSpec `json:"answer_spec,omitempty"`
+	// Variables turn the question into a template, each user sees their own
+	// values in place of {{name}} in Statement
+	Variables []Variable `json:"variables,omitempty"`
+	// MaxAttempts of zero means unlimited attempts
+	MaxAttempts     int       `json:"max_attempts"`
+	CooldownSeconds int       `json:"cooldown_seconds"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// AnswerSpec describes the expected answer of a question, it is stored as jsonb
+type AnswerSpec struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+	// Formula, when set, computes Value from the question variables
+	Formula string `json:"formula,omitempty"`
+	// SymbolicAnswer, when set, is a reference formula such as "sqrt(2*g*h)"
+	// and submissions are formulas compared to it instead of numbers
+	SymbolicAnswer string `json:"symbolic_answer,omitempty"`
+	// Constants are the symbols of SymbolicAnswer that keep their built-in
+	// value, such as g, the others are variables whatever their name
+	Constants []string `json:"constants,omitempty"`
+	// RelTolerance and AbsTolerance accept an answer within either bound,
+	// when both are zero a relative tolerance of 1% is used
+	RelTolerance float64 `json:"rel_tolerance,omitempty" validate:"min=0"`
+	AbsTolerance float64 `json:"abs_tolerance,omitempty" validate:"min=0"`
+	// SigFigs, when set, is the number of significant figures expected,
+	// SigFigSlack is how many more or fewer are still accepted
+	SigFigs     int `json:"sig_figs,omitempty" validate:"min=0"`
+	SigFigSlack int `json:"sig_fig_slack,omitempty" validate:"min=0"`
+}
+
+// Variable is a template value drawn from Min to Max, in multiples of Step
+// when Step is set, otherwise rounded to Decimals
+type Variable struct {
+	Name     string  `json:"name" validate:"required"`
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+	Step     float64 `json:"step,omitempty"`
+	Decimals int     `json:"decimals,omitempty"`
+}
+
+// Verdict is the result of checking a submitted answer against an AnswerSpec
+type Verdict struct {
+	IsCorrect      bool    `json:"is_correct"`
+	Reason         string  `json:"reason"`
+	Submitted      string  `json:"submitted"`
+	SubmittedValue float64 `json:"submitted_value"`
+	SubmittedUnit  string  `json:"submitted_unit"`
+	// ConvertedValue is the submitted value expressed in the unit of the spec
+	ConvertedValue float64 `json:"converted_value"`
+	RelativeError  float64 `json:"relative_error"`
+	SigFigs        int     `json:"sig_figs"`
+}
+
+const (
+	VerdictReasonCorrect   = "correct"
+	VerdictReasonMalformed = "malformed"
+	VerdictReasonUnit      = "incompatible unit"
+	VerdictReasonSigFigs   = "wrong significant figures"
+	VerdictReasonValue     = "wrong value"
+	VerdictReasonSymbol    = "unknown symbol"
+	VerdictReasonFormula   = "not equivalent"
+)
+
+type QuestionInput struct {
+	Title           string      `json:"title" validate:"required,max=200"`
+	Statement       string      `json:"statement" validate:"required,max=10000"`
+	Topic           string      `json:"topic" validate:"required,max=50"`
+	Difficulty      int         `json:"difficulty" validate:"required,min=1,max=5"`
+	AnswerSpec      *AnswerSpec `json:"answer_spec" validate:"required"`
+	Variables       []Variable  `json:"variables" validate:"max=20"`
+	MaxAttempts     int         `json:"max_attempts" validate:"min=0"`
+	CooldownSeconds int         `json:"cooldown_seconds" validate:"min=0"`
+}
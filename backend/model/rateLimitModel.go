@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// RateLimit is a token bucket holding Burst tokens that refills one token
+// every Every. A bucket is stored as the time it will be full again, so an
+// unknown or old bucket is a full one.
+type RateLimit struct {
+	Burst int
+	Every time.Duration
+}
+
+// Take spends a token of the bucket full at fullAt. It returns when the
+// bucket will be full after that, or how long to wait for a token when there
+// is none left.
+func (l RateLimit) Take(fullAt, now time.Time) (time.Time, time.Duration, bool) {
+	if fullAt.Before(now) {
+		fullAt = now
+	}
+	// each token still missing pushes fullAt one Every into the future
+	retryAfter := fullAt.Sub(now) - time.Duration(l.Burst-1)*l.Every
+	if retryAfter > 0 {
+		return fullAt, retryAfter, false
+	}
+	return fullAt.Add(l.Every), 0, true
+}
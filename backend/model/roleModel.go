@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+const (
+	RoleStudent  = "student"
+	RoleAuthor   = "author"
+	RoleReviewer = "reviewer"
+	RoleAdmin    = "admin"
+)
+
+const (
+	PermCreateQuestion    = "question:create"
+	PermEditAnyQuestion   = "question:edit_any"
+	PermDeleteAnyQuestion = "question:delete_any"
+	PermReviewQuestion    = "question:review"
+	PermManageRoles       = "role:manage"
+	PermManageEmails      = "email:manage"
+)
+
+const (
+	RoleActionGrant  = "grant"
+	RoleActionRevoke = "revoke"
+)
+
+type RoleAudit struct {
+	ID           int       `json:"id"`
+	ActorID      int       `json:"actor_id"`
+	TargetUserID int       `json:"target_user_id"`
+	RoleName     string    `json:"role_name"`
+	Action       string    `json:"action"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type RoleChange struct {
+	Role string `json:"role" validate:"required,oneof=student author reviewer admin"`
+}
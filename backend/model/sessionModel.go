@@ -1,7 +1,37 @@
 package model
 
+import "time"
+
 type Session struct {
-	ID        int    `json:"-"`
-	UserID    int    `json:"user_id"`
-	TokenHash string `json:"token_hash"`
+	ID                int       `json:"-"`
+	UserID            int       `json:"user_id"`
+	TokenHash         string    `json:"token_hash"`
+	CreatedAt         time.Time `json:"created_at"`
+	LastSeenAt        time.Time `json:"last_seen_at"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	AbsoluteExpiresAt time.Time `json:"absolute_expires_at"`
+	// UserAgent and IP are of the request that logged in
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+}
+
+// SessionDevice is a session as its user sees it in the session list
+type SessionDevice struct {
+	ID         int       `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Current is the session the list was asked with
+	Current bool `json:"current"`
+}
+
+type SessionCheck struct {
+	Token string `json:"token" validate:"required,max=128"`
+}
+
+// IsExpired reports whether the session passed its idle or absolute expiry
+func (s Session) IsExpired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt) || !now.Before(s.AbsoluteExpiresAt)
 }
@@ -0,0 +1,49 @@
+package model
+
+import "time"
+
+type Submission struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	QuestionID int       `json:"question_id"`
+	Answer     string    `json:"answer"`
+	Verdict    Verdict   `json:"verdict"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// StudentSubmission is a submission as shown to the student who made it, the
+// verdict leaves out how far off the answer was so it does not give away the
+// expected value
+type StudentSubmission struct {
+	ID         int            `json:"id"`
+	QuestionID int            `json:"question_id"`
+	Answer     string         `json:"answer"`
+	Verdict    StudentVerdict `json:"verdict"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+type StudentVerdict struct {
+	IsCorrect bool   `json:"is_correct"`
+	Reason    string `json:"reason"`
+}
+
+// ForStudent returns what the student who made s may see of it
+func (s Submission) ForStudent() StudentSubmission {
+	return StudentSubmission{
+		ID:         s.ID,
+		QuestionID: s.QuestionID,
+		Answer:     s.Answer,
+		Verdict:    StudentVerdict{IsCorrect: s.Verdict.IsCorrect, Reason: s.Verdict.Reason},
+		CreatedAt:  s.CreatedAt,
+	}
+}
+
+type SubmissionInput struct {
+	Answer string `json:"answer" validate:"required,max=500"`
+}
+
+// AttemptStats summarizes the previous submissions of a user to one question
+type AttemptStats struct {
+	Count         int
+	LastAttemptAt time.Time
+}
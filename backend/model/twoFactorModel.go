@@ -0,0 +1,55 @@
+package model
+
+import "time"
+
+// TOTP is the authenticator app enrolment of a user, it only guards logins
+// once ConfirmedAt is set
+type TOTP struct {
+	UserID      int
+	Secret      string
+	ConfirmedAt time.Time
+	// LastUsedStep is the time step of the last accepted code, codes of it and
+	// earlier steps are refused
+	LastUsedStep int64
+}
+
+// IsConfirmed reports whether a code from the app was checked after enrolment
+func (t TOTP) IsConfirmed() bool {
+	return !t.ConfirmedAt.IsZero()
+}
+
+// RecoveryCode stands in for the app once, only its hash is stored
+type RecoveryCode struct {
+	ID       int
+	UserID   int
+	CodeHash string
+	UsedAt   time.Time
+}
+
+// LoginChallenge is the first step of a two-factor login, it proves the
+// password was right until it expires
+type LoginChallenge struct {
+	ID        int
+	UserID    int
+	TokenHash string
+	ExpiresAt time.Time
+	Attempts  int
+}
+
+// TOTPEnrolment is what an authenticator app needs to add the account
+type TOTPEnrolment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TOTPCode struct {
+	Code string `json:"code" validate:"required,max=10"`
+}
+
+// LoginSecondFactor finishes a login with either a code from the app or a
+// recovery code
+type LoginSecondFactor struct {
+	ChallengeToken string `json:"challenge_token" validate:"required,max=128"`
+	Code           string `json:"code" validate:"max=10"`
+	RecoveryCode   string `json:"recovery_code" validate:"max=32"`
+}
@@ -1,14 +1,43 @@
 package model
 
+import "time"
+
 type User struct {
-	ID           int    `json:"id"`
-	Email        string `json:"email"`
-	PasswordHash string `json:"-"`
-	IsVerified   bool   `json:"is_verified"`
-	Role         string `json:"role"`
+	ID           int      `json:"id"`
+	Email        string   `json:"email"`
+	PasswordHash string   `json:"-"`
+	IsVerified   bool     `json:"is_verified"`
+	Roles        []string `json:"roles"`
+	// FailedLogins counts wrong passwords since the last successful login,
+	// LockedUntil is zero when the account is not locked
+	FailedLogins int       `json:"-"`
+	LockedUntil  time.Time `json:"-"`
+}
+
+// IsLocked reports whether logins are refused after too many failures
+func (u User) IsLocked(now time.Time) bool {
+	return now.Before(u.LockedUntil)
+}
+
+// HasRole reports whether the user holds the role
+func (u User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
 }
 
 type RegisterUser struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required"`
+}
+
+// LoginUser only requires the password, so accounts from before the password
+// policy can still log in. bcrypt compares only the first 72 bytes, a longer
+// password would log in with anything after them.
+type LoginUser struct {
+	Email    string `json:"email" validate:"required,max=254"`
+	Password string `json:"password" validate:"required,maxbytes=72"`
 }
@@ -0,0 +1,205 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// minRSABits is the smallest RSA modulus accepted
+const minRSABits = 2048
+
+// publicKey is a key of the provider with the algorithm it signs with
+type publicKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// verifySignature checks the JWS signature of a compact token and returns its payload
+func (p *Provider) verifySignature(ctx context.Context, token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, verificationError("id token is not a compact JWS")
+	}
+	rawHeader, err1 := encoding.DecodeString(parts[0])
+	payload, err2 := encoding.DecodeString(parts[1])
+	sig, err3 := encoding.DecodeString(parts[2])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, verificationError("id token is not base64url")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	err := json.Unmarshal(rawHeader, &header)
+	if err != nil {
+		return nil, verificationError("id token header is not valid JSON")
+	}
+	// only asymmetric algorithms, so neither "none" nor a MAC keyed with a
+	// public key gets through
+	if header.Alg != "RS256" && header.Alg != "ES256" {
+		return nil, verificationError("id token algorithm %q is not supported", header.Alg)
+	}
+
+	key, err := p.key(ctx, header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !key.verify(digest[:], sig) {
+		return nil, verificationError("id token signature is invalid")
+	}
+	return payload, nil
+}
+
+func (k publicKey) verify(digest, sig []byte) bool {
+	switch key := k.key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig) == nil
+	case *ecdsa.PublicKey:
+		// JWS ES256 signatures are r and s side by side, not ASN.1
+		if len(sig) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(key, digest, r, s)
+	}
+	return false
+}
+
+// key finds the signing key kid for alg, fetching the key set again when it
+// is not known, at most once per keysRefreshInterval
+func (p *Provider) key(ctx context.Context, kid, alg string) (publicKey, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return publicKey{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key, ok := p.findKey(kid, alg)
+	if ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < keysRefreshInterval {
+		return publicKey{}, verificationError("id token key %q is unknown", kid)
+	}
+
+	keys, err := p.fetchKeys(ctx, md.JWKSURI)
+	if err != nil {
+		return publicKey{}, err
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+	key, ok = p.findKey(kid, alg)
+	if !ok {
+		return publicKey{}, verificationError("id token key %q is unknown", kid)
+	}
+	return key, nil
+}
+
+// findKey looks kid up, a token without kid may use the only key of its algorithm
+func (p *Provider) findKey(kid, alg string) (publicKey, bool) {
+	if kid != "" {
+		key, ok := p.keys[kid]
+		return key, ok && key.alg == alg
+	}
+	var found []publicKey
+	for _, key := range p.keys {
+		if key.alg == alg {
+			found = append(found, key)
+		}
+	}
+	if len(found) != 1 {
+		return publicKey{}, false
+	}
+	return found[0], true
+}
+
+func (p *Provider) fetchKeys(ctx context.Context, jwksURI string) (map[string]publicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("building jwks request: %w", err)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	status, err := p.do(req, &set)
+	if err != nil {
+		return nil, fmt.Errorf("fetching jwks: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("fetching jwks: answered %d", status)
+	}
+
+	keys := map[string]publicKey{}
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, ok := parseJWK(k)
+		if !ok {
+			// a key we can't use doesn't stop the others from working
+			continue
+		}
+		kid := k.Kid
+		if kid == "" {
+			kid = fmt.Sprintf("#%d", i)
+		}
+		keys[kid] = key
+	}
+	return keys, nil
+}
+
+func parseJWK(k jwk) (publicKey, bool) {
+	switch {
+	case k.Kty == "RSA" && (k.Alg == "" || k.Alg == "RS256"):
+		n, errN := encoding.DecodeString(k.N)
+		e, errE := encoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) > 4 {
+			return publicKey{}, false
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < minRSABits || key.E < 3 {
+			return publicKey{}, false
+		}
+		return publicKey{alg: "RS256", key: key}, true
+
+	case k.Kty == "EC" && k.Crv == "P-256" && (k.Alg == "" || k.Alg == "ES256"):
+		x, errX := encoding.DecodeString(k.X)
+		y, errY := encoding.DecodeString(k.Y)
+		if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+			return publicKey{}, false
+		}
+		// ecdh checks the point is on the curve
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return publicKey{}, false
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		return publicKey{alg: "ES256", key: key}, true
+	}
+	return publicKey{}, false
+}
@@ -0,0 +1,308 @@
+// Package oidc is an OpenID Connect relying party for the authorization code
+// flow with PKCE. A Provider discovers the endpoints of its issuer, builds the
+// authorization URL, exchanges the code and verifies the ID token against the
+// issuer's published keys.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxResponseBytes bounds what is read from the provider
+	maxResponseBytes = 1 << 20
+	// leeway allows for clock drift between us and the provider
+	leeway = time.Minute
+	// keysRefreshInterval is the least time between two JWKS fetches, an
+	// unknown key id makes a fetch when it has passed
+	keysRefreshInterval = time.Minute
+	// randomBytes is the length of states, nonces and PKCE verifiers
+	randomBytes = 32
+)
+
+// ErrVerification is wrapped by every error about a response or ID token
+// that doesn't check out, as opposed to the provider being unreachable
+var ErrVerification = errors.New("oidc verification failed")
+
+var encoding = base64.RawURLEncoding
+
+// Config is what a provider registered this client with
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes are asked for besides openid
+	Scopes []string
+}
+
+// Claims are the ID token claims a login uses
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	AuthorizedBy  string   `json:"azp"`
+	Expiry        int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified flexBool `json:"email_verified"`
+	Name          string   `json:"name"`
+}
+
+// audience is a single string or a list of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	err := json.Unmarshal(data, &list)
+	if err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// flexBool is a boolean some providers send as a string
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case `true`, `"true"`:
+		*b = true
+	case `false`, `"false"`, `null`:
+		*b = false
+	default:
+		return fmt.Errorf("%s is not a boolean", data)
+	}
+	return nil
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider talks to one issuer. Its endpoints and keys are fetched when
+// first needed, so a provider that is down doesn't stop the app starting.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu          sync.Mutex
+	metadata    *metadata
+	keys        map[string]publicKey
+	keysFetched time.Time
+}
+
+// NewProvider returns a provider for config, requests use client
+func NewProvider(config Config, client *http.Client) *Provider {
+	return &Provider{config: config, client: client}
+}
+
+// Random returns a random base64url value for a state, nonce or PKCE verifier
+func Random() (string, error) {
+	b := make([]byte, randomBytes)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("generating random value: %w", err)
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// AuthCodeURL is where the browser is sent to log in at the provider. The
+// provider sends it back to the redirect URL with state and a code, verifier
+// is kept to redeem the code and nonce comes back in the ID token.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, p.config.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {encoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(md.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return md.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Login redeems code with verifier and returns the claims of the verified ID
+// token, whose nonce must be nonce
+func (p *Provider) Login(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	rawIDToken, err := p.exchange(ctx, code, verifier)
+	if err != nil {
+		return nil, err
+	}
+	return p.VerifyIDToken(ctx, rawIDToken, nonce)
+}
+
+// exchange redeems an authorization code at the token endpoint and returns the ID token
+func (p *Provider) exchange(ctx context.Context, code, verifier string) (string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if p.config.ClientSecret == "" {
+		form.Set("client_id", p.config.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("building token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		// client_secret_basic, the id and secret are form encoded first
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		TokenType        string `json:"token_type"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.do(req, &tokens)
+	if err != nil {
+		return "", fmt.Errorf("redeeming code: %w", err)
+	}
+	if tokens.Error != "" {
+		// invalid_grant and friends are about the code the client sent
+		return "", fmt.Errorf("%w: token endpoint: %s %s", ErrVerification, tokens.Error, tokens.ErrorDescription)
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("redeeming code: token endpoint answered %d", status)
+	}
+	if tokens.IDToken == "" {
+		return "", fmt.Errorf("%w: token response has no id_token", ErrVerification)
+	}
+	return tokens.IDToken, nil
+}
+
+// VerifyIDToken checks the signature and claims of an ID token issued to this
+// client with nonce
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := p.verifySignature(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return nil, verificationError("id token claims are not valid JSON")
+	}
+	now := time.Now()
+	switch {
+	case claims.Issuer != md.Issuer:
+		return nil, verificationError("id token issuer is %q", claims.Issuer)
+	case claims.Subject == "":
+		return nil, verificationError("id token has no subject")
+	case !slices.Contains(claims.Audience, p.config.ClientID):
+		return nil, verificationError("id token is for another client")
+	case len(claims.Audience) > 1 && claims.AuthorizedBy != p.config.ClientID:
+		return nil, verificationError("id token is authorized for another client")
+	case !now.Before(time.Unix(claims.Expiry, 0).Add(leeway)):
+		return nil, verificationError("id token expired")
+	case time.Unix(claims.IssuedAt, 0).After(now.Add(leeway)):
+		return nil, verificationError("id token is issued in the future")
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, verificationError("id token nonce doesn't match")
+	}
+	return &claims, nil
+}
+
+// discover fetches the provider metadata once
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	wellKnown := strings.TrimRight(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, fmt.Errorf("building discovery request: %w", err)
+	}
+	var md metadata
+	status, err := p.do(req, &md)
+	if err != nil {
+		return nil, fmt.Errorf("discovering provider: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("discovering provider: answered %d", status)
+	}
+	// the issuer must be the one configured, or any provider could mint tokens for it
+	if md.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("discovering provider: issuer is %q, want %q", md.Issuer, p.config.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, errors.New("discovering provider: metadata misses an endpoint")
+	}
+	p.metadata = &md
+	return p.metadata, nil
+}
+
+// do sends req and decodes the JSON answer into v whatever the status
+func (p *Provider) do(req *http.Request, v any) (int, error) {
+	res, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxResponseBytes))
+	if err != nil {
+		return 0, fmt.Errorf("reading response: %w", err)
+	}
+	err = json.Unmarshal(body, v)
+	if err != nil && res.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("decoding response: %w", err)
+	}
+	return res.StatusCode, nil
+}
+
+func verificationError(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrVerification, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,113 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"net/mail"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/mailer"
+	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/repo"
+)
+
+const (
+	// MaxAttempts is how many sends fail before an email is dead-lettered
+	MaxAttempts = 8
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 2 * time.Hour
+	// lease is how long a claimed email is hidden from other workers
+	lease     = 5 * time.Minute
+	batchSize = 20
+	// batchTimeout bounds claiming and sending one batch
+	batchTimeout = 2 * time.Minute
+)
+
+// Worker sends queued emails from email_outbox
+type Worker struct {
+	obr    repo.OutboxStore
+	mailer mailer.Mailer
+}
+
+func NewWorker(obr repo.OutboxStore, m mailer.Mailer) *Worker {
+	return &Worker{obr: obr, mailer: m}
+}
+
+// FromMessage turns a rendered message into an outbox row
+func FromMessage(msg mailer.Message) model.OutboxEmail {
+	return model.OutboxEmail{
+		ToAddress: msg.To.Address,
+		Subject:   msg.Subject,
+		TextBody:  msg.Text,
+		HTMLBody:  msg.HTML,
+	}
+}
+
+func toMessage(email model.OutboxEmail) mailer.Message {
+	return mailer.Message{
+		From:    mailer.DefaultFrom(),
+		To:      mail.Address{Address: email.ToAddress},
+		Subject: email.Subject,
+		Text:    email.TextBody,
+		HTML:    email.HTMLBody,
+	}
+}
+
+// Backoff doubles the wait after every failed attempt, up to maxBackoff
+func Backoff(attempts int) time.Duration {
+	backoff := baseBackoff
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxBackoff)
+}
+
+// Run sends due emails every interval until ctx is done
+func (w Worker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for {
+			batchCtx, cancel := context.WithTimeout(ctx, batchTimeout)
+			sent := w.SendDue(batchCtx)
+			cancel()
+			if sent < batchSize {
+				break
+			}
+		}
+	}
+}
+
+// SendDue sends one batch of due emails and returns how many were claimed
+func (w Worker) SendDue(ctx context.Context) int {
+	emails, err := w.obr.ClaimDue(ctx, batchSize, lease)
+	if err != nil {
+		log.Printf("claiming due emails: %s", err)
+		return 0
+	}
+	for _, email := range emails {
+		err = w.mailer.Send(toMessage(email))
+		if err == nil {
+			err = w.obr.MarkSent(ctx, email.ID)
+			if err != nil {
+				log.Printf("marking email %d sent: %s", email.ID, err)
+			}
+			continue
+		}
+
+		log.Printf("sending email %d, attempt %d: %s", email.ID, email.Attempts+1, err)
+		if email.Attempts+1 >= MaxAttempts {
+			log.Printf("email %d dead-lettered after %d attempts", email.ID, MaxAttempts)
+		}
+		err = w.obr.MarkFailed(ctx, email.ID, err, Backoff(email.Attempts+1), MaxAttempts)
+		if err != nil {
+			log.Printf("marking email %d failed: %s", email.ID, err)
+		}
+	}
+	return len(emails)
+}
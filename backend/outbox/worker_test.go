@@ -0,0 +1,169 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/mailer"
+	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/outbox"
+	"github.com/suryasaputra2016/course/backend/repo"
+	"github.com/suryasaputra2016/course/backend/repo/memory"
+)
+
+// flakyMailer fails its first failures sends, then delivers to a MemoryMailer
+type flakyMailer struct {
+	failures  int
+	delivered *mailer.MemoryMailer
+}
+
+func (fm *flakyMailer) Send(msg mailer.Message) error {
+	if fm.failures > 0 {
+		fm.failures--
+		return errors.New("connection refused")
+	}
+	return fm.delivered.Send(msg)
+}
+
+// noWait records the backoff the worker asks for and stores the retry as due
+// at once, so a test can run every attempt without waiting for it
+type noWait struct {
+	repo.OutboxStore
+	backoffs []time.Duration
+}
+
+func (nw *noWait) MarkFailed(ctx context.Context, id int, sendErr error, backoff time.Duration, maxAttempts int) error {
+	nw.backoffs = append(nw.backoffs, backoff)
+	return nw.OutboxStore.MarkFailed(ctx, id, sendErr, 0, maxAttempts)
+}
+
+func enqueue(t *testing.T, store repo.OutboxStore) model.OutboxEmail {
+	t.Helper()
+	email := model.OutboxEmail{ToAddress: "ada@example.com", Subject: "Verify your email", TextBody: "link", HTMLBody: "<p>link</p>"}
+	err := store.Enqueue(context.Background(), &email)
+	if err != nil {
+		t.Fatalf("enqueuing email: %s", err)
+	}
+	return email
+}
+
+func stored(t *testing.T, store repo.OutboxStore, id int) model.OutboxEmail {
+	t.Helper()
+	emails, err := store.List(context.Background(), "", 100, 0)
+	if err != nil {
+		t.Fatalf("listing emails: %s", err)
+	}
+	for _, email := range emails {
+		if email.ID == id {
+			return email
+		}
+	}
+	t.Fatalf("email %d is gone", id)
+	return model.OutboxEmail{}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		3:  2 * time.Minute,
+		8:  64 * time.Minute,
+		9:  2 * time.Hour,
+		50: 2 * time.Hour,
+	}
+	for attempts, want := range tests {
+		if got := outbox.Backoff(attempts); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
+
+func TestSendDueSends(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New().Repos().Outbox
+	delivered := mailer.NewMemoryMailer()
+	email := enqueue(t, store)
+
+	if claimed := outbox.NewWorker(store, delivered).SendDue(ctx); claimed != 1 {
+		t.Fatalf("SendDue claimed %d emails, want 1", claimed)
+	}
+	messages := delivered.Messages()
+	if len(messages) != 1 || messages[0].To.Address != "ada@example.com" || messages[0].Subject != email.Subject ||
+		messages[0].Text != "link" || messages[0].HTML != "<p>link</p>" {
+		t.Fatalf("delivered = %+v, want the queued email", messages)
+	}
+	sent := stored(t, store, email.ID)
+	if sent.Status != model.OutboxStatusSent || sent.Attempts != 1 || sent.SentAt == nil {
+		t.Errorf("email after sending = %+v, want sent after one attempt", sent)
+	}
+}
+
+func TestSendDueRetriesAfterBackoff(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New().Repos().Outbox
+	flaky := &flakyMailer{failures: 1, delivered: mailer.NewMemoryMailer()}
+	worker := outbox.NewWorker(store, flaky)
+	email := enqueue(t, store)
+
+	before := time.Now()
+	worker.SendDue(ctx)
+	after := time.Now()
+	failed := stored(t, store, email.ID)
+	if failed.Status != model.OutboxStatusPending || failed.Attempts != 1 || failed.LastError == "" {
+		t.Fatalf("email after a failure = %+v, want pending with one attempt and the error", failed)
+	}
+	backoff := outbox.Backoff(1)
+	if failed.NextAttemptAt.Before(before.Add(backoff)) || failed.NextAttemptAt.After(after.Add(backoff)) {
+		t.Errorf("next attempt at %s, want %s after the failure", failed.NextAttemptAt, backoff)
+	}
+	if claimed := worker.SendDue(ctx); claimed != 0 {
+		t.Errorf("SendDue during the backoff claimed %d emails, want 0", claimed)
+	}
+}
+
+func TestSendDueDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	store := &noWait{OutboxStore: memory.New().Repos().Outbox}
+	flaky := &flakyMailer{failures: outbox.MaxAttempts, delivered: mailer.NewMemoryMailer()}
+	worker := outbox.NewWorker(store, flaky)
+	email := enqueue(t, store)
+
+	for attempt := 1; attempt <= outbox.MaxAttempts; attempt++ {
+		if claimed := worker.SendDue(ctx); claimed != 1 {
+			t.Fatalf("attempt %d claimed %d emails, want 1", attempt, claimed)
+		}
+		got := stored(t, store, email.ID)
+		if got.Attempts != attempt {
+			t.Fatalf("attempts after attempt %d = %d", attempt, got.Attempts)
+		}
+		if store.backoffs[attempt-1] != outbox.Backoff(attempt) {
+			t.Errorf("backoff after attempt %d = %s, want %s", attempt, store.backoffs[attempt-1], outbox.Backoff(attempt))
+		}
+		wantStatus := model.OutboxStatusPending
+		if attempt == outbox.MaxAttempts {
+			wantStatus = model.OutboxStatusDead
+		}
+		if got.Status != wantStatus {
+			t.Errorf("status after attempt %d = %s, want %s", attempt, got.Status, wantStatus)
+		}
+	}
+
+	if claimed := worker.SendDue(ctx); claimed != 0 {
+		t.Errorf("SendDue claimed %d dead emails, want 0", claimed)
+	}
+	if len(flaky.delivered.Messages()) != 0 {
+		t.Error("a dead email was delivered")
+	}
+
+	// once requeued by an admin, a dead email is tried afresh
+	err := store.Requeue(ctx, email.ID)
+	if err != nil {
+		t.Fatalf("requeue = %v", err)
+	}
+	worker.SendDue(ctx)
+	if got := stored(t, store, email.ID); got.Status != model.OutboxStatusSent || got.Attempts != 1 {
+		t.Errorf("requeued email = %+v, want sent on its first new attempt", got)
+	}
+}
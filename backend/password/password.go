@@ -0,0 +1,138 @@
+// Package password checks new passwords against the password policy and a
+// list of passwords known from breaches.
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/config"
+)
+
+// prefixLength is how many hex digits of a hash are used to look up its range,
+// the same split the k-anonymity breach APIs use
+const prefixLength = 5
+
+//go:embed breached.txt
+var bundledList string
+
+// RangeSource returns the hash suffixes of breached passwords whose SHA-1
+// starts with prefix, so the full hash of a password never has to leave the
+// process when the source is remote
+type RangeSource interface {
+	Range(prefix string) ([]string, error)
+}
+
+// Bundled is the breached password list shipped with the binary
+type Bundled map[string][]string
+
+// LoadBundled groups the embedded list of hashes by prefix
+func LoadBundled() (Bundled, error) {
+	ranges := Bundled{}
+	scanner := bufio.NewScanner(strings.NewReader(bundledList))
+	for line := 1; scanner.Scan(); line++ {
+		hash := strings.TrimSpace(scanner.Text())
+		if hash == "" || strings.HasPrefix(hash, "#") {
+			continue
+		}
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("loading breached passwords: line %d is not a SHA-1 hash", line)
+		}
+		hash = strings.ToUpper(hash)
+		ranges[hash[:prefixLength]] = append(ranges[hash[:prefixLength]], hash[prefixLength:])
+	}
+	err := scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("loading breached passwords: %w", err)
+	}
+	return ranges, nil
+}
+
+func (b Bundled) Range(prefix string) ([]string, error) {
+	return b[prefix], nil
+}
+
+type Checker struct {
+	policy   config.PasswordPolicy
+	breached RangeSource
+}
+
+// NewChecker returns a checker for policy, breached is only asked when the
+// policy rejects breached passwords
+func NewChecker(policy config.PasswordPolicy, breached RangeSource) *Checker {
+	return &Checker{
+		policy:   policy,
+		breached: breached,
+	}
+}
+
+// Check returns an apperr validation error on field listing every rule
+// password breaks, email is the address of the account it is for
+func (c *Checker) Check(field, password, email string) error {
+	var invalid apperr.FieldErrors
+	if utf8.RuneCountInString(password) < c.policy.MinLength {
+		invalid.Add(field, fmt.Sprintf("must be at least %d characters long", c.policy.MinLength))
+	}
+	if len(password) > c.policy.MaxBytes {
+		invalid.Add(field, fmt.Sprintf("must be at most %d bytes long", c.policy.MaxBytes))
+	}
+	if classes(password) < c.policy.MinClasses {
+		invalid.Add(field, fmt.Sprintf("must mix at least %d of lowercase letters, uppercase letters, digits and symbols", c.policy.MinClasses))
+	}
+	localPart, _, _ := strings.Cut(email, "@")
+	if email != "" && (strings.EqualFold(password, email) || strings.EqualFold(password, localPart)) {
+		invalid.Add(field, "must not be the email address")
+	}
+	if c.policy.RejectBreached {
+		breached, err := c.isBreached(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			invalid.Add(field, "appears in a list of breached passwords, choose another one")
+		}
+	}
+	return invalid.Err()
+}
+
+func (c *Checker) isBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	suffixes, err := c.breached.Range(hash[:prefixLength])
+	if err != nil {
+		return false, fmt.Errorf("checking breached passwords: %w", err)
+	}
+	return slices.Contains(suffixes, hash[prefixLength:]), nil
+}
+
+// classes counts which of lowercase, uppercase, digits and symbols password uses
+func classes(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	count := 0
+	for _, used := range []bool{lower, upper, digit, symbol} {
+		if used {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,49 @@
+package password
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/config"
+)
+
+func TestCheck(t *testing.T) {
+	breached, err := LoadBundled()
+	if err != nil {
+		t.Fatalf("loading breached passwords: %s", err)
+	}
+	checker := NewChecker(config.PasswordPolicy{MinLength: 8, MaxBytes: 72, MinClasses: 2, RejectBreached: true}, breached)
+
+	tests := []struct {
+		name     string
+		password string
+		problems int
+	}{
+		{"good", "correct-horse-battery", 0},
+		{"too short", "ab-1", 1},
+		{"too long", string(make([]byte, 40)) + "ééééééééééééééééééé", 1},
+		{"one class", "correcthorsebattery", 1},
+		{"email", "Ada@Example.com", 1},
+		{"breached", "Password1", 1},
+		{"short and one class", "abc", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checker.Check("password", tt.password, "ada@example.com")
+			if tt.problems == 0 {
+				if err != nil {
+					t.Fatalf("Check(%q) = %v, want nil", tt.password, err)
+				}
+				return
+			}
+			var appErr *apperr.Error
+			if !errors.As(err, &appErr) || !errors.Is(err, apperr.ErrValidation) {
+				t.Fatalf("Check(%q) = %v, want a validation error", tt.password, err)
+			}
+			if len(appErr.Fields) != tt.problems {
+				t.Errorf("Check(%q) fields = %+v, want %d", tt.password, appErr.Fields, tt.problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+// Package problem writes errors as RFC 7807 problem details
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+)
+
+const contentType = "application/problem+json"
+
+// Problem is the body of every error response
+type Problem struct {
+	Type     string              `json:"type"`
+	Title    string              `json:"title"`
+	Status   int                 `json:"status"`
+	Detail   string              `json:"detail,omitempty"`
+	Instance string              `json:"instance,omitempty"`
+	Errors   []apperr.FieldError `json:"errors,omitempty"`
+}
+
+// statuses maps each kind of domain error to its http status
+var statuses = []struct {
+	kind   error
+	status int
+}{
+	{apperr.ErrValidation, http.StatusBadRequest},
+	{apperr.ErrUnauthorized, http.StatusUnauthorized},
+	{apperr.ErrForbidden, http.StatusForbidden},
+	{apperr.ErrNotFound, http.StatusNotFound},
+	{apperr.ErrConflict, http.StatusConflict},
+	{apperr.ErrRateLimited, http.StatusTooManyRequests},
+}
+
+// Status returns the http status of err, 500 for anything that is not a domain error
+func Status(err error) int {
+	for _, s := range statuses {
+		if errors.Is(err, s.kind) {
+			return s.status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// From builds the problem of err. Only the message and fields of an
+// apperr.Error reach the client, any other text of err stays in the log.
+func From(err error, r *http.Request) Problem {
+	status := Status(err)
+	p := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Instance: r.URL.Path,
+	}
+	var appErr *apperr.Error
+	if errors.As(err, &appErr) {
+		p.Detail = appErr.Message
+		p.Errors = appErr.Fields
+	}
+	return p
+}
+
+// Write logs err and responds with its problem
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	p := From(err, r)
+	log.Printf("%s %s: %d %s", r.Method, r.URL.Path, p.Status, err)
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	err = json.NewEncoder(w).Encode(p)
+	if err != nil {
+		log.Printf("encoding problem: %s", err)
+	}
+}
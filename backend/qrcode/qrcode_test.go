@@ -0,0 +1,165 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestErrorCorrection checks the 1-M example of the standard, HELLO WORLD in
+// alphanumeric mode, against its published error correction codewords
+func TestErrorCorrection(t *testing.T) {
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	got := rsRemainder(data, rsDivisor(layouts[1].eccPerBlock))
+	if !slices.Equal(got, want) {
+		t.Errorf("error correction = %v, want %v", got, want)
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	c := newCode(7)
+	c.drawFunctionPatterns(7)
+	c.drawFormat(0)
+
+	// the first copy runs along row 8 left of the timing pattern and then up column 8
+	var format strings.Builder
+	for _, p := range [][2]int{{0, 8}, {1, 8}, {2, 8}, {3, 8}, {4, 8}, {5, 8}, {7, 8}, {8, 8}, {8, 7}, {8, 5}, {8, 4}, {8, 3}, {8, 2}, {8, 1}, {8, 0}} {
+		format.WriteString(moduleBit(c, p[0], p[1]))
+	}
+	if got := format.String(); got != "101010000010010" {
+		t.Errorf("format bits of level M mask 0 = %s, want 101010000010010", got)
+	}
+
+	// the version block below the top right finder, read from its last module
+	var version strings.Builder
+	for i := 17; i >= 0; i-- {
+		version.WriteString(moduleBit(c, c.Size-11+i%3, i/3))
+	}
+	if got := version.String(); got != "000111110010010100" {
+		t.Errorf("version 7 bits = %s, want 000111110010010100", got)
+	}
+}
+
+func moduleBit(c *Code, x, y int) string {
+	if c.Dark(x, y) {
+		return "1"
+	}
+	return "0"
+}
+
+func TestNew(t *testing.T) {
+	uri := "otpauth://totp/Course:ada%40example.com?secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP&issuer=Course&algorithm=SHA1&digits=6&period=30"
+	c, err := New(uri)
+	if err != nil {
+		t.Fatalf("New: %s", err)
+	}
+	// 127 bytes are more than the 122 of version 7
+	if c.Size != 4*8+17 {
+		t.Errorf("size = %d, want version 8", c.Size)
+	}
+	if got := decode(t, c, 8); got != uri {
+		t.Errorf("decoded %q, want %q", got, uri)
+	}
+
+	encoded, err := c.PNG(4)
+	if err != nil {
+		t.Fatalf("PNG: %s", err)
+	}
+	img, err := png.Decode(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("decoding png: %s", err)
+	}
+	if side := (c.Size + 2*quietZone) * 4; img.Bounds().Dx() != side {
+		t.Errorf("png width = %d, want %d", img.Bounds().Dx(), side)
+	}
+
+	_, err = New(strings.Repeat("a", 214))
+	if err == nil {
+		t.Error("New with 214 bytes succeeded, want too long")
+	}
+}
+
+// decode reads c back the way a scanner would: the mask from the format bits,
+// the codewords in zigzag order, and the text from the checked data blocks
+func decode(t *testing.T, c *Code, version int) string {
+	t.Helper()
+	format := 0
+	for i := range 15 {
+		var dark bool
+		switch {
+		case i < 6:
+			dark = c.Dark(8, i)
+		case i < 8:
+			dark = c.Dark(8, i+1)
+		case i == 8:
+			dark = c.Dark(7, 8)
+		default:
+			dark = c.Dark(14-i, 8)
+		}
+		if dark {
+			format |= 1 << i
+		}
+	}
+	format ^= 0x5412
+	if format>>13 != 0 {
+		t.Fatalf("format bits %015b are not level M", format)
+	}
+	mask := format >> 10 & 7
+
+	// a copy without data, to tell which modules are function modules
+	plain := newCode(version)
+	plain.drawFunctionPatterns(version)
+	var bits bitBuffer
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := range c.Size {
+			for j := range 2 {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert
+				}
+				if !plain.function[y][x] {
+					bits = append(bits, c.Dark(x, y) != masks[mask](x, y))
+				}
+			}
+		}
+	}
+	codewords := bits[:len(bits)/8*8].bytes()
+
+	layout := layouts[version]
+	blocks := make([][]byte, len(layout.dataPerBlock))
+	for i := range layout.dataPerBlock[len(layout.dataPerBlock)-1] {
+		for b, n := range layout.dataPerBlock {
+			if i < n {
+				blocks[b] = append(blocks[b], codewords[0])
+				codewords = codewords[1:]
+			}
+		}
+	}
+	var data []byte
+	for b, block := range blocks {
+		ecc := make([]byte, layout.eccPerBlock)
+		for i := range ecc {
+			ecc[i] = codewords[i*len(blocks)+b]
+		}
+		if want := rsRemainder(block, rsDivisor(layout.eccPerBlock)); !slices.Equal(ecc, want) {
+			t.Fatalf("block %d error correction = %v, want %v", b, ecc, want)
+		}
+		data = append(data, block...)
+	}
+
+	if data[0]>>4 != 0b0100 {
+		t.Fatalf("mode = %04b, want byte mode", data[0]>>4)
+	}
+	length := int(data[0]&0xF)<<4 | int(data[1]>>4)
+	text := make([]byte, length)
+	for i := range text {
+		text[i] = data[1+i]<<4 | data[2+i]>>4
+	}
+	return string(text)
+}
@@ -0,0 +1,47 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+// BootstrapAdmin grants the admin role to the verified user with email when
+// nobody holds it yet, so a fresh install gets its first admin. It reports
+// whether the role was granted, a missing or unverified user is not an error
+// since the owner may not have signed up yet.
+func BootstrapAdmin(ctx context.Context, uow Transactor, email string) (bool, error) {
+	granted := false
+	err := uow.Do(ctx, func(tx Repos) error {
+		admins, err := tx.Roles.CountHolders(ctx, model.RoleAdmin)
+		if err != nil {
+			return err
+		}
+		if admins > 0 {
+			return nil
+		}
+		user, err := tx.Users.GetByEmail(ctx, email)
+		if errors.Is(err, apperr.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !user.IsVerified {
+			return nil
+		}
+		err = tx.Roles.Grant(ctx, user.ID, model.RoleAdmin, 0)
+		if err != nil {
+			return err
+		}
+		granted = true
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("bootstrapping admin: %w", err)
+	}
+	return granted, nil
+}
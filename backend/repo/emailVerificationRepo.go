@@ -0,0 +1,87 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+// VerificationSendWindow is the period over which verification sends are counted
+const VerificationSendWindow = 24 * time.Hour
+
+type EmailVerificationRepo struct {
+	db DBTX
+}
+
+func NewEmailVerificationRepo(db *sql.DB) *EmailVerificationRepo {
+	return &EmailVerificationRepo{db: db}
+}
+
+// Upsert stores a new token for the user, replacing any previous one and
+// counting the send within the current window
+func (evr EmailVerificationRepo) Upsert(ctx context.Context, evPtr *model.EmailVerification) error {
+	queryStr := `
+		INSERT INTO email_verifications (user_id, token_hash, expiration_time)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET token_hash = EXCLUDED.token_hash,
+			expiration_time = EXCLUDED.expiration_time,
+			last_sent_at = NOW(),
+			sent_count = CASE
+				WHEN email_verifications.window_started_at < NOW() - $4 * INTERVAL '1 second' THEN 1
+				ELSE email_verifications.sent_count + 1
+			END,
+			window_started_at = CASE
+				WHEN email_verifications.window_started_at < NOW() - $4 * INTERVAL '1 second' THEN NOW()
+				ELSE email_verifications.window_started_at
+			END
+		RETURNING id, last_sent_at, sent_count, window_started_at;`
+	row := evr.db.QueryRowContext(ctx, queryStr, evPtr.UserID, evPtr.TokenHash, evPtr.ExpirationTime,
+		VerificationSendWindow.Seconds())
+	err := row.Scan(&evPtr.ID, &evPtr.LastSentAt, &evPtr.SentCount, &evPtr.WindowStartedAt)
+	if err != nil {
+		return dbError("upserting email verification in repo", err)
+	}
+	return nil
+}
+
+func (evr EmailVerificationRepo) GetFromTokenHash(ctx context.Context, tokenHash string) (*model.EmailVerification, error) {
+	ev := model.EmailVerification{TokenHash: tokenHash}
+	queryStr := `
+		SELECT id, user_id, expiration_time, last_sent_at, sent_count, window_started_at
+		FROM email_verifications
+		WHERE token_hash = $1;`
+	row := evr.db.QueryRowContext(ctx, queryStr, tokenHash)
+	err := row.Scan(&ev.ID, &ev.UserID, &ev.ExpirationTime, &ev.LastSentAt, &ev.SentCount, &ev.WindowStartedAt)
+	if err != nil {
+		return nil, dbError("getting email verification from repo", err)
+	}
+	return &ev, nil
+}
+
+func (evr EmailVerificationRepo) GetByUserID(ctx context.Context, userID int) (*model.EmailVerification, error) {
+	ev := model.EmailVerification{UserID: userID}
+	queryStr := `
+		SELECT id, token_hash, expiration_time, last_sent_at, sent_count, window_started_at
+		FROM email_verifications
+		WHERE user_id = $1;`
+	row := evr.db.QueryRowContext(ctx, queryStr, userID)
+	err := row.Scan(&ev.ID, &ev.TokenHash, &ev.ExpirationTime, &ev.LastSentAt, &ev.SentCount, &ev.WindowStartedAt)
+	if err != nil {
+		return nil, dbError("getting email verification by user id from repo", err)
+	}
+	return &ev, nil
+}
+
+func (evr EmailVerificationRepo) DeleteByUserID(ctx context.Context, userID int) error {
+	queryStr := `
+		DELETE FROM email_verifications
+		WHERE user_id = $1;`
+	_, err := evr.db.ExecContext(ctx, queryStr, userID)
+	if err != nil {
+		return dbError("deleting email verification in repo", err)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/suryasaputra2016/course/backend/apperr"
+)
+
+// uniqueViolation is the postgres error code of a broken unique constraint
+const uniqueViolation = "23505"
+
+// dbError annotates err with action, marking a missing row as apperr.ErrNotFound
+// and a broken unique constraint as apperr.ErrConflict
+func dbError(action string, err error) error {
+	var pqErr *pq.Error
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("%s: %w: %w", action, apperr.ErrNotFound, err)
+	case errors.As(err, &pqErr) && pqErr.Code == uniqueViolation:
+		return fmt.Errorf("%s: %w: %w", action, apperr.ErrConflict, err)
+	}
+	return fmt.Errorf("%s: %w", action, err)
+}
@@ -0,0 +1,104 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type LoginChallengeRepo struct {
+	db DBTX
+}
+
+func NewLoginChallengeRepo(db *sql.DB) *LoginChallengeRepo {
+	return &LoginChallengeRepo{db: db}
+}
+
+func (lcr LoginChallengeRepo) Create(ctx context.Context, cPtr *model.LoginChallenge) error {
+	queryStr := `
+		INSERT INTO login_challenges (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id;`
+	err := lcr.db.QueryRowContext(ctx, queryStr, cPtr.UserID, cPtr.TokenHash, cPtr.ExpiresAt).Scan(&cPtr.ID)
+	if err != nil {
+		return dbError("creating login challenge in repo", err)
+	}
+	return nil
+}
+
+// GetFromTokenHash returns the challenge only if it has not expired
+func (lcr LoginChallengeRepo) GetFromTokenHash(ctx context.Context, tokenHash string) (*model.LoginChallenge, error) {
+	challenge := model.LoginChallenge{TokenHash: tokenHash}
+	queryStr := `
+		SELECT id, user_id, expires_at, attempts
+		FROM login_challenges
+		WHERE token_hash = $1 AND expires_at > NOW();`
+	row := lcr.db.QueryRowContext(ctx, queryStr, tokenHash)
+	err := row.Scan(&challenge.ID, &challenge.UserID, &challenge.ExpiresAt, &challenge.Attempts)
+	if err != nil {
+		return nil, dbError("selecting login challenge from repo", err)
+	}
+	return &challenge, nil
+}
+
+// RecordAttempt counts a wrong code and returns the attempts so far
+func (lcr LoginChallengeRepo) RecordAttempt(ctx context.Context, id int) (int, error) {
+	queryStr := `
+		UPDATE login_challenges
+		SET attempts = attempts + 1
+		WHERE id = $1
+		RETURNING attempts;`
+	var attempts int
+	err := lcr.db.QueryRowContext(ctx, queryStr, id).Scan(&attempts)
+	if err != nil {
+		return 0, dbError("recording login challenge attempt in repo", err)
+	}
+	return attempts, nil
+}
+
+func (lcr LoginChallengeRepo) Delete(ctx context.Context, id int) error {
+	queryStr := `
+		DELETE FROM login_challenges
+		WHERE id = $1;`
+	res, err := lcr.db.ExecContext(ctx, queryStr, id)
+	if err != nil {
+		return dbError("deleting login challenge in repo", err)
+	}
+	deletedRow, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking deleted row: %w", err)
+	}
+	if deletedRow == 0 {
+		return fmt.Errorf("zero deleted row: %w", apperr.ErrNotFound)
+	}
+	return nil
+}
+
+// DeleteExpired deletes at most batchSize expired login challenges
+func (lcr LoginChallengeRepo) DeleteExpired(ctx context.Context, batchSize int) (int64, error) {
+	queryStr := `
+		DELETE FROM login_challenges
+		WHERE id IN (
+			SELECT id FROM login_challenges
+			WHERE expires_at <= NOW()
+			LIMIT $1
+		);`
+	res, err := lcr.db.ExecContext(ctx, queryStr, batchSize)
+	if err != nil {
+		return 0, dbError("deleting expired login challenges", err)
+	}
+	deletedRow, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("checking deleted row: %w", err)
+	}
+	return deletedRow, nil
+}
+
+// ReapExpired deletes expired login challenges in batches every interval until ctx is done
+func (lcr LoginChallengeRepo) ReapExpired(ctx context.Context, interval time.Duration, batchSize int) {
+	reap(ctx, interval, batchSize, "expired login challenges", lcr.DeleteExpired)
+}
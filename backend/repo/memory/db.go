@@ -0,0 +1,216 @@
+// Package memory keeps every table in process memory, it implements the repo
+// store interfaces with the same semantics as postgres and is meant for tests
+package memory
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/repo"
+)
+
+// roleNames are the seeded roles in id order, the order user roles are listed in
+var roleNames = []string{model.RoleStudent, model.RoleAuthor, model.RoleReviewer, model.RoleAdmin}
+
+// rolePermissions mirrors the role_permissions seed of the migrations
+var rolePermissions = map[string][]string{
+	model.RoleAuthor:   {model.PermCreateQuestion},
+	model.RoleReviewer: {model.PermReviewQuestion},
+	model.RoleAdmin: {
+		model.PermCreateQuestion,
+		model.PermEditAnyQuestion,
+		model.PermDeleteAnyQuestion,
+		model.PermReviewQuestion,
+		model.PermManageRoles,
+		model.PermManageEmails,
+	},
+}
+
+// DB holds the tables. Rows are stored by value and a slice or pointer inside
+// a stored row is never changed in place, so copying the maps is a snapshot.
+type DB struct {
+	mu   sync.Mutex
+	txMu sync.Mutex
+	data *tables
+}
+
+type tables struct {
+	lastID             map[string]int
+	users              map[int]model.User
+	sessions           map[int]model.Session
+	passwordResets     map[int]model.PasswordReset
+	emailVerifications map[int]model.EmailVerification
+	outbox             map[int]model.OutboxEmail
+	roleAudits         []model.RoleAudit
+	questions          map[int]model.Question
+	submissions        map[int]model.Submission
+	// rateLimits holds when the bucket of each key is full again
+	rateLimits        map[string]time.Time
+	totp              map[int]model.TOTP
+	recoveryCodes     map[int]model.RecoveryCode
+	loginChallenges   map[int]model.LoginChallenge
+	passkeys          map[int]model.Passkey
+	passkeyChallenges map[int]model.PasskeyChallenge
+	oauthIdentities   map[int]model.OAuthIdentity
+	oauthStates       map[int]model.OAuthState
+}
+
+func New() *DB {
+	return &DB{data: &tables{
+		lastID:             map[string]int{},
+		users:              map[int]model.User{},
+		sessions:           map[int]model.Session{},
+		passwordResets:     map[int]model.PasswordReset{},
+		emailVerifications: map[int]model.EmailVerification{},
+		outbox:             map[int]model.OutboxEmail{},
+		questions:          map[int]model.Question{},
+		submissions:        map[int]model.Submission{},
+		rateLimits:         map[string]time.Time{},
+		totp:               map[int]model.TOTP{},
+		recoveryCodes:      map[int]model.RecoveryCode{},
+		loginChallenges:    map[int]model.LoginChallenge{},
+		passkeys:           map[int]model.Passkey{},
+		passkeyChallenges:  map[int]model.PasskeyChallenge{},
+		oauthIdentities:    map[int]model.OAuthIdentity{},
+		oauthStates:        map[int]model.OAuthState{},
+	}}
+}
+
+// Repos returns repos working directly on the tables, outside any transaction
+func (db *DB) Repos() repo.Repos {
+	return repo.Repos{
+		Users:              UserRepo{db: db},
+		Sessions:           SessionRepo{db: db},
+		PasswordResets:     PasswordResetRepo{db: db},
+		EmailVerifications: EmailVerificationRepo{db: db},
+		Outbox:             OutboxRepo{db: db},
+		Roles:              RoleRepo{db: db},
+		Questions:          QuestionRepo{db: db},
+		Submissions:        SubmissionRepo{db: db},
+		RateLimits:         RateLimitRepo{db: db},
+		TwoFactor:          TwoFactorRepo{db: db},
+		LoginChallenges:    LoginChallengeRepo{db: db},
+		Passkeys:           PasskeyRepo{db: db},
+		PasskeyChallenges:  PasskeyChallengeRepo{db: db},
+		OAuthIdentities:    OAuthIdentityRepo{db: db},
+		OAuthStates:        OAuthStateRepo{db: db},
+	}
+}
+
+// Do runs fn as a transaction, one at a time, restoring the snapshot taken
+// before fn when it returns an error. Writes made through Repos while fn runs
+// are rolled back with it.
+func (db *DB) Do(ctx context.Context, fn func(r repo.Repos) error) error {
+	db.txMu.Lock()
+	defer db.txMu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	db.mu.Lock()
+	snapshot := db.data.clone()
+	db.mu.Unlock()
+
+	err := fn(db.Repos())
+	if err != nil {
+		db.mu.Lock()
+		db.data = snapshot
+		db.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// locked runs fn with the tables locked, failing early when ctx is done like
+// a cancelled query. A failing fn must not have changed anything, as a single
+// postgres statement would not have.
+func (db *DB) locked(ctx context.Context, fn func(t *tables) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return fn(db.data)
+}
+
+func (t *tables) nextID(table string) int {
+	t.lastID[table]++
+	return t.lastID[table]
+}
+
+func (t *tables) deleteQuestion(id int) {
+	delete(t.questions, id)
+	deleteWhere(t.submissions, func(s model.Submission) bool { return s.QuestionID == id })
+}
+
+func (t *tables) clone() *tables {
+	c := &tables{
+		lastID:             maps.Clone(t.lastID),
+		users:              maps.Clone(t.users),
+		sessions:           maps.Clone(t.sessions),
+		passwordResets:     maps.Clone(t.passwordResets),
+		emailVerifications: maps.Clone(t.emailVerifications),
+		outbox:             maps.Clone(t.outbox),
+		roleAudits:         slices.Clone(t.roleAudits),
+		questions:          maps.Clone(t.questions),
+		submissions:        maps.Clone(t.submissions),
+		rateLimits:         maps.Clone(t.rateLimits),
+		totp:               maps.Clone(t.totp),
+		recoveryCodes:      maps.Clone(t.recoveryCodes),
+		loginChallenges:    maps.Clone(t.loginChallenges),
+		passkeys:           maps.Clone(t.passkeys),
+		passkeyChallenges:  maps.Clone(t.passkeyChallenges),
+		oauthIdentities:    maps.Clone(t.oauthIdentities),
+		oauthStates:        maps.Clone(t.oauthStates),
+	}
+	return c
+}
+
+func deleteWhere[V any](m map[int]V, match func(V) bool) {
+	for id, v := range m {
+		if match(v) {
+			delete(m, id)
+		}
+	}
+}
+
+// page applies LIMIT and OFFSET to rows that are already ordered
+func page[V any](rows []V, limit, offset int) []V {
+	if offset >= len(rows) {
+		return rows[:0]
+	}
+	rows = rows[offset:]
+	if limit < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+func notFound(action string) error {
+	return fmt.Errorf("%s: %w", action, apperr.ErrNotFound)
+}
+
+var (
+	_ repo.Transactor             = (*DB)(nil)
+	_ repo.UserStore              = UserRepo{}
+	_ repo.SessionStore           = SessionRepo{}
+	_ repo.PasswordResetStore     = PasswordResetRepo{}
+	_ repo.EmailVerificationStore = EmailVerificationRepo{}
+	_ repo.OutboxStore            = OutboxRepo{}
+	_ repo.RoleStore              = RoleRepo{}
+	_ repo.QuestionStore          = QuestionRepo{}
+	_ repo.SubmissionStore        = SubmissionRepo{}
+	_ repo.RateLimitStore         = RateLimitRepo{}
+	_ repo.TwoFactorStore         = TwoFactorRepo{}
+	_ repo.LoginChallengeStore    = LoginChallengeRepo{}
+	_ repo.PasskeyStore           = PasskeyRepo{}
+	_ repo.PasskeyChallengeStore  = PasskeyChallengeRepo{}
+	_ repo.OAuthIdentityStore     = OAuthIdentityRepo{}
+	_ repo.OAuthStateStore        = OAuthStateRepo{}
+)
@@ -0,0 +1,191 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/repo"
+)
+
+func TestDoRollsBackOnError(t *testing.T) {
+	ctx := context.Background()
+	db := New()
+	errAbort := errors.New("abort")
+
+	err := db.Do(ctx, func(r repo.Repos) error {
+		user := model.User{Email: "ada@example.com", Roles: []string{model.RoleStudent}}
+		err := r.Users.Create(ctx, &user)
+		if err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("Do error = %v, want %v", err, errAbort)
+	}
+
+	_, err = db.Repos().Users.GetByEmail(ctx, "ada@example.com")
+	if !errors.Is(err, apperr.ErrNotFound) {
+		t.Errorf("user after rollback error = %v, want apperr.ErrNotFound", err)
+	}
+}
+
+func TestCreateUserRejectsDuplicateEmail(t *testing.T) {
+	ctx := context.Background()
+	users := New().Repos().Users
+
+	err := users.Create(ctx, &model.User{Email: "ada@example.com"})
+	if err != nil {
+		t.Fatalf("creating user: %s", err)
+	}
+	err = users.Create(ctx, &model.User{Email: "ada@example.com"})
+	if err == nil {
+		t.Error("creating a second user with the same email succeeded")
+	}
+}
+
+func TestDeleteUserCascades(t *testing.T) {
+	ctx := context.Background()
+	db := New()
+	r := db.Repos()
+
+	user := model.User{Email: "ada@example.com", Roles: []string{model.RoleAuthor}}
+	mustDo(t, r.Users.Create(ctx, &user))
+	mustDo(t, r.Sessions.Create(ctx, &model.Session{UserID: user.ID, TokenHash: "session"}))
+	mustDo(t, r.PasswordResets.Upsert(ctx, &model.PasswordReset{UserID: user.ID, TokenHash: "reset"}))
+	mustDo(t, r.TwoFactor.UpsertTOTP(ctx, &model.TOTP{UserID: user.ID, Secret: "secret"}))
+	mustDo(t, r.Passkeys.Create(ctx, &model.Passkey{UserID: user.ID, CredentialID: []byte("passkey")}))
+	question := model.Question{AuthorID: user.ID, Title: "Free fall"}
+	mustDo(t, r.Questions.Create(ctx, &question))
+	mustDo(t, r.Submissions.Create(ctx, &model.Submission{UserID: user.ID, QuestionID: question.ID}))
+
+	mustDo(t, r.Users.Delete(ctx, user.ID))
+
+	if _, err := r.Sessions.GetFromTokenHash(ctx, "session"); !errors.Is(err, apperr.ErrNotFound) {
+		t.Errorf("session after delete error = %v, want apperr.ErrNotFound", err)
+	}
+	if _, err := r.PasswordResets.GetFromTokenHash(ctx, "reset"); !errors.Is(err, apperr.ErrNotFound) {
+		t.Errorf("password reset after delete error = %v, want apperr.ErrNotFound", err)
+	}
+	if _, err := r.TwoFactor.GetTOTP(ctx, user.ID); !errors.Is(err, apperr.ErrNotFound) {
+		t.Errorf("totp after delete error = %v, want apperr.ErrNotFound", err)
+	}
+	if _, err := r.Passkeys.GetByCredentialID(ctx, []byte("passkey")); !errors.Is(err, apperr.ErrNotFound) {
+		t.Errorf("passkey after delete error = %v, want apperr.ErrNotFound", err)
+	}
+	if _, err := r.Questions.GetByID(ctx, question.ID); !errors.Is(err, apperr.ErrNotFound) {
+		t.Errorf("question after delete error = %v, want apperr.ErrNotFound", err)
+	}
+	stats, err := r.Submissions.AttemptStats(ctx, user.ID, question.ID)
+	mustDo(t, err)
+	if stats.Count != 0 {
+		t.Errorf("submissions after delete = %d, want 0", stats.Count)
+	}
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	ctx := context.Background()
+	db := New()
+	r := db.Repos()
+
+	granted, err := repo.BootstrapAdmin(ctx, db, "ada@example.com")
+	if err != nil || granted {
+		t.Fatalf("bootstrap without the user = %t, %v, want false", granted, err)
+	}
+
+	ada := model.User{Email: "ada@example.com", Roles: []string{model.RoleStudent}}
+	mustDo(t, r.Users.Create(ctx, &ada))
+	granted, err = repo.BootstrapAdmin(ctx, db, "ada@example.com")
+	if err != nil || granted {
+		t.Fatalf("bootstrap an unverified user = %t, %v, want false", granted, err)
+	}
+
+	mustDo(t, r.Users.UpdateEmailVerification(ctx, ada.ID))
+	granted, err = repo.BootstrapAdmin(ctx, db, "ada@example.com")
+	if err != nil || !granted {
+		t.Fatalf("bootstrap a verified user = %t, %v, want true", granted, err)
+	}
+
+	bob := model.User{Email: "bob@example.com", Roles: []string{model.RoleStudent}, IsVerified: true}
+	mustDo(t, r.Users.Create(ctx, &bob))
+	granted, err = repo.BootstrapAdmin(ctx, db, "bob@example.com")
+	if err != nil || granted {
+		t.Errorf("bootstrap once an admin exists = %t, %v, want false", granted, err)
+	}
+}
+
+func TestOutboxForgetsSentEmails(t *testing.T) {
+	ctx := context.Background()
+	outbox := New().Repos().Outbox
+
+	sent := model.OutboxEmail{ToAddress: "ada@example.com", TextBody: "token", HTMLBody: "token"}
+	dead := model.OutboxEmail{ToAddress: "bob@example.com", TextBody: "token", HTMLBody: "token"}
+	pending := model.OutboxEmail{ToAddress: "eve@example.com", TextBody: "token", HTMLBody: "token"}
+	for _, email := range []*model.OutboxEmail{&sent, &dead, &pending} {
+		mustDo(t, outbox.Enqueue(ctx, email))
+	}
+	mustDo(t, outbox.MarkSent(ctx, sent.ID))
+	mustDo(t, outbox.MarkFailed(ctx, dead.ID, errors.New("refused"), 0, 1))
+
+	emails, err := outbox.List(ctx, model.OutboxStatusSent, 10, 0)
+	mustDo(t, err)
+	if len(emails) != 1 || emails[0].TextBody != "" || emails[0].HTMLBody != "" {
+		t.Errorf("sent emails = %+v, want one without bodies", emails)
+	}
+
+	if err := outbox.Requeue(ctx, sent.ID); !errors.Is(err, apperr.ErrConflict) {
+		t.Errorf("requeue a sent email error = %v, want apperr.ErrConflict", err)
+	}
+	if err := outbox.Requeue(ctx, 100); !errors.Is(err, apperr.ErrNotFound) {
+		t.Errorf("requeue a missing email error = %v, want apperr.ErrNotFound", err)
+	}
+
+	deleted, err := outbox.DeleteFinished(ctx, time.Hour, 10)
+	mustDo(t, err)
+	if deleted != 0 {
+		t.Errorf("deleted %d emails within retention, want 0", deleted)
+	}
+	deleted, err = outbox.DeleteFinished(ctx, 0, 10)
+	mustDo(t, err)
+	if deleted != 2 {
+		t.Errorf("deleted %d emails past retention, want the sent and the dead one", deleted)
+	}
+	emails, err = outbox.List(ctx, "", 10, 0)
+	mustDo(t, err)
+	if len(emails) != 1 || emails[0].ID != pending.ID {
+		t.Errorf("emails left = %+v, want only the pending one", emails)
+	}
+}
+
+func mustDo(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPasskeySignCountOnlyGrows(t *testing.T) {
+	ctx := context.Background()
+	r := New().Repos()
+	user := model.User{Email: "ada@example.com", Roles: []string{model.RoleStudent}}
+	mustDo(t, r.Users.Create(ctx, &user))
+	passkeys := r.Passkeys
+
+	passkey := model.Passkey{UserID: user.ID, CredentialID: []byte("credential"), SignCount: 5}
+	mustDo(t, passkeys.Create(ctx, &passkey))
+	mustDo(t, passkeys.RecordUse(ctx, passkey.ID, 6, false))
+
+	// a second login that verified against count 5 lost the race
+	if err := passkeys.RecordUse(ctx, passkey.ID, 6, false); !errors.Is(err, apperr.ErrNotFound) {
+		t.Errorf("record the same sign count again error = %v, want apperr.ErrNotFound", err)
+	}
+	if err := passkeys.RecordUse(ctx, passkey.ID, 3, false); !errors.Is(err, apperr.ErrNotFound) {
+		t.Errorf("record a lower sign count error = %v, want apperr.ErrNotFound", err)
+	}
+	// authenticators that don't count always send 0
+	mustDo(t, passkeys.RecordUse(ctx, passkey.ID, 0, false))
+}
@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/repo"
+)
+
+type EmailVerificationRepo struct {
+	db *DB
+}
+
+// Upsert stores a new token for the user, replacing any previous one and
+// counting the send within the current window
+func (evr EmailVerificationRepo) Upsert(ctx context.Context, evPtr *model.EmailVerification) error {
+	return evr.db.locked(ctx, func(t *tables) error {
+		if _, ok := t.users[evPtr.UserID]; !ok {
+			return fmt.Errorf("upserting email verification in repo: user %d does not exist", evPtr.UserID)
+		}
+		var existing *model.EmailVerification
+		for _, ev := range t.emailVerifications {
+			if ev.TokenHash == evPtr.TokenHash && ev.UserID != evPtr.UserID {
+				return fmt.Errorf("upserting email verification in repo: %w: token hash is taken", apperr.ErrConflict)
+			}
+			if ev.UserID == evPtr.UserID {
+				existing = &ev
+			}
+		}
+
+		now := time.Now()
+		evPtr.LastSentAt = now
+		switch {
+		case existing == nil:
+			evPtr.ID = t.nextID("email_verifications")
+			evPtr.SentCount = 1
+			evPtr.WindowStartedAt = now
+		case existing.WindowStartedAt.Before(now.Add(-repo.VerificationSendWindow)):
+			evPtr.ID = existing.ID
+			evPtr.SentCount = 1
+			evPtr.WindowStartedAt = now
+		default:
+			evPtr.ID = existing.ID
+			evPtr.SentCount = existing.SentCount + 1
+			evPtr.WindowStartedAt = existing.WindowStartedAt
+		}
+		t.emailVerifications[evPtr.ID] = *evPtr
+		return nil
+	})
+}
+
+func (evr EmailVerificationRepo) GetFromTokenHash(ctx context.Context, tokenHash string) (*model.EmailVerification, error) {
+	return evr.find(ctx, "getting email verification from repo", func(ev model.EmailVerification) bool {
+		return ev.TokenHash == tokenHash
+	})
+}
+
+func (evr EmailVerificationRepo) GetByUserID(ctx context.Context, userID int) (*model.EmailVerification, error) {
+	return evr.find(ctx, "getting email verification by user id from repo", func(ev model.EmailVerification) bool {
+		return ev.UserID == userID
+	})
+}
+
+func (evr EmailVerificationRepo) DeleteByUserID(ctx context.Context, userID int) error {
+	return evr.db.locked(ctx, func(t *tables) error {
+		deleteWhere(t.emailVerifications, func(ev model.EmailVerification) bool { return ev.UserID == userID })
+		return nil
+	})
+}
+
+func (evr EmailVerificationRepo) find(ctx context.Context, action string, match func(model.EmailVerification) bool) (*model.EmailVerification, error) {
+	var found *model.EmailVerification
+	err := evr.db.locked(ctx, func(t *tables) error {
+		for _, ev := range t.emailVerifications {
+			if match(ev) {
+				found = &ev
+				return nil
+			}
+		}
+		return notFound(action)
+	})
+	return found, err
+}
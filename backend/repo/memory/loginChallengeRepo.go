@@ -0,0 +1,94 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type LoginChallengeRepo struct {
+	db *DB
+}
+
+func (lcr LoginChallengeRepo) Create(ctx context.Context, cPtr *model.LoginChallenge) error {
+	return lcr.db.locked(ctx, func(t *tables) error {
+		if _, ok := t.users[cPtr.UserID]; !ok {
+			return fmt.Errorf("creating login challenge in repo: user %d does not exist", cPtr.UserID)
+		}
+		for _, c := range t.loginChallenges {
+			if c.TokenHash == cPtr.TokenHash {
+				return fmt.Errorf("creating login challenge in repo: %w: token hash is taken", apperr.ErrConflict)
+			}
+		}
+		cPtr.ID = t.nextID("login_challenges")
+		cPtr.Attempts = 0
+		t.loginChallenges[cPtr.ID] = *cPtr
+		return nil
+	})
+}
+
+// GetFromTokenHash returns the challenge only if it has not expired
+func (lcr LoginChallengeRepo) GetFromTokenHash(ctx context.Context, tokenHash string) (*model.LoginChallenge, error) {
+	var found *model.LoginChallenge
+	err := lcr.db.locked(ctx, func(t *tables) error {
+		now := time.Now()
+		for _, c := range t.loginChallenges {
+			if c.TokenHash == tokenHash && now.Before(c.ExpiresAt) {
+				found = &c
+				return nil
+			}
+		}
+		return notFound("selecting login challenge from repo")
+	})
+	return found, err
+}
+
+func (lcr LoginChallengeRepo) RecordAttempt(ctx context.Context, id int) (int, error) {
+	var attempts int
+	err := lcr.db.locked(ctx, func(t *tables) error {
+		c, ok := t.loginChallenges[id]
+		if !ok {
+			return notFound("recording login challenge attempt in repo")
+		}
+		c.Attempts++
+		t.loginChallenges[id] = c
+		attempts = c.Attempts
+		return nil
+	})
+	return attempts, err
+}
+
+func (lcr LoginChallengeRepo) Delete(ctx context.Context, id int) error {
+	return lcr.db.locked(ctx, func(t *tables) error {
+		if _, ok := t.loginChallenges[id]; !ok {
+			return fmt.Errorf("zero deleted row: %w", apperr.ErrNotFound)
+		}
+		delete(t.loginChallenges, id)
+		return nil
+	})
+}
+
+// DeleteExpired deletes at most batchSize expired login challenges
+func (lcr LoginChallengeRepo) DeleteExpired(ctx context.Context, batchSize int) (int64, error) {
+	var deleted int64
+	err := lcr.db.locked(ctx, func(t *tables) error {
+		now := time.Now()
+		ids := []int{}
+		for id, c := range t.loginChallenges {
+			if !now.Before(c.ExpiresAt) {
+				ids = append(ids, id)
+			}
+		}
+		slices.Sort(ids)
+		for _, id := range page(ids, batchSize, 0) {
+			delete(t.loginChallenges, id)
+			deleted++
+		}
+		return nil
+	})
+	return deleted, err
+}
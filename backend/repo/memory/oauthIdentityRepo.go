@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type OAuthIdentityRepo struct {
+	db *DB
+}
+
+func (oir OAuthIdentityRepo) Create(ctx context.Context, iPtr *model.OAuthIdentity) error {
+	return oir.db.locked(ctx, func(t *tables) error {
+		if _, ok := t.users[iPtr.UserID]; !ok {
+			return fmt.Errorf("creating oauth identity in repo: user %d does not exist", iPtr.UserID)
+		}
+		for _, i := range t.oauthIdentities {
+			if i.Provider == iPtr.Provider && i.Subject == iPtr.Subject {
+				return fmt.Errorf("creating oauth identity in repo: %w: subject is linked", apperr.ErrConflict)
+			}
+		}
+		iPtr.ID = t.nextID("oauth_identities")
+		iPtr.CreatedAt = time.Now()
+		t.oauthIdentities[iPtr.ID] = *iPtr
+		return nil
+	})
+}
+
+func (oir OAuthIdentityRepo) GetBySubject(ctx context.Context, provider, subject string) (*model.OAuthIdentity, error) {
+	var found *model.OAuthIdentity
+	err := oir.db.locked(ctx, func(t *tables) error {
+		for _, i := range t.oauthIdentities {
+			if i.Provider == provider && i.Subject == subject {
+				found = &i
+				return nil
+			}
+		}
+		return notFound("selecting oauth identity from repo")
+	})
+	return found, err
+}
@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type OAuthStateRepo struct {
+	db *DB
+}
+
+func (osr OAuthStateRepo) Create(ctx context.Context, sPtr *model.OAuthState) error {
+	return osr.db.locked(ctx, func(t *tables) error {
+		for _, s := range t.oauthStates {
+			if s.StateHash == sPtr.StateHash {
+				return fmt.Errorf("creating oauth state in repo: %w: state hash is taken", apperr.ErrConflict)
+			}
+		}
+		sPtr.ID = t.nextID("oauth_states")
+		t.oauthStates[sPtr.ID] = *sPtr
+		return nil
+	})
+}
+
+// Consume deletes and returns the state of stateHash, so a state works only
+// once. It may have expired.
+func (osr OAuthStateRepo) Consume(ctx context.Context, stateHash string) (*model.OAuthState, error) {
+	var found *model.OAuthState
+	err := osr.db.locked(ctx, func(t *tables) error {
+		for id, s := range t.oauthStates {
+			if s.StateHash == stateHash {
+				delete(t.oauthStates, id)
+				found = &s
+				return nil
+			}
+		}
+		return notFound("consuming oauth state in repo")
+	})
+	return found, err
+}
+
+// DeleteExpired deletes at most batchSize expired oauth states
+func (osr OAuthStateRepo) DeleteExpired(ctx context.Context, batchSize int) (int64, error) {
+	var deleted int64
+	err := osr.db.locked(ctx, func(t *tables) error {
+		now := time.Now()
+		ids := []int{}
+		for id, s := range t.oauthStates {
+			if !now.Before(s.ExpiresAt) {
+				ids = append(ids, id)
+			}
+		}
+		slices.Sort(ids)
+		for _, id := range page(ids, batchSize, 0) {
+			delete(t.oauthStates, id)
+			deleted++
+		}
+		return nil
+	})
+	return deleted, err
+}
@@ -0,0 +1,151 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type OutboxRepo struct {
+	db *DB
+}
+
+// Enqueue stores an email to be sent by the outbox worker
+func (obr OutboxRepo) Enqueue(ctx context.Context, ePtr *model.OutboxEmail) error {
+	return obr.db.locked(ctx, func(t *tables) error {
+		now := time.Now()
+		ePtr.ID = t.nextID("email_outbox")
+		ePtr.Status = model.OutboxStatusPending
+		ePtr.NextAttemptAt = now
+		ePtr.CreatedAt = now
+		t.outbox[ePtr.ID] = *ePtr
+		return nil
+	})
+}
+
+// ClaimDue leases up to limit due emails for lease, so another worker skips
+// them until the lease ends or they are marked sent or failed
+func (obr OutboxRepo) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]model.OutboxEmail, error) {
+	var claimed []model.OutboxEmail
+	err := obr.db.locked(ctx, func(t *tables) error {
+		now := time.Now()
+		due := []model.OutboxEmail{}
+		for _, email := range t.outbox {
+			if email.Status == model.OutboxStatusPending && !email.NextAttemptAt.After(now) {
+				due = append(due, email)
+			}
+		}
+		slices.SortFunc(due, func(a, b model.OutboxEmail) int {
+			return a.NextAttemptAt.Compare(b.NextAttemptAt)
+		})
+		claimed = page(due, limit, 0)
+		for i := range claimed {
+			claimed[i].NextAttemptAt = now.Add(lease)
+			t.outbox[claimed[i].ID] = claimed[i]
+		}
+		return nil
+	})
+	return claimed, err
+}
+
+// MarkSent records that the email went out and clears its bodies, which hold
+// the links and tokens sent to the user
+func (obr OutboxRepo) MarkSent(ctx context.Context, id int) error {
+	return obr.update(ctx, id, func(email *model.OutboxEmail) {
+		now := time.Now()
+		email.Status = model.OutboxStatusSent
+		email.SentAt = &now
+		email.Attempts++
+		email.LastError = ""
+		email.TextBody = ""
+		email.HTMLBody = ""
+	})
+}
+
+// MarkFailed records a failed attempt, retrying after backoff or dead-lettering
+// the email once it has been tried maxAttempts times
+func (obr OutboxRepo) MarkFailed(ctx context.Context, id int, sendErr error, backoff time.Duration, maxAttempts int) error {
+	return obr.update(ctx, id, func(email *model.OutboxEmail) {
+		email.Attempts++
+		email.LastError = sendErr.Error()
+		email.NextAttemptAt = time.Now().Add(backoff)
+		email.Status = model.OutboxStatusPending
+		if email.Attempts >= maxAttempts {
+			email.Status = model.OutboxStatusDead
+		}
+	})
+}
+
+// List returns emails newest first, filtered by status when status is not empty
+func (obr OutboxRepo) List(ctx context.Context, status string, limit, offset int) ([]model.OutboxEmail, error) {
+	var emails []model.OutboxEmail
+	err := obr.db.locked(ctx, func(t *tables) error {
+		matched := []model.OutboxEmail{}
+		for _, email := range t.outbox {
+			if status == "" || email.Status == status {
+				matched = append(matched, email)
+			}
+		}
+		slices.SortFunc(matched, func(a, b model.OutboxEmail) int { return b.ID - a.ID })
+		emails = page(matched, limit, offset)
+		return nil
+	})
+	return emails, err
+}
+
+// Requeue puts a dead email back in the queue with fresh attempts, a sent
+// email cannot be as its bodies are cleared
+func (obr OutboxRepo) Requeue(ctx context.Context, id int) error {
+	return obr.db.locked(ctx, func(t *tables) error {
+		email, ok := t.outbox[id]
+		if !ok {
+			return notFound("selecting email status in repo")
+		}
+		if email.Status != model.OutboxStatusDead {
+			return apperr.Conflict(fmt.Sprintf("email is %s, only dead emails can be sent again", email.Status))
+		}
+		email.Status = model.OutboxStatusPending
+		email.Attempts = 0
+		email.NextAttemptAt = time.Now()
+		email.LastError = ""
+		t.outbox[id] = email
+		return nil
+	})
+}
+
+// DeleteFinished deletes at most batchSize sent or dead emails created more
+// than retention ago
+func (obr OutboxRepo) DeleteFinished(ctx context.Context, retention time.Duration, batchSize int) (int64, error) {
+	var deleted int64
+	err := obr.db.locked(ctx, func(t *tables) error {
+		cutoff := time.Now().Add(-retention)
+		for id, email := range t.outbox {
+			if deleted == int64(batchSize) {
+				break
+			}
+			finished := email.Status == model.OutboxStatusSent || email.Status == model.OutboxStatusDead
+			if finished && !email.CreatedAt.After(cutoff) {
+				delete(t.outbox, id)
+				deleted++
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// update changes the email with id when it exists, like an UPDATE matching no row
+func (obr OutboxRepo) update(ctx context.Context, id int, change func(email *model.OutboxEmail)) error {
+	return obr.db.locked(ctx, func(t *tables) error {
+		email, ok := t.outbox[id]
+		if ok {
+			change(&email)
+			t.outbox[id] = email
+		}
+		return nil
+	})
+}
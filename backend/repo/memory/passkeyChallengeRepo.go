@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type PasskeyChallengeRepo struct {
+	db *DB
+}
+
+func (pcr PasskeyChallengeRepo) Create(ctx context.Context, cPtr *model.PasskeyChallenge) error {
+	return pcr.db.locked(ctx, func(t *tables) error {
+		if _, ok := t.users[cPtr.UserID]; cPtr.UserID != 0 && !ok {
+			return fmt.Errorf("creating passkey challenge in repo: user %d does not exist", cPtr.UserID)
+		}
+		for _, c := range t.passkeyChallenges {
+			if c.ChallengeHash == cPtr.ChallengeHash {
+				return fmt.Errorf("creating passkey challenge in repo: %w: challenge hash is taken", apperr.ErrConflict)
+			}
+		}
+		cPtr.ID = t.nextID("passkey_challenges")
+		t.passkeyChallenges[cPtr.ID] = *cPtr
+		return nil
+	})
+}
+
+// Consume deletes and returns the challenge of challengeHash for ceremony, so
+// a challenge works only once. It may have expired.
+func (pcr PasskeyChallengeRepo) Consume(ctx context.Context, challengeHash, ceremony string) (*model.PasskeyChallenge, error) {
+	var found *model.PasskeyChallenge
+	err := pcr.db.locked(ctx, func(t *tables) error {
+		for id, c := range t.passkeyChallenges {
+			if c.ChallengeHash == challengeHash && c.Ceremony == ceremony {
+				delete(t.passkeyChallenges, id)
+				found = &c
+				return nil
+			}
+		}
+		return notFound("consuming passkey challenge in repo")
+	})
+	return found, err
+}
+
+// DeleteExpired deletes at most batchSize expired passkey challenges
+func (pcr PasskeyChallengeRepo) DeleteExpired(ctx context.Context, batchSize int) (int64, error) {
+	var deleted int64
+	err := pcr.db.locked(ctx, func(t *tables) error {
+		now := time.Now()
+		ids := []int{}
+		for id, c := range t.passkeyChallenges {
+			if !now.Before(c.ExpiresAt) {
+				ids = append(ids, id)
+			}
+		}
+		slices.Sort(ids)
+		for _, id := range page(ids, batchSize, 0) {
+			delete(t.passkeyChallenges, id)
+			deleted++
+		}
+		return nil
+	})
+	return deleted, err
+}
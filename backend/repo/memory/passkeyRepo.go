@@ -0,0 +1,104 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type PasskeyRepo struct {
+	db *DB
+}
+
+func (pr PasskeyRepo) Create(ctx context.Context, pPtr *model.Passkey) error {
+	return pr.db.locked(ctx, func(t *tables) error {
+		if _, ok := t.users[pPtr.UserID]; !ok {
+			return fmt.Errorf("creating passkey in repo: user %d does not exist", pPtr.UserID)
+		}
+		for _, p := range t.passkeys {
+			if bytes.Equal(p.CredentialID, pPtr.CredentialID) {
+				return fmt.Errorf("creating passkey in repo: %w: credential id is taken", apperr.ErrConflict)
+			}
+		}
+		if pPtr.Transports == nil {
+			pPtr.Transports = []string{}
+		}
+		pPtr.ID = t.nextID("passkeys")
+		pPtr.CreatedAt = time.Now()
+		pPtr.LastUsedAt = nil
+		t.passkeys[pPtr.ID] = *pPtr
+		return nil
+	})
+}
+
+func (pr PasskeyRepo) GetByCredentialID(ctx context.Context, credentialID []byte) (*model.Passkey, error) {
+	var found *model.Passkey
+	err := pr.db.locked(ctx, func(t *tables) error {
+		for _, p := range t.passkeys {
+			if bytes.Equal(p.CredentialID, credentialID) {
+				found = &p
+				return nil
+			}
+		}
+		return notFound("selecting passkey from repo")
+	})
+	return found, err
+}
+
+// ListByUser returns the passkeys of a user, oldest first
+func (pr PasskeyRepo) ListByUser(ctx context.Context, userID int) ([]model.Passkey, error) {
+	passkeys := []model.Passkey{}
+	err := pr.db.locked(ctx, func(t *tables) error {
+		for _, p := range t.passkeys {
+			if p.UserID == userID {
+				passkeys = append(passkeys, p)
+			}
+		}
+		slices.SortFunc(passkeys, func(a, b model.Passkey) int { return a.ID - b.ID })
+		return nil
+	})
+	return passkeys, err
+}
+
+func (pr PasskeyRepo) RecordUse(ctx context.Context, id int, signCount uint32, backedUp bool) error {
+	return pr.db.locked(ctx, func(t *tables) error {
+		p, ok := t.passkeys[id]
+		if !ok || (signCount <= p.SignCount && signCount != 0) {
+			return fmt.Errorf("zero updated row: %w", apperr.ErrNotFound)
+		}
+		now := time.Now()
+		p.SignCount = signCount
+		p.BackedUp = backedUp
+		p.LastUsedAt = &now
+		t.passkeys[id] = p
+		return nil
+	})
+}
+
+func (pr PasskeyRepo) Rename(ctx context.Context, userID, id int, name string) error {
+	return pr.db.locked(ctx, func(t *tables) error {
+		p, ok := t.passkeys[id]
+		if !ok || p.UserID != userID {
+			return fmt.Errorf("zero updated row: %w", apperr.ErrNotFound)
+		}
+		p.Name = name
+		t.passkeys[id] = p
+		return nil
+	})
+}
+
+func (pr PasskeyRepo) Delete(ctx context.Context, userID, id int) error {
+	return pr.db.locked(ctx, func(t *tables) error {
+		p, ok := t.passkeys[id]
+		if !ok || p.UserID != userID {
+			return fmt.Errorf("zero deleted row: %w", apperr.ErrNotFound)
+		}
+		delete(t.passkeys, id)
+		return nil
+	})
+}
@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type PasswordResetRepo struct {
+	db *DB
+}
+
+// Upsert stores the reset of a user, replacing the token of any earlier request
+func (prr PasswordResetRepo) Upsert(ctx context.Context, prPtr *model.PasswordReset) error {
+	return prr.db.locked(ctx, func(t *tables) error {
+		if _, ok := t.users[prPtr.UserID]; !ok {
+			return fmt.Errorf("upserting password reset in repo: user %d does not exist", prPtr.UserID)
+		}
+		var existing *model.PasswordReset
+		for _, pr := range t.passwordResets {
+			if pr.TokenHash == prPtr.TokenHash && pr.UserID != prPtr.UserID {
+				return fmt.Errorf("upserting password reset in repo: %w: token hash is taken", apperr.ErrConflict)
+			}
+			if pr.UserID == prPtr.UserID {
+				existing = &pr
+			}
+		}
+		if existing != nil {
+			prPtr.ID = existing.ID
+		} else {
+			prPtr.ID = t.nextID("password_resets")
+		}
+		t.passwordResets[prPtr.ID] = *prPtr
+		return nil
+	})
+}
+
+func (prr PasswordResetRepo) GetFromTokenHash(ctx context.Context, tokenHash string) (*model.PasswordReset, error) {
+	var found *model.PasswordReset
+	err := prr.db.locked(ctx, func(t *tables) error {
+		for _, pr := range t.passwordResets {
+			if pr.TokenHash == tokenHash {
+				found = &pr
+				return nil
+			}
+		}
+		return notFound("getting pasword reset from repo")
+	})
+	return found, err
+}
+
+// Consume deletes and returns the reset of tokenHash, so a token works only once
+func (prr PasswordResetRepo) Consume(ctx context.Context, tokenHash string) (*model.PasswordReset, error) {
+	var found *model.PasswordReset
+	err := prr.db.locked(ctx, func(t *tables) error {
+		for id, pr := range t.passwordResets {
+			if pr.TokenHash == tokenHash {
+				delete(t.passwordResets, id)
+				found = &pr
+				return nil
+			}
+		}
+		return notFound("consuming password reset in repo")
+	})
+	return found, err
+}
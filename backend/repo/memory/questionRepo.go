@@ -0,0 +1,105 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type QuestionRepo struct {
+	db *DB
+}
+
+func (qr QuestionRepo) Create(ctx context.Context, qPtr *model.Question) error {
+	return qr.db.locked(ctx, func(t *tables) error {
+		if _, ok := t.users[qPtr.AuthorID]; !ok {
+			return fmt.Errorf("creating question in repo: user %d does not exist", qPtr.AuthorID)
+		}
+		now := time.Now()
+		qPtr.ID = t.nextID("questions")
+		qPtr.CreatedAt = now
+		qPtr.UpdatedAt = now
+		t.questions[qPtr.ID] = *cloneQuestion(*qPtr)
+		return nil
+	})
+}
+
+func (qr QuestionRepo) GetByID(ctx context.Context, id int) (*model.Question, error) {
+	var found *model.Question
+	err := qr.db.locked(ctx, func(t *tables) error {
+		question, ok := t.questions[id]
+		if !ok {
+			return notFound("selecting question by id in repo")
+		}
+		found = cloneQuestion(question)
+		return nil
+	})
+	return found, err
+}
+
+// List returns questions newest first, filtered by topic when topic is not empty
+func (qr QuestionRepo) List(ctx context.Context, topic string, limit, offset int) ([]model.Question, error) {
+	var questions []model.Question
+	err := qr.db.locked(ctx, func(t *tables) error {
+		matched := []model.Question{}
+		for _, question := range t.questions {
+			if topic == "" || question.Topic == topic {
+				matched = append(matched, *cloneQuestion(question))
+			}
+		}
+		slices.SortFunc(matched, func(a, b model.Question) int { return b.ID - a.ID })
+		questions = page(matched, limit, offset)
+		return nil
+	})
+	return questions, err
+}
+
+func (qr QuestionRepo) Update(ctx context.Context, qPtr *model.Question) error {
+	return qr.db.locked(ctx, func(t *tables) error {
+		question, ok := t.questions[qPtr.ID]
+		if !ok {
+			return notFound("updating question in repo")
+		}
+		question.Title = qPtr.Title
+		question.Statement = qPtr.Statement
+		question.Topic = qPtr.Topic
+		question.Difficulty = qPtr.Difficulty
+		question.AnswerSpec = qPtr.AnswerSpec
+		question.Variables = qPtr.Variables
+		question.MaxAttempts = qPtr.MaxAttempts
+		question.CooldownSeconds = qPtr.CooldownSeconds
+		question.UpdatedAt = time.Now()
+		t.questions[qPtr.ID] = *cloneQuestion(question)
+		qPtr.UpdatedAt = question.UpdatedAt
+		return nil
+	})
+}
+
+// Delete removes the question together with its submissions
+func (qr QuestionRepo) Delete(ctx context.Context, id int) error {
+	return qr.db.locked(ctx, func(t *tables) error {
+		if _, ok := t.questions[id]; !ok {
+			return fmt.Errorf("zero deleted row: %w", apperr.ErrNotFound)
+		}
+		t.deleteQuestion(id)
+		return nil
+	})
+}
+
+// cloneQuestion copies the jsonb fields, a nil Variables reads back as empty
+// like the '[]' default of the column
+func cloneQuestion(question model.Question) *model.Question {
+	if question.AnswerSpec != nil {
+		spec := *question.AnswerSpec
+		question.AnswerSpec = &spec
+	}
+	question.Variables = slices.Clone(question.Variables)
+	if question.Variables == nil {
+		question.Variables = []model.Variable{}
+	}
+	return &question
+}
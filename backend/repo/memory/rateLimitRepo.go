@@ -0,0 +1,43 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type RateLimitRepo struct {
+	db *DB
+}
+
+func (rlr RateLimitRepo) Take(ctx context.Context, key string, limit model.RateLimit) (bool, time.Duration, error) {
+	var allowed bool
+	var retryAfter time.Duration
+	err := rlr.db.locked(ctx, func(t *tables) error {
+		var fullAt time.Time
+		fullAt, retryAfter, allowed = limit.Take(t.rateLimits[key], time.Now())
+		t.rateLimits[key] = fullAt
+		return nil
+	})
+	return allowed, retryAfter, err
+}
+
+// DeleteFull deletes at most batchSize buckets that have refilled
+func (rlr RateLimitRepo) DeleteFull(ctx context.Context, batchSize int) (int64, error) {
+	var deleted int64
+	err := rlr.db.locked(ctx, func(t *tables) error {
+		now := time.Now()
+		for key, fullAt := range t.rateLimits {
+			if deleted == int64(batchSize) {
+				break
+			}
+			if !fullAt.After(now) {
+				delete(t.rateLimits, key)
+				deleted++
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
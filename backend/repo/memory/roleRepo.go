@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type RoleRepo struct {
+	db *DB
+}
+
+// Grant gives role to the user and records the change in the audit table
+func (rr RoleRepo) Grant(ctx context.Context, userID int, role string, actorID int) error {
+	return rr.db.locked(ctx, func(t *tables) error {
+		user, ok := t.users[userID]
+		if !ok {
+			return fmt.Errorf("granting role in repo: user %d does not exist", userID)
+		}
+		if !slices.Contains(roleNames, role) || user.HasRole(role) {
+			return apperr.Conflict(fmt.Sprintf("role %s unknown or already granted", role))
+		}
+		user.Roles = knownRoles(append(slices.Clone(user.Roles), role))
+		t.users[userID] = user
+		t.audit(actorID, userID, role, model.RoleActionGrant)
+		return nil
+	})
+}
+
+// Revoke takes role from the user and records the change in the audit table
+func (rr RoleRepo) Revoke(ctx context.Context, userID int, role string, actorID int) error {
+	return rr.db.locked(ctx, func(t *tables) error {
+		user, ok := t.users[userID]
+		if !ok || !user.HasRole(role) {
+			return apperr.Conflict(fmt.Sprintf("role %s not held by user", role))
+		}
+		user.Roles = slices.DeleteFunc(slices.Clone(user.Roles), func(r string) bool { return r == role })
+		t.users[userID] = user
+		t.audit(actorID, userID, role, model.RoleActionRevoke)
+		return nil
+	})
+}
+
+// CountHolders returns how many users hold role
+func (rr RoleRepo) CountHolders(ctx context.Context, role string) (int, error) {
+	var count int
+	err := rr.db.locked(ctx, func(t *tables) error {
+		for _, user := range t.users {
+			if user.HasRole(role) {
+				count++
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+// HasPermission reports whether any role of the user carries permission
+func (rr RoleRepo) HasPermission(ctx context.Context, userID int, permission string) (bool, error) {
+	var has bool
+	err := rr.db.locked(ctx, func(t *tables) error {
+		for _, role := range t.users[userID].Roles {
+			if slices.Contains(rolePermissions[role], permission) {
+				has = true
+			}
+		}
+		return nil
+	})
+	return has, err
+}
+
+func (rr RoleRepo) ListAudits(ctx context.Context, limit, offset int) ([]model.RoleAudit, error) {
+	var audits []model.RoleAudit
+	err := rr.db.locked(ctx, func(t *tables) error {
+		newestFirst := slices.Clone(t.roleAudits)
+		slices.Reverse(newestFirst)
+		audits = page(newestFirst, limit, offset)
+		return nil
+	})
+	return audits, err
+}
+
+func (t *tables) audit(actorID, targetUserID int, role, action string) {
+	t.roleAudits = append(t.roleAudits, model.RoleAudit{
+		ID:           t.nextID("role_audits"),
+		ActorID:      actorID,
+		TargetUserID: targetUserID,
+		RoleName:     role,
+		Action:       action,
+		CreatedAt:    time.Now(),
+	})
+}
@@ -0,0 +1,158 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+	"github.com/suryasaputra2016/course/backend/repo"
+)
+
+type SessionRepo struct {
+	db *DB
+}
+
+func (sr SessionRepo) Create(ctx context.Context, sPtr *model.Session) error {
+	return sr.db.locked(ctx, func(t *tables) error {
+		if _, ok := t.users[sPtr.UserID]; !ok {
+			return fmt.Errorf("creating session in repo: user %d does not exist", sPtr.UserID)
+		}
+		for _, session := range t.sessions {
+			if session.TokenHash == sPtr.TokenHash {
+				return fmt.Errorf("creating session in repo: %w: token hash is taken", apperr.ErrConflict)
+			}
+		}
+		now := time.Now()
+		sPtr.ID = t.nextID("sessions")
+		sPtr.CreatedAt = now
+		sPtr.LastSeenAt = now
+		sPtr.ExpiresAt = now.Add(repo.SessionIdleTimeout)
+		sPtr.AbsoluteExpiresAt = now.Add(repo.SessionAbsoluteTimeout)
+		t.sessions[sPtr.ID] = *sPtr
+		return nil
+	})
+}
+
+// GetFromTokenHash returns the session only if it has not expired
+func (sr SessionRepo) GetFromTokenHash(ctx context.Context, tokenHash string) (*model.Session, error) {
+	var found *model.Session
+	err := sr.db.locked(ctx, func(t *tables) error {
+		now := time.Now()
+		for _, session := range t.sessions {
+			if session.TokenHash == tokenHash && !session.IsExpired(now) {
+				found = &session
+				return nil
+			}
+		}
+		return notFound("selecting session")
+	})
+	return found, err
+}
+
+// ListByUser returns the unexpired sessions of a user, last used first
+func (sr SessionRepo) ListByUser(ctx context.Context, userID int) ([]model.Session, error) {
+	sessions := []model.Session{}
+	err := sr.db.locked(ctx, func(t *tables) error {
+		now := time.Now()
+		for _, session := range t.sessions {
+			if session.UserID == userID && !session.IsExpired(now) {
+				sessions = append(sessions, session)
+			}
+		}
+		slices.SortFunc(sessions, func(a, b model.Session) int {
+			if c := b.LastSeenAt.Compare(a.LastSeenAt); c != 0 {
+				return c
+			}
+			return b.ID - a.ID
+		})
+		return nil
+	})
+	return sessions, err
+}
+
+// Renew slides the idle expiry forward, never past the absolute expiry
+func (sr SessionRepo) Renew(ctx context.Context, sPtr *model.Session) error {
+	return sr.db.locked(ctx, func(t *tables) error {
+		now := time.Now()
+		expiresAt := now.Add(repo.SessionIdleTimeout)
+		if expiresAt.After(sPtr.AbsoluteExpiresAt) {
+			expiresAt = sPtr.AbsoluteExpiresAt
+		}
+		if session, ok := t.sessions[sPtr.ID]; ok {
+			session.LastSeenAt = now
+			session.ExpiresAt = expiresAt
+			t.sessions[sPtr.ID] = session
+		}
+		sPtr.LastSeenAt = now
+		sPtr.ExpiresAt = expiresAt
+		return nil
+	})
+}
+
+func (sr SessionRepo) DeleteFromTokenHash(ctx context.Context, tokenHash string) error {
+	return sr.db.locked(ctx, func(t *tables) error {
+		before := len(t.sessions)
+		deleteWhere(t.sessions, func(s model.Session) bool { return s.TokenHash == tokenHash })
+		if len(t.sessions) == before {
+			return fmt.Errorf("zero deleted row: %w", apperr.ErrNotFound)
+		}
+		return nil
+	})
+}
+
+// Delete deletes a session of the user, the session of another user is not found
+func (sr SessionRepo) Delete(ctx context.Context, userID, id int) error {
+	return sr.db.locked(ctx, func(t *tables) error {
+		session, ok := t.sessions[id]
+		if !ok || session.UserID != userID {
+			return fmt.Errorf("zero deleted row: %w", apperr.ErrNotFound)
+		}
+		delete(t.sessions, id)
+		return nil
+	})
+}
+
+// DeleteOthers deletes every session of the user but keepID, logging them out
+// everywhere else, and returns how many it deleted
+func (sr SessionRepo) DeleteOthers(ctx context.Context, userID, keepID int) (int64, error) {
+	var deleted int64
+	err := sr.db.locked(ctx, func(t *tables) error {
+		before := len(t.sessions)
+		deleteWhere(t.sessions, func(s model.Session) bool { return s.UserID == userID && s.ID != keepID })
+		deleted = int64(before - len(t.sessions))
+		return nil
+	})
+	return deleted, err
+}
+
+// DeleteByUserID deletes every session of the user, logging them out everywhere
+func (sr SessionRepo) DeleteByUserID(ctx context.Context, userID int) error {
+	return sr.db.locked(ctx, func(t *tables) error {
+		deleteWhere(t.sessions, func(s model.Session) bool { return s.UserID == userID })
+		return nil
+	})
+}
+
+// DeleteExpired deletes at most batchSize expired sessions
+func (sr SessionRepo) DeleteExpired(ctx context.Context, batchSize int) (int64, error) {
+	var deleted int64
+	err := sr.db.locked(ctx, func(t *tables) error {
+		now := time.Now()
+		ids := []int{}
+		for id, session := range t.sessions {
+			if session.IsExpired(now) {
+				ids = append(ids, id)
+			}
+		}
+		slices.Sort(ids)
+		for _, id := range page(ids, batchSize, 0) {
+			delete(t.sessions, id)
+			deleted++
+		}
+		return nil
+	})
+	return deleted, err
+}
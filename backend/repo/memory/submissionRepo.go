@@ -0,0 +1,73 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type SubmissionRepo struct {
+	db *DB
+}
+
+func (sbr SubmissionRepo) Create(ctx context.Context, sPtr *model.Submission) error {
+	return sbr.db.locked(ctx, func(t *tables) error {
+		if _, ok := t.users[sPtr.UserID]; !ok {
+			return fmt.Errorf("creating submission in repo: user %d does not exist", sPtr.UserID)
+		}
+		if _, ok := t.questions[sPtr.QuestionID]; !ok {
+			return fmt.Errorf("creating submission in repo: question %d does not exist", sPtr.QuestionID)
+		}
+		sPtr.ID = t.nextID("submissions")
+		sPtr.CreatedAt = time.Now()
+		t.submissions[sPtr.ID] = *sPtr
+		return nil
+	})
+}
+
+// AttemptStats counts the submissions of a user to a question and finds the latest one
+func (sbr SubmissionRepo) AttemptStats(ctx context.Context, userID, questionID int) (*model.AttemptStats, error) {
+	var stats model.AttemptStats
+	err := sbr.db.locked(ctx, func(t *tables) error {
+		for _, submission := range t.submissions {
+			if submission.UserID != userID || submission.QuestionID != questionID {
+				continue
+			}
+			stats.Count++
+			if submission.CreatedAt.After(stats.LastAttemptAt) {
+				stats.LastAttemptAt = submission.CreatedAt
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// ListByUser returns the submissions of a user newest first, filtered by
+// question when questionID is not zero
+func (sbr SubmissionRepo) ListByUser(ctx context.Context, userID, questionID, limit, offset int) ([]model.Submission, error) {
+	var submissions []model.Submission
+	err := sbr.db.locked(ctx, func(t *tables) error {
+		matched := []model.Submission{}
+		for _, submission := range t.submissions {
+			if submission.UserID == userID && (questionID == 0 || submission.QuestionID == questionID) {
+				matched = append(matched, submission)
+			}
+		}
+		slices.SortFunc(matched, func(a, b model.Submission) int {
+			if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+				return c
+			}
+			return b.ID - a.ID
+		})
+		submissions = page(matched, limit, offset)
+		return nil
+	})
+	return submissions, err
+}
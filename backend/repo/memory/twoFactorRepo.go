@@ -0,0 +1,113 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type TwoFactorRepo struct {
+	db *DB
+}
+
+// UpsertTOTP starts an enrolment, replacing one that was never confirmed
+func (tfr TwoFactorRepo) UpsertTOTP(ctx context.Context, tPtr *model.TOTP) error {
+	return tfr.db.locked(ctx, func(t *tables) error {
+		if _, ok := t.users[tPtr.UserID]; !ok {
+			return fmt.Errorf("upserting totp in repo: user %d does not exist", tPtr.UserID)
+		}
+		if existing, ok := t.totp[tPtr.UserID]; ok && existing.IsConfirmed() {
+			return fmt.Errorf("upserting totp in repo: %w: already confirmed", apperr.ErrConflict)
+		}
+		tPtr.ConfirmedAt = time.Time{}
+		tPtr.LastUsedStep = 0
+		t.totp[tPtr.UserID] = *tPtr
+		return nil
+	})
+}
+
+func (tfr TwoFactorRepo) GetTOTP(ctx context.Context, userID int) (*model.TOTP, error) {
+	var found *model.TOTP
+	err := tfr.db.locked(ctx, func(t *tables) error {
+		totp, ok := t.totp[userID]
+		if !ok {
+			return notFound("selecting totp from repo")
+		}
+		found = &totp
+		return nil
+	})
+	return found, err
+}
+
+func (tfr TwoFactorRepo) ConfirmTOTP(ctx context.Context, userID int, step int64) error {
+	return tfr.db.locked(ctx, func(t *tables) error {
+		totp, ok := t.totp[userID]
+		if !ok || totp.IsConfirmed() {
+			return notFound("confirming totp in repo")
+		}
+		totp.ConfirmedAt = time.Now()
+		totp.LastUsedStep = step
+		t.totp[userID] = totp
+		return nil
+	})
+}
+
+func (tfr TwoFactorRepo) UseTOTPStep(ctx context.Context, userID int, step int64) error {
+	return tfr.db.locked(ctx, func(t *tables) error {
+		totp, ok := t.totp[userID]
+		if !ok || totp.LastUsedStep >= step {
+			return notFound("using totp step in repo")
+		}
+		totp.LastUsedStep = step
+		t.totp[userID] = totp
+		return nil
+	})
+}
+
+func (tfr TwoFactorRepo) DeleteTOTP(ctx context.Context, userID int) error {
+	return tfr.db.locked(ctx, func(t *tables) error {
+		if _, ok := t.totp[userID]; !ok {
+			return notFound("deleting totp in repo")
+		}
+		delete(t.totp, userID)
+		deleteWhere(t.recoveryCodes, func(rc model.RecoveryCode) bool { return rc.UserID == userID })
+		return nil
+	})
+}
+
+func (tfr TwoFactorRepo) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	return tfr.db.locked(ctx, func(t *tables) error {
+		if _, ok := t.users[userID]; !ok {
+			return fmt.Errorf("replacing recovery codes in repo: user %d does not exist", userID)
+		}
+		for _, rc := range t.recoveryCodes {
+			for _, codeHash := range codeHashes {
+				if rc.CodeHash == codeHash && rc.UserID != userID {
+					return fmt.Errorf("replacing recovery codes in repo: %w: code hash is taken", apperr.ErrConflict)
+				}
+			}
+		}
+		deleteWhere(t.recoveryCodes, func(rc model.RecoveryCode) bool { return rc.UserID == userID })
+		for _, codeHash := range codeHashes {
+			id := t.nextID("recovery_codes")
+			t.recoveryCodes[id] = model.RecoveryCode{ID: id, UserID: userID, CodeHash: codeHash}
+		}
+		return nil
+	})
+}
+
+func (tfr TwoFactorRepo) UseRecoveryCode(ctx context.Context, userID int, codeHash string) error {
+	return tfr.db.locked(ctx, func(t *tables) error {
+		for id, rc := range t.recoveryCodes {
+			if rc.UserID == userID && rc.CodeHash == codeHash && rc.UsedAt.IsZero() {
+				rc.UsedAt = time.Now()
+				t.recoveryCodes[id] = rc
+				return nil
+			}
+		}
+		return notFound("using recovery code in repo")
+	})
+}
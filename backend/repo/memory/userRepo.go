@@ -0,0 +1,169 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type UserRepo struct {
+	db *DB
+}
+
+// Create stores the user with its known roles, emails are unique
+func (ur UserRepo) Create(ctx context.Context, userPtr *model.User) error {
+	return ur.db.locked(ctx, func(t *tables) error {
+		for _, user := range t.users {
+			if user.Email == userPtr.Email {
+				return fmt.Errorf("creating user in repo: %w: email %s is taken", apperr.ErrConflict, userPtr.Email)
+			}
+		}
+		userPtr.ID = t.nextID("users")
+		userPtr.Roles = knownRoles(userPtr.Roles)
+		t.users[userPtr.ID] = *cloneUser(*userPtr)
+		return nil
+	})
+}
+
+func (ur UserRepo) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	var found *model.User
+	err := ur.db.locked(ctx, func(t *tables) error {
+		for _, user := range t.users {
+			if user.Email == email {
+				found = cloneUser(user)
+				return nil
+			}
+		}
+		return notFound("selecting user by email in repo")
+	})
+	return found, err
+}
+
+func (ur UserRepo) GetByID(ctx context.Context, id int) (*model.User, error) {
+	var found *model.User
+	err := ur.db.locked(ctx, func(t *tables) error {
+		user, ok := t.users[id]
+		if !ok {
+			return notFound("selecting user by id in repo")
+		}
+		found = cloneUser(user)
+		return nil
+	})
+	return found, err
+}
+
+func (ur UserRepo) UpdatePassword(ctx context.Context, id int, newPasswordHash string) error {
+	return ur.db.locked(ctx, func(t *tables) error {
+		user, ok := t.users[id]
+		if ok {
+			user.PasswordHash = newPasswordHash
+			t.users[id] = user
+		}
+		return nil
+	})
+}
+
+func (ur UserRepo) UpdateEmailVerification(ctx context.Context, id int) error {
+	return ur.db.locked(ctx, func(t *tables) error {
+		user, ok := t.users[id]
+		if ok {
+			user.IsVerified = true
+			t.users[id] = user
+		}
+		return nil
+	})
+}
+
+func (ur UserRepo) RecordLoginFailure(ctx context.Context, id int) (int, error) {
+	var failures int
+	err := ur.db.locked(ctx, func(t *tables) error {
+		user, ok := t.users[id]
+		if !ok {
+			return notFound("recording login failure in repo")
+		}
+		user.FailedLogins++
+		t.users[id] = user
+		failures = user.FailedLogins
+		return nil
+	})
+	return failures, err
+}
+
+func (ur UserRepo) LockUntil(ctx context.Context, id int, until time.Time) error {
+	return ur.db.locked(ctx, func(t *tables) error {
+		user, ok := t.users[id]
+		if ok {
+			user.LockedUntil = until
+			t.users[id] = user
+		}
+		return nil
+	})
+}
+
+func (ur UserRepo) ResetLoginFailures(ctx context.Context, id int) error {
+	return ur.db.locked(ctx, func(t *tables) error {
+		user, ok := t.users[id]
+		if ok {
+			user.FailedLogins = 0
+			user.LockedUntil = time.Time{}
+			t.users[id] = user
+		}
+		return nil
+	})
+}
+
+// knownRoles keeps the seeded roles of names in seed order, as the roles
+// column of the postgres repo lists them
+// Delete removes the user and, like the ON DELETE clauses of the schema,
+// everything that references it
+func (ur UserRepo) Delete(ctx context.Context, id int) error {
+	return ur.db.locked(ctx, func(t *tables) error {
+		if _, ok := t.users[id]; !ok {
+			return notFound("deleting user in repo")
+		}
+		delete(t.users, id)
+		deleteWhere(t.sessions, func(s model.Session) bool { return s.UserID == id })
+		deleteWhere(t.passwordResets, func(pr model.PasswordReset) bool { return pr.UserID == id })
+		deleteWhere(t.emailVerifications, func(ev model.EmailVerification) bool { return ev.UserID == id })
+		deleteWhere(t.submissions, func(s model.Submission) bool { return s.UserID == id })
+		delete(t.totp, id)
+		deleteWhere(t.recoveryCodes, func(rc model.RecoveryCode) bool { return rc.UserID == id })
+		deleteWhere(t.loginChallenges, func(c model.LoginChallenge) bool { return c.UserID == id })
+		deleteWhere(t.passkeys, func(p model.Passkey) bool { return p.UserID == id })
+		deleteWhere(t.passkeyChallenges, func(c model.PasskeyChallenge) bool { return c.UserID == id })
+		deleteWhere(t.oauthIdentities, func(i model.OAuthIdentity) bool { return i.UserID == id })
+		for qID, q := range t.questions {
+			if q.AuthorID == id {
+				t.deleteQuestion(qID)
+			}
+		}
+		t.roleAudits = slices.DeleteFunc(t.roleAudits, func(a model.RoleAudit) bool {
+			return a.TargetUserID == id
+		})
+		for i := range t.roleAudits {
+			if t.roleAudits[i].ActorID == id {
+				t.roleAudits[i].ActorID = 0
+			}
+		}
+		return nil
+	})
+}
+
+func knownRoles(names []string) []string {
+	roles := []string{}
+	for _, role := range roleNames {
+		if slices.Contains(names, role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+func cloneUser(user model.User) *model.User {
+	user.Roles = slices.Clone(user.Roles)
+	return &user
+}
@@ -0,0 +1,43 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type OAuthIdentityRepo struct {
+	db DBTX
+}
+
+func NewOAuthIdentityRepo(db *sql.DB) *OAuthIdentityRepo {
+	return &OAuthIdentityRepo{db: db}
+}
+
+func (oir OAuthIdentityRepo) Create(ctx context.Context, iPtr *model.OAuthIdentity) error {
+	queryStr := `
+		INSERT INTO oauth_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at;`
+	row := oir.db.QueryRowContext(ctx, queryStr, iPtr.UserID, iPtr.Provider, iPtr.Subject, iPtr.Email)
+	err := row.Scan(&iPtr.ID, &iPtr.CreatedAt)
+	if err != nil {
+		return dbError("creating oauth identity in repo", err)
+	}
+	return nil
+}
+
+func (oir OAuthIdentityRepo) GetBySubject(ctx context.Context, provider, subject string) (*model.OAuthIdentity, error) {
+	identity := model.OAuthIdentity{Provider: provider, Subject: subject}
+	queryStr := `
+		SELECT id, user_id, email, created_at
+		FROM oauth_identities
+		WHERE provider = $1 AND subject = $2;`
+	row := oir.db.QueryRowContext(ctx, queryStr, provider, subject)
+	err := row.Scan(&identity.ID, &identity.UserID, &identity.Email, &identity.CreatedAt)
+	if err != nil {
+		return nil, dbError("selecting oauth identity from repo", err)
+	}
+	return &identity, nil
+}
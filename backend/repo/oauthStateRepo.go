@@ -0,0 +1,72 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type OAuthStateRepo struct {
+	db DBTX
+}
+
+func NewOAuthStateRepo(db *sql.DB) *OAuthStateRepo {
+	return &OAuthStateRepo{db: db}
+}
+
+func (osr OAuthStateRepo) Create(ctx context.Context, sPtr *model.OAuthState) error {
+	queryStr := `
+		INSERT INTO oauth_states (state_hash, binding_hash, provider, nonce, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id;`
+	row := osr.db.QueryRowContext(ctx, queryStr, sPtr.StateHash, sPtr.BindingHash, sPtr.Provider, sPtr.Nonce, sPtr.CodeVerifier, sPtr.ExpiresAt)
+	err := row.Scan(&sPtr.ID)
+	if err != nil {
+		return dbError("creating oauth state in repo", err)
+	}
+	return nil
+}
+
+// Consume deletes and returns the state of stateHash, so a state works only
+// once. It may have expired.
+func (osr OAuthStateRepo) Consume(ctx context.Context, stateHash string) (*model.OAuthState, error) {
+	state := model.OAuthState{StateHash: stateHash}
+	queryStr := `
+		DELETE FROM oauth_states
+		WHERE state_hash = $1
+		RETURNING id, binding_hash, provider, nonce, code_verifier, expires_at;`
+	row := osr.db.QueryRowContext(ctx, queryStr, stateHash)
+	err := row.Scan(&state.ID, &state.BindingHash, &state.Provider, &state.Nonce, &state.CodeVerifier, &state.ExpiresAt)
+	if err != nil {
+		return nil, dbError("consuming oauth state in repo", err)
+	}
+	return &state, nil
+}
+
+// DeleteExpired deletes at most batchSize expired oauth states
+func (osr OAuthStateRepo) DeleteExpired(ctx context.Context, batchSize int) (int64, error) {
+	queryStr := `
+		DELETE FROM oauth_states
+		WHERE id IN (
+			SELECT id FROM oauth_states
+			WHERE expires_at <= NOW()
+			LIMIT $1
+		);`
+	res, err := osr.db.ExecContext(ctx, queryStr, batchSize)
+	if err != nil {
+		return 0, dbError("deleting expired oauth states", err)
+	}
+	deletedRow, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("checking deleted row: %w", err)
+	}
+	return deletedRow, nil
+}
+
+// ReapExpired deletes expired oauth states in batches every interval until ctx is done
+func (osr OAuthStateRepo) ReapExpired(ctx context.Context, interval time.Duration, batchSize int) {
+	reap(ctx, interval, batchSize, "expired oauth states", osr.DeleteExpired)
+}
@@ -0,0 +1,182 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type OutboxRepo struct {
+	db DBTX
+}
+
+func NewOutboxRepo(db *sql.DB) *OutboxRepo {
+	return &OutboxRepo{db: db}
+}
+
+// Enqueue stores an email to be sent by the outbox worker
+func (obr OutboxRepo) Enqueue(ctx context.Context, ePtr *model.OutboxEmail) error {
+	queryStr := `
+		INSERT INTO email_outbox (to_address, subject, text_body, html_body)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, status, next_attempt_at, created_at;`
+	row := obr.db.QueryRowContext(ctx, queryStr, ePtr.ToAddress, ePtr.Subject, ePtr.TextBody, ePtr.HTMLBody)
+	err := row.Scan(&ePtr.ID, &ePtr.Status, &ePtr.NextAttemptAt, &ePtr.CreatedAt)
+	if err != nil {
+		return dbError("enqueuing email in repo", err)
+	}
+	return nil
+}
+
+// ClaimDue leases up to limit due emails for lease, so another worker skips
+// them until the lease ends or they are marked sent or failed
+func (obr OutboxRepo) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]model.OutboxEmail, error) {
+	queryStr := `
+		UPDATE email_outbox
+		SET next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + outboxColumns + `;`
+	rows, err := obr.db.QueryContext(ctx, queryStr, limit, lease.Seconds())
+	if err != nil {
+		return nil, dbError("claiming due emails in repo", err)
+	}
+	return scanOutboxEmails(rows)
+}
+
+// MarkSent records that the email went out and clears its bodies, which hold
+// the links and tokens sent to the user
+func (obr OutboxRepo) MarkSent(ctx context.Context, id int) error {
+	queryStr := `
+		UPDATE email_outbox
+		SET status = 'sent', sent_at = NOW(), attempts = attempts + 1, last_error = '',
+			text_body = '', html_body = ''
+		WHERE id = $1;`
+	_, err := obr.db.ExecContext(ctx, queryStr, id)
+	if err != nil {
+		return dbError("marking email sent in repo", err)
+	}
+	return nil
+}
+
+// MarkFailed records a failed attempt, retrying after backoff or dead-lettering
+// the email once it has been tried maxAttempts times
+func (obr OutboxRepo) MarkFailed(ctx context.Context, id int, sendErr error, backoff time.Duration, maxAttempts int) error {
+	queryStr := `
+		UPDATE email_outbox
+		SET attempts = attempts + 1,
+			last_error = $2,
+			next_attempt_at = NOW() + $3 * INTERVAL '1 second',
+			status = CASE WHEN attempts + 1 >= $4 THEN 'dead' ELSE 'pending' END
+		WHERE id = $1;`
+	_, err := obr.db.ExecContext(ctx, queryStr, id, sendErr.Error(), backoff.Seconds(), maxAttempts)
+	if err != nil {
+		return dbError("marking email failed in repo", err)
+	}
+	return nil
+}
+
+// List returns emails newest first, filtered by status when status is not empty
+func (obr OutboxRepo) List(ctx context.Context, status string, limit, offset int) ([]model.OutboxEmail, error) {
+	queryStr := `
+		SELECT ` + outboxColumns + `
+		FROM email_outbox
+		WHERE $1 = '' OR status = $1
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3;`
+	rows, err := obr.db.QueryContext(ctx, queryStr, status, limit, offset)
+	if err != nil {
+		return nil, dbError("selecting emails in repo", err)
+	}
+	return scanOutboxEmails(rows)
+}
+
+// Requeue puts a dead email back in the queue with fresh attempts, a sent
+// email cannot be as its bodies are cleared
+func (obr OutboxRepo) Requeue(ctx context.Context, id int) error {
+	queryStr := `
+		UPDATE email_outbox
+		SET status = 'pending', attempts = 0, next_attempt_at = NOW(), last_error = ''
+		WHERE id = $1 AND status = 'dead';`
+	res, err := obr.db.ExecContext(ctx, queryStr, id)
+	if err != nil {
+		return dbError("requeuing email in repo", err)
+	}
+	updatedRow, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking updated row: %w", err)
+	}
+	if updatedRow > 0 {
+		return nil
+	}
+
+	var status string
+	queryStr = `
+		SELECT status
+		FROM email_outbox
+		WHERE id = $1;`
+	err = obr.db.QueryRowContext(ctx, queryStr, id).Scan(&status)
+	if err != nil {
+		return dbError("selecting email status in repo", err)
+	}
+	return apperr.Conflict(fmt.Sprintf("email is %s, only dead emails can be sent again", status))
+}
+
+// DeleteFinished deletes at most batchSize sent or dead emails created more
+// than retention ago
+func (obr OutboxRepo) DeleteFinished(ctx context.Context, retention time.Duration, batchSize int) (int64, error) {
+	queryStr := `
+		DELETE FROM email_outbox
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status IN ('sent', 'dead') AND created_at <= NOW() - $1 * INTERVAL '1 second'
+			LIMIT $2
+		);`
+	res, err := obr.db.ExecContext(ctx, queryStr, retention.Seconds(), batchSize)
+	if err != nil {
+		return 0, dbError("deleting finished emails", err)
+	}
+	deletedRow, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("checking deleted row: %w", err)
+	}
+	return deletedRow, nil
+}
+
+// ReapFinished deletes sent and dead emails older than retention in batches
+// every interval until ctx is done
+func (obr OutboxRepo) ReapFinished(ctx context.Context, interval, retention time.Duration, batchSize int) {
+	reap(ctx, interval, batchSize, "finished emails", func(ctx context.Context, batchSize int) (int64, error) {
+		return obr.DeleteFinished(ctx, retention, batchSize)
+	})
+}
+
+const outboxColumns = `id, to_address, subject, text_body, html_body, status, attempts,
+			next_attempt_at, last_error, created_at, sent_at`
+
+func scanOutboxEmails(rows *sql.Rows) ([]model.OutboxEmail, error) {
+	defer rows.Close()
+	emails := []model.OutboxEmail{}
+	for rows.Next() {
+		var email model.OutboxEmail
+		err := rows.Scan(&email.ID, &email.ToAddress, &email.Subject, &email.TextBody, &email.HTMLBody,
+			&email.Status, &email.Attempts, &email.NextAttemptAt, &email.LastError, &email.CreatedAt, &email.SentAt)
+		if err != nil {
+			return nil, dbError("scanning email in repo", err)
+		}
+		emails = append(emails, email)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating emails in repo: %w", err)
+	}
+	return emails, nil
+}
@@ -0,0 +1,76 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type PasskeyChallengeRepo struct {
+	db DBTX
+}
+
+func NewPasskeyChallengeRepo(db *sql.DB) *PasskeyChallengeRepo {
+	return &PasskeyChallengeRepo{db: db}
+}
+
+func (pcr PasskeyChallengeRepo) Create(ctx context.Context, cPtr *model.PasskeyChallenge) error {
+	var userID sql.NullInt64
+	if cPtr.UserID != 0 {
+		userID = sql.NullInt64{Int64: int64(cPtr.UserID), Valid: true}
+	}
+	queryStr := `
+		INSERT INTO passkey_challenges (user_id, challenge_hash, ceremony, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id;`
+	err := pcr.db.QueryRowContext(ctx, queryStr, userID, cPtr.ChallengeHash, cPtr.Ceremony, cPtr.ExpiresAt).Scan(&cPtr.ID)
+	if err != nil {
+		return dbError("creating passkey challenge in repo", err)
+	}
+	return nil
+}
+
+// Consume deletes and returns the challenge of challengeHash for ceremony, so
+// a challenge works only once. It may have expired.
+func (pcr PasskeyChallengeRepo) Consume(ctx context.Context, challengeHash, ceremony string) (*model.PasskeyChallenge, error) {
+	challenge := model.PasskeyChallenge{ChallengeHash: challengeHash, Ceremony: ceremony}
+	queryStr := `
+		DELETE FROM passkey_challenges
+		WHERE challenge_hash = $1 AND ceremony = $2
+		RETURNING id, user_id, expires_at;`
+	var userID sql.NullInt64
+	err := pcr.db.QueryRowContext(ctx, queryStr, challengeHash, ceremony).Scan(&challenge.ID, &userID, &challenge.ExpiresAt)
+	if err != nil {
+		return nil, dbError("consuming passkey challenge in repo", err)
+	}
+	challenge.UserID = int(userID.Int64)
+	return &challenge, nil
+}
+
+// DeleteExpired deletes at most batchSize expired passkey challenges
+func (pcr PasskeyChallengeRepo) DeleteExpired(ctx context.Context, batchSize int) (int64, error) {
+	queryStr := `
+		DELETE FROM passkey_challenges
+		WHERE id IN (
+			SELECT id FROM passkey_challenges
+			WHERE expires_at <= NOW()
+			LIMIT $1
+		);`
+	res, err := pcr.db.ExecContext(ctx, queryStr, batchSize)
+	if err != nil {
+		return 0, dbError("deleting expired passkey challenges", err)
+	}
+	deletedRow, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("checking deleted row: %w", err)
+	}
+	return deletedRow, nil
+}
+
+// ReapExpired deletes expired passkey challenges in batches every interval until ctx is done
+func (pcr PasskeyChallengeRepo) ReapExpired(ctx context.Context, interval time.Duration, batchSize int) {
+	reap(ctx, interval, batchSize, "expired passkey challenges", pcr.DeleteExpired)
+}
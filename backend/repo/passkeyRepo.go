@@ -0,0 +1,155 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type PasskeyRepo struct {
+	db DBTX
+}
+
+func NewPasskeyRepo(db *sql.DB) *PasskeyRepo {
+	return &PasskeyRepo{db: db}
+}
+
+func (pr PasskeyRepo) Create(ctx context.Context, pPtr *model.Passkey) error {
+	if pPtr.Transports == nil {
+		pPtr.Transports = []string{}
+	}
+	queryStr := `
+		INSERT INTO passkeys (user_id, credential_id, public_key, sign_count, transports, name, backup_eligible, backed_up)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at;`
+	row := pr.db.QueryRowContext(ctx, queryStr, pPtr.UserID, pPtr.CredentialID, pPtr.PublicKey, int64(pPtr.SignCount),
+		pq.Array(pPtr.Transports), pPtr.Name, pPtr.BackupEligible, pPtr.BackedUp)
+	err := row.Scan(&pPtr.ID, &pPtr.CreatedAt)
+	if err != nil {
+		return dbError("creating passkey in repo", err)
+	}
+	pPtr.LastUsedAt = nil
+	return nil
+}
+
+func (pr PasskeyRepo) GetByCredentialID(ctx context.Context, credentialID []byte) (*model.Passkey, error) {
+	queryStr := `
+		SELECT ` + passkeyColumns + `
+		FROM passkeys
+		WHERE credential_id = $1;`
+	rows, err := pr.db.QueryContext(ctx, queryStr, credentialID)
+	if err != nil {
+		return nil, dbError("selecting passkey from repo", err)
+	}
+	passkeys, err := scanPasskeys(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(passkeys) == 0 {
+		return nil, fmt.Errorf("selecting passkey from repo: %w", apperr.ErrNotFound)
+	}
+	return &passkeys[0], nil
+}
+
+// ListByUser returns the passkeys of a user, oldest first
+func (pr PasskeyRepo) ListByUser(ctx context.Context, userID int) ([]model.Passkey, error) {
+	queryStr := `
+		SELECT ` + passkeyColumns + `
+		FROM passkeys
+		WHERE user_id = $1
+		ORDER BY id;`
+	rows, err := pr.db.QueryContext(ctx, queryStr, userID)
+	if err != nil {
+		return nil, dbError("selecting passkeys from repo", err)
+	}
+	return scanPasskeys(rows)
+}
+
+// RecordUse stores the sign count and backup state of a login with the
+// passkey. A sign count that isn't above the stored one, unless the
+// authenticator doesn't count, updates nothing and gives ErrNotFound: another
+// login got in first and the credential may be cloned.
+func (pr PasskeyRepo) RecordUse(ctx context.Context, id int, signCount uint32, backedUp bool) error {
+	queryStr := `
+		UPDATE passkeys
+		SET sign_count = $2, backed_up = $3, last_used_at = $4
+		WHERE id = $1 AND (sign_count < $2 OR $2 = 0);`
+	res, err := pr.db.ExecContext(ctx, queryStr, id, int64(signCount), backedUp, time.Now())
+	if err != nil {
+		return dbError("recording passkey use in repo", err)
+	}
+	updatedRow, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking updated row: %w", err)
+	}
+	if updatedRow == 0 {
+		return fmt.Errorf("zero updated row: %w", apperr.ErrNotFound)
+	}
+	return nil
+}
+
+func (pr PasskeyRepo) Rename(ctx context.Context, userID, id int, name string) error {
+	queryStr := `
+		UPDATE passkeys
+		SET name = $3
+		WHERE id = $2 AND user_id = $1;`
+	res, err := pr.db.ExecContext(ctx, queryStr, userID, id, name)
+	if err != nil {
+		return dbError("renaming passkey in repo", err)
+	}
+	updatedRow, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking updated row: %w", err)
+	}
+	if updatedRow == 0 {
+		return fmt.Errorf("zero updated row: %w", apperr.ErrNotFound)
+	}
+	return nil
+}
+
+func (pr PasskeyRepo) Delete(ctx context.Context, userID, id int) error {
+	queryStr := `
+		DELETE FROM passkeys
+		WHERE id = $2 AND user_id = $1;`
+	res, err := pr.db.ExecContext(ctx, queryStr, userID, id)
+	if err != nil {
+		return dbError("deleting passkey in repo", err)
+	}
+	deletedRow, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking deleted row: %w", err)
+	}
+	if deletedRow == 0 {
+		return fmt.Errorf("zero deleted row: %w", apperr.ErrNotFound)
+	}
+	return nil
+}
+
+const passkeyColumns = `id, user_id, credential_id, public_key, sign_count, transports, name,
+			backup_eligible, backed_up, created_at, last_used_at`
+
+func scanPasskeys(rows *sql.Rows) ([]model.Passkey, error) {
+	defer rows.Close()
+	passkeys := []model.Passkey{}
+	for rows.Next() {
+		var p model.Passkey
+		var signCount int64
+		err := rows.Scan(&p.ID, &p.UserID, &p.CredentialID, &p.PublicKey, &signCount, pq.Array(&p.Transports), &p.Name,
+			&p.BackupEligible, &p.BackedUp, &p.CreatedAt, &p.LastUsedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scanning passkey: %w", err)
+		}
+		p.SignCount = uint32(signCount)
+		passkeys = append(passkeys, p)
+	}
+	err := rows.Err()
+	if err != nil {
+		return nil, dbError("selecting passkeys from repo", err)
+	}
+	return passkeys, nil
+}
@@ -1,14 +1,14 @@
 package repo
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 
 	"github.com/suryasaputra2016/course/backend/model"
 )
 
 type PasswordResetRepo struct {
-	db *sql.DB
+	db DBTX
 }
 
 func NewPasswordResetRepo(db *sql.DB) *PasswordResetRepo {
@@ -17,20 +17,23 @@ func NewPasswordResetRepo(db *sql.DB) *PasswordResetRepo {
 	}
 }
 
-func (prr PasswordResetRepo) Create(prPtr *model.PasswordReset) error {
+// Upsert stores the reset of a user, replacing the token of any earlier request
+func (prr PasswordResetRepo) Upsert(ctx context.Context, prPtr *model.PasswordReset) error {
 	queryStr := `
 	INSERT INTO password_resets (user_id, token_hash, expiration_time)
 	VALUES ($1, $2, $3)
+	ON CONFLICT (user_id) DO UPDATE
+	SET token_hash = EXCLUDED.token_hash, expiration_time = EXCLUDED.expiration_time
 	RETURNING id;`
-	row := prr.db.QueryRow(queryStr, prPtr.UserID, prPtr.TokenHash, prPtr.ExpirationTime)
+	row := prr.db.QueryRowContext(ctx, queryStr, prPtr.UserID, prPtr.TokenHash, prPtr.ExpirationTime)
 	err := row.Scan(&prPtr.ID)
 	if err != nil {
-		return fmt.Errorf("creating password reset in repo: %w", err)
+		return dbError("upserting password reset in repo", err)
 	}
 	return nil
 }
 
-func (prr PasswordResetRepo) GetFromTokenHash(tokenHash string) (*model.PasswordReset, error) {
+func (prr PasswordResetRepo) GetFromTokenHash(ctx context.Context, tokenHash string) (*model.PasswordReset, error) {
 	passReset := model.PasswordReset{
 		TokenHash: tokenHash,
 	}
@@ -38,10 +41,29 @@ func (prr PasswordResetRepo) GetFromTokenHash(tokenHash string) (*model.Password
 	SELECT id, user_id, expiration_time
 	FROM password_resets
 	WHERE token_hash = $1;`
-	row := prr.db.QueryRow(queryStr, tokenHash)
+	row := prr.db.QueryRowContext(ctx, queryStr, tokenHash)
 	err := row.Scan(&passReset.ID, &passReset.UserID, &passReset.ExpirationTime)
 	if err != nil {
-		return nil, fmt.Errorf("getting pasword reset from repo: %w", err)
+		return nil, dbError("getting pasword reset from repo", err)
+	}
+
+	return &passReset, nil
+}
+
+// Consume deletes and returns the reset of tokenHash, so a token works only once
+// even when two requests use it at the same time
+func (prr PasswordResetRepo) Consume(ctx context.Context, tokenHash string) (*model.PasswordReset, error) {
+	passReset := model.PasswordReset{
+		TokenHash: tokenHash,
+	}
+	queryStr := `
+	DELETE FROM password_resets
+	WHERE token_hash = $1
+	RETURNING id, user_id, expiration_time;`
+	row := prr.db.QueryRowContext(ctx, queryStr, tokenHash)
+	err := row.Scan(&passReset.ID, &passReset.UserID, &passReset.ExpirationTime)
+	if err != nil {
+		return nil, dbError("consuming password reset in repo", err)
 	}
 
 	return &passReset, nil
@@ -0,0 +1,160 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type QuestionRepo struct {
+	db DBTX
+}
+
+func NewQuestionRepo(db *sql.DB) *QuestionRepo {
+	return &QuestionRepo{db: db}
+}
+
+func (qr QuestionRepo) Create(ctx context.Context, qPtr *model.Question) error {
+	answerSpec, variables, err := marshalQuestionJSON(qPtr)
+	if err != nil {
+		return err
+	}
+	queryStr := `
+		INSERT INTO questions (author_id, title, statement, topic, difficulty, answer_spec, variables,
+			max_attempts, cooldown_seconds)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at, updated_at;`
+	row := qr.db.QueryRowContext(ctx, queryStr, qPtr.AuthorID, qPtr.Title, qPtr.Statement,
+		qPtr.Topic, qPtr.Difficulty, answerSpec, variables, qPtr.MaxAttempts, qPtr.CooldownSeconds)
+	err = row.Scan(&qPtr.ID, &qPtr.CreatedAt, &qPtr.UpdatedAt)
+	if err != nil {
+		return dbError("creating question in repo", err)
+	}
+	return nil
+}
+
+func (qr QuestionRepo) GetByID(ctx context.Context, id int) (*model.Question, error) {
+	queryStr := `
+		SELECT id, author_id, title, statement, topic, difficulty, answer_spec, variables,
+			max_attempts, cooldown_seconds, created_at, updated_at
+		FROM questions
+		WHERE id = $1;`
+	row := qr.db.QueryRowContext(ctx, queryStr, id)
+	question, err := scanQuestion(row)
+	if err != nil {
+		return nil, dbError("selecting question by id in repo", err)
+	}
+	return question, nil
+}
+
+// List returns questions newest first, filtered by topic when topic is not empty
+func (qr QuestionRepo) List(ctx context.Context, topic string, limit, offset int) ([]model.Question, error) {
+	queryStr := `
+		SELECT id, author_id, title, statement, topic, difficulty, answer_spec, variables,
+			max_attempts, cooldown_seconds, created_at, updated_at
+		FROM questions
+		WHERE $1 = '' OR topic = $1
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3;`
+	rows, err := qr.db.QueryContext(ctx, queryStr, topic, limit, offset)
+	if err != nil {
+		return nil, dbError("selecting questions in repo", err)
+	}
+	defer rows.Close()
+
+	questions := []model.Question{}
+	for rows.Next() {
+		question, err := scanQuestion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning question in repo: %w", err)
+		}
+		questions = append(questions, *question)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating questions in repo: %w", err)
+	}
+	return questions, nil
+}
+
+func (qr QuestionRepo) Update(ctx context.Context, qPtr *model.Question) error {
+	answerSpec, variables, err := marshalQuestionJSON(qPtr)
+	if err != nil {
+		return err
+	}
+	queryStr := `
+		UPDATE questions
+		SET title = $1, statement = $2, topic = $3, difficulty = $4, answer_spec = $5, variables = $6,
+			max_attempts = $7, cooldown_seconds = $8, updated_at = NOW()
+		WHERE id = $9
+		RETURNING updated_at;`
+	row := qr.db.QueryRowContext(ctx, queryStr, qPtr.Title, qPtr.Statement, qPtr.Topic,
+		qPtr.Difficulty, answerSpec, variables, qPtr.MaxAttempts, qPtr.CooldownSeconds, qPtr.ID)
+	err = row.Scan(&qPtr.UpdatedAt)
+	if err != nil {
+		return dbError("updating question in repo", err)
+	}
+	return nil
+}
+
+func (qr QuestionRepo) Delete(ctx context.Context, id int) error {
+	queryStr := `
+		DELETE FROM questions
+		WHERE id = $1;`
+	res, err := qr.db.ExecContext(ctx, queryStr, id)
+	if err != nil {
+		return dbError("deleting question in repo", err)
+	}
+	deletedRow, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking deleted row: %w", err)
+	}
+	if deletedRow == 0 {
+		return fmt.Errorf("zero deleted row: %w", apperr.ErrNotFound)
+	}
+	return nil
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanQuestion(row rowScanner) (*model.Question, error) {
+	var question model.Question
+	var answerSpec, variables []byte
+	err := row.Scan(&question.ID, &question.AuthorID, &question.Title, &question.Statement,
+		&question.Topic, &question.Difficulty, &answerSpec, &variables,
+		&question.MaxAttempts, &question.CooldownSeconds, &question.CreatedAt, &question.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(answerSpec, &question.AnswerSpec)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshaling answer spec: %w", err)
+	}
+	err = json.Unmarshal(variables, &question.Variables)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshaling variables: %w", err)
+	}
+	return &question, nil
+}
+
+func marshalQuestionJSON(qPtr *model.Question) ([]byte, []byte, error) {
+	answerSpec, err := json.Marshal(qPtr.AnswerSpec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshaling answer spec: %w", err)
+	}
+	variables := qPtr.Variables
+	if variables == nil {
+		variables = []model.Variable{}
+	}
+	variablesJSON, err := json.Marshal(variables)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshaling variables: %w", err)
+	}
+	return answerSpec, variablesJSON, nil
+}
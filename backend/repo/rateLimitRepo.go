@@ -0,0 +1,80 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type RateLimitRepo struct {
+	db DBTX
+}
+
+func NewRateLimitRepo(db *sql.DB) *RateLimitRepo {
+	return &RateLimitRepo{db: db}
+}
+
+// Take spends a token of the bucket named key, checking and spending in one
+// statement so concurrent requests can't both get the last token. It returns
+// how long to wait when the bucket is empty.
+func (rlr RateLimitRepo) Take(ctx context.Context, key string, limit model.RateLimit) (bool, time.Duration, error) {
+	every := limit.Every.Seconds()
+	slack := float64(limit.Burst-1) * every
+	queryStr := `
+		INSERT INTO rate_limits AS rl (key, full_at)
+		VALUES ($1, NOW() + make_interval(secs => $2::float8))
+		ON CONFLICT (key) DO UPDATE
+		SET full_at = GREATEST(rl.full_at, NOW()) + make_interval(secs => $2::float8)
+		WHERE rl.full_at <= NOW() + make_interval(secs => $3::float8)
+		RETURNING full_at;`
+	var fullAt time.Time
+	err := rlr.db.QueryRowContext(ctx, queryStr, key, every, slack).Scan(&fullAt)
+	if err == nil {
+		return true, 0, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, 0, dbError("taking rate limit token in repo", err)
+	}
+
+	// no row means the conflicting bucket had no token left
+	queryStr = `
+		SELECT EXTRACT(EPOCH FROM full_at - NOW()) - $2::float8
+		FROM rate_limits
+		WHERE key = $1;`
+	var retryAfter float64
+	err = rlr.db.QueryRowContext(ctx, queryStr, key, slack).Scan(&retryAfter)
+	if err != nil {
+		return false, 0, dbError("selecting rate limit in repo", err)
+	}
+	return false, time.Duration(retryAfter * float64(time.Second)), nil
+}
+
+// DeleteFull deletes at most batchSize buckets that have refilled, they are
+// the same as no bucket
+func (rlr RateLimitRepo) DeleteFull(ctx context.Context, batchSize int) (int64, error) {
+	queryStr := `
+		DELETE FROM rate_limits
+		WHERE key IN (
+			SELECT key FROM rate_limits
+			WHERE full_at <= NOW()
+			LIMIT $1
+		);`
+	res, err := rlr.db.ExecContext(ctx, queryStr, batchSize)
+	if err != nil {
+		return 0, dbError("deleting full rate limits", err)
+	}
+	deletedRow, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("checking deleted row: %w", err)
+	}
+	return deletedRow, nil
+}
+
+// ReapFull deletes refilled buckets in batches every interval until ctx is done
+func (rlr RateLimitRepo) ReapFull(ctx context.Context, interval time.Duration, batchSize int) {
+	reap(ctx, interval, batchSize, "full rate limits", rlr.DeleteFull)
+}
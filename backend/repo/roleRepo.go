@@ -0,0 +1,137 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type RoleRepo struct {
+	db DBTX
+}
+
+func NewRoleRepo(db *sql.DB) *RoleRepo {
+	return &RoleRepo{db: db}
+}
+
+// Grant gives role to the user and records the change in the audit table, an
+// actorID of 0 records the change as made by no user
+func (rr RoleRepo) Grant(ctx context.Context, userID int, role string, actorID int) error {
+	queryStr := `
+		WITH granted AS (
+			INSERT INTO user_roles (user_id, role_id, granted_by)
+			SELECT $1, id, NULLIF($3, 0)
+			FROM roles
+			WHERE name = $2
+			ON CONFLICT DO NOTHING
+			RETURNING role_id
+		)
+		INSERT INTO role_audits (actor_id, target_user_id, role_name, action)
+		SELECT NULLIF($3, 0), $1, $2, $4
+		FROM granted;`
+	res, err := rr.db.ExecContext(ctx, queryStr, userID, role, actorID, model.RoleActionGrant)
+	if err != nil {
+		return dbError("granting role in repo", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking granted row: %w", err)
+	}
+	if affected == 0 {
+		return apperr.Conflict(fmt.Sprintf("role %s unknown or already granted", role))
+	}
+	return nil
+}
+
+// Revoke takes role from the user and records the change in the audit table
+func (rr RoleRepo) Revoke(ctx context.Context, userID int, role string, actorID int) error {
+	queryStr := `
+		WITH revoked AS (
+			DELETE FROM user_roles
+			USING roles
+			WHERE user_roles.role_id = roles.id
+				AND user_roles.user_id = $1
+				AND roles.name = $2
+			RETURNING user_roles.role_id
+		)
+		INSERT INTO role_audits (actor_id, target_user_id, role_name, action)
+		SELECT $3, $1, $2, $4
+		FROM revoked;`
+	res, err := rr.db.ExecContext(ctx, queryStr, userID, role, actorID, model.RoleActionRevoke)
+	if err != nil {
+		return dbError("revoking role in repo", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking revoked row: %w", err)
+	}
+	if affected == 0 {
+		return apperr.Conflict(fmt.Sprintf("role %s not held by user", role))
+	}
+	return nil
+}
+
+// CountHolders returns how many users hold role
+func (rr RoleRepo) CountHolders(ctx context.Context, role string) (int, error) {
+	var count int
+	queryStr := `
+		SELECT COUNT(*)
+		FROM user_roles
+		JOIN roles ON roles.id = user_roles.role_id
+		WHERE roles.name = $1;`
+	row := rr.db.QueryRowContext(ctx, queryStr, role)
+	err := row.Scan(&count)
+	if err != nil {
+		return 0, dbError("counting role holders in repo", err)
+	}
+	return count, nil
+}
+
+// HasPermission reports whether any role of the user carries permission
+func (rr RoleRepo) HasPermission(ctx context.Context, userID int, permission string) (bool, error) {
+	var has bool
+	queryStr := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM user_roles
+			JOIN role_permissions ON role_permissions.role_id = user_roles.role_id
+			JOIN permissions ON permissions.id = role_permissions.permission_id
+			WHERE user_roles.user_id = $1 AND permissions.name = $2
+		);`
+	row := rr.db.QueryRowContext(ctx, queryStr, userID, permission)
+	err := row.Scan(&has)
+	if err != nil {
+		return false, dbError("checking permission in repo", err)
+	}
+	return has, nil
+}
+
+func (rr RoleRepo) ListAudits(ctx context.Context, limit, offset int) ([]model.RoleAudit, error) {
+	queryStr := `
+		SELECT id, COALESCE(actor_id, 0), target_user_id, role_name, action, created_at
+		FROM role_audits
+		ORDER BY id DESC
+		LIMIT $1 OFFSET $2;`
+	rows, err := rr.db.QueryContext(ctx, queryStr, limit, offset)
+	if err != nil {
+		return nil, dbError("selecting role audits", err)
+	}
+	defer rows.Close()
+
+	audits := []model.RoleAudit{}
+	for rows.Next() {
+		var audit model.RoleAudit
+		err = rows.Scan(&audit.ID, &audit.ActorID, &audit.TargetUserID, &audit.RoleName, &audit.Action, &audit.CreatedAt)
+		if err != nil {
+			return nil, dbError("scanning role audit", err)
+		}
+		audits = append(audits, audit)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating role audits: %w", err)
+	}
+	return audits, nil
+}
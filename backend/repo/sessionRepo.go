@@ -1,62 +1,244 @@
 package repo
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log"
+	"time"
 
+	"github.com/suryasaputra2016/course/backend/apperr"
 	"github.com/suryasaputra2016/course/backend/model"
 )
 
+const (
+	// SessionIdleTimeout is how long a session lives without activity
+	SessionIdleTimeout = 24 * time.Hour
+	// SessionAbsoluteTimeout is how long a session lives regardless of activity
+	SessionAbsoluteTimeout = 30 * 24 * time.Hour
+	// reapBatchTimeout bounds one batch delete of the session reaper
+	reapBatchTimeout = 30 * time.Second
+)
+
 type SessionRepo struct {
-	db *sql.DB
+	db DBTX
 }
 
 func NewSessionRepo(db *sql.DB) *SessionRepo {
 	return &SessionRepo{db: db}
 }
 
-func (sr SessionRepo) Create(sPtr *model.Session) error {
+func (sr SessionRepo) Create(ctx context.Context, sPtr *model.Session) error {
+	now := time.Now()
+	sPtr.CreatedAt = now
+	sPtr.LastSeenAt = now
+	sPtr.ExpiresAt = now.Add(SessionIdleTimeout)
+	sPtr.AbsoluteExpiresAt = now.Add(SessionAbsoluteTimeout)
+
 	queryStr := `
-		INSERT INTO sessions (user_id, token_hash)
-		VALUES ($1, $2)
+		INSERT INTO sessions (user_id, token_hash, created_at, last_seen_at, expires_at, absolute_expires_at, user_agent, ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id;`
-	row := sr.db.QueryRow(queryStr, sPtr.UserID, sPtr.TokenHash)
+	row := sr.db.QueryRowContext(ctx, queryStr, sPtr.UserID, sPtr.TokenHash,
+		sPtr.CreatedAt, sPtr.LastSeenAt, sPtr.ExpiresAt, sPtr.AbsoluteExpiresAt, sPtr.UserAgent, sPtr.IP)
 	err := row.Scan(&sPtr.ID)
 	if err != nil {
-		return fmt.Errorf("creating session in repo: %w", err)
+		return dbError("creating session in repo", err)
 	}
 	return nil
 }
 
-func (sr SessionRepo) GetFromTokenHash(tokenHash string) (*model.Session, error) {
+// GetFromTokenHash returns the session only if it has not expired
+func (sr SessionRepo) GetFromTokenHash(ctx context.Context, tokenHash string) (*model.Session, error) {
 	var session model.Session
 	queryStr := `
-		SELECT id, user_id
+		SELECT id, user_id, created_at, last_seen_at, expires_at, absolute_expires_at, user_agent, ip
 		FROM sessions
-		WHERE token_hash = $1;`
-	row := sr.db.QueryRow(queryStr, tokenHash)
-	err := row.Scan(&session.ID, &session.UserID)
+		WHERE token_hash = $1
+			AND expires_at > NOW()
+			AND absolute_expires_at > NOW();`
+	row := sr.db.QueryRowContext(ctx, queryStr, tokenHash)
+	err := row.Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.LastSeenAt,
+		&session.ExpiresAt, &session.AbsoluteExpiresAt, &session.UserAgent, &session.IP)
 	if err != nil {
-		return nil, fmt.Errorf("selecting session: %w", err)
+		return nil, dbError("selecting session", err)
 	}
 	session.TokenHash = tokenHash
 	return &session, nil
 }
 
-func (sr SessionRepo) DeleteFromTokenHash(tokenHash string) error {
+// ListByUser returns the unexpired sessions of a user, last used first
+func (sr SessionRepo) ListByUser(ctx context.Context, userID int) ([]model.Session, error) {
+	queryStr := `
+		SELECT id, token_hash, created_at, last_seen_at, expires_at, absolute_expires_at, user_agent, ip
+		FROM sessions
+		WHERE user_id = $1
+			AND expires_at > NOW()
+			AND absolute_expires_at > NOW()
+		ORDER BY last_seen_at DESC, id DESC;`
+	rows, err := sr.db.QueryContext(ctx, queryStr, userID)
+	if err != nil {
+		return nil, dbError("selecting sessions from repo", err)
+	}
+	defer rows.Close()
+
+	sessions := []model.Session{}
+	for rows.Next() {
+		session := model.Session{UserID: userID}
+		err = rows.Scan(&session.ID, &session.TokenHash, &session.CreatedAt, &session.LastSeenAt,
+			&session.ExpiresAt, &session.AbsoluteExpiresAt, &session.UserAgent, &session.IP)
+		if err != nil {
+			return nil, dbError("scanning session", err)
+		}
+		sessions = append(sessions, session)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, dbError("iterating sessions", err)
+	}
+	return sessions, nil
+}
+
+// Renew slides the idle expiry forward, never past the absolute expiry
+func (sr SessionRepo) Renew(ctx context.Context, sPtr *model.Session) error {
+	now := time.Now()
+	expiresAt := now.Add(SessionIdleTimeout)
+	if expiresAt.After(sPtr.AbsoluteExpiresAt) {
+		expiresAt = sPtr.AbsoluteExpiresAt
+	}
+
+	queryStr := `
+		UPDATE sessions
+		SET last_seen_at = $1, expires_at = $2
+		WHERE id = $3;`
+	_, err := sr.db.ExecContext(ctx, queryStr, now, expiresAt, sPtr.ID)
+	if err != nil {
+		return dbError("renewing session", err)
+	}
+	sPtr.LastSeenAt = now
+	sPtr.ExpiresAt = expiresAt
+	return nil
+}
+
+func (sr SessionRepo) DeleteFromTokenHash(ctx context.Context, tokenHash string) error {
 	queryStr := `
 		DELETE FROM sessions
 			WHERE token_hash = $1`
-	res, err := sr.db.Exec(queryStr, tokenHash)
+	res, err := sr.db.ExecContext(ctx, queryStr, tokenHash)
 	if err != nil {
-		return fmt.Errorf("deleting session: %w", err)
+		return dbError("deleting session", err)
 	}
 	deletedRow, err := res.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("checking deleted row: %w", err)
 	}
 	if deletedRow == 0 {
-		return fmt.Errorf("zero deleted row")
+		return fmt.Errorf("zero deleted row: %w", apperr.ErrNotFound)
+	}
+	return nil
+}
+
+// DeleteByUserID deletes every session of the user, logging them out everywhere
+func (sr SessionRepo) DeleteByUserID(ctx context.Context, userID int) error {
+	queryStr := `
+		DELETE FROM sessions
+		WHERE user_id = $1;`
+	_, err := sr.db.ExecContext(ctx, queryStr, userID)
+	if err != nil {
+		return dbError("deleting user sessions", err)
 	}
 	return nil
 }
+
+// Delete deletes a session of the user, the session of another user is not found
+func (sr SessionRepo) Delete(ctx context.Context, userID, id int) error {
+	queryStr := `
+		DELETE FROM sessions
+		WHERE id = $2 AND user_id = $1;`
+	res, err := sr.db.ExecContext(ctx, queryStr, userID, id)
+	if err != nil {
+		return dbError("deleting session", err)
+	}
+	deletedRow, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking deleted row: %w", err)
+	}
+	if deletedRow == 0 {
+		return fmt.Errorf("zero deleted row: %w", apperr.ErrNotFound)
+	}
+	return nil
+}
+
+// DeleteOthers deletes every session of the user but keepID, logging them out
+// everywhere else, and returns how many it deleted
+func (sr SessionRepo) DeleteOthers(ctx context.Context, userID, keepID int) (int64, error) {
+	queryStr := `
+		DELETE FROM sessions
+		WHERE user_id = $1 AND id <> $2;`
+	res, err := sr.db.ExecContext(ctx, queryStr, userID, keepID)
+	if err != nil {
+		return 0, dbError("deleting other sessions", err)
+	}
+	deletedRow, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("checking deleted row: %w", err)
+	}
+	return deletedRow, nil
+}
+
+// DeleteExpired deletes at most batchSize expired sessions
+func (sr SessionRepo) DeleteExpired(ctx context.Context, batchSize int) (int64, error) {
+	queryStr := `
+		DELETE FROM sessions
+		WHERE id IN (
+			SELECT id FROM sessions
+			WHERE expires_at <= NOW() OR absolute_expires_at <= NOW()
+			LIMIT $1
+		);`
+	res, err := sr.db.ExecContext(ctx, queryStr, batchSize)
+	if err != nil {
+		return 0, dbError("deleting expired sessions", err)
+	}
+	deletedRow, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("checking deleted row: %w", err)
+	}
+	return deletedRow, nil
+}
+
+// ReapExpired deletes expired sessions in batches every interval until ctx is done
+func (sr SessionRepo) ReapExpired(ctx context.Context, interval time.Duration, batchSize int) {
+	reap(ctx, interval, batchSize, "expired sessions", sr.DeleteExpired)
+}
+
+// reap calls deleteBatch every interval until it deletes less than a full
+// batch, and stops when ctx is done
+func reap(ctx context.Context, interval time.Duration, batchSize int, what string, deleteBatch func(context.Context, int) (int64, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var total int64
+		for {
+			batchCtx, cancel := context.WithTimeout(ctx, reapBatchTimeout)
+			deleted, err := deleteBatch(batchCtx, batchSize)
+			cancel()
+			if err != nil {
+				log.Printf("reaping %s: %s", what, err)
+				break
+			}
+			total += deleted
+			if deleted < int64(batchSize) {
+				break
+			}
+		}
+		if total > 0 {
+			log.Printf("reaped %d %s", total, what)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+// The store interfaces are what handlers, middleware and workers depend on,
+// the postgres repos of this package and the memory package both implement them.
+// A missing row is reported as an error wrapping apperr.ErrNotFound and a broken
+// unique constraint as one wrapping apperr.ErrConflict.
+
+type UserStore interface {
+	Create(ctx context.Context, userPtr *model.User) error
+	GetByEmail(ctx context.Context, email string) (*model.User, error)
+	GetByID(ctx context.Context, id int) (*model.User, error)
+	UpdatePassword(ctx context.Context, id int, newPasswordHash string) error
+	UpdateEmailVerification(ctx context.Context, id int) error
+	// RecordLoginFailure counts a wrong password and returns the failures
+	// since the last successful login
+	RecordLoginFailure(ctx context.Context, id int) (int, error)
+	LockUntil(ctx context.Context, id int, until time.Time) error
+	ResetLoginFailures(ctx context.Context, id int) error
+	Delete(ctx context.Context, id int) error
+}
+
+type SessionStore interface {
+	Create(ctx context.Context, sPtr *model.Session) error
+	GetFromTokenHash(ctx context.Context, tokenHash string) (*model.Session, error)
+	ListByUser(ctx context.Context, userID int) ([]model.Session, error)
+	Renew(ctx context.Context, sPtr *model.Session) error
+	DeleteFromTokenHash(ctx context.Context, tokenHash string) error
+	Delete(ctx context.Context, userID, id int) error
+	DeleteOthers(ctx context.Context, userID, keepID int) (int64, error)
+	DeleteByUserID(ctx context.Context, userID int) error
+	DeleteExpired(ctx context.Context, batchSize int) (int64, error)
+}
+
+type PasswordResetStore interface {
+	Upsert(ctx context.Context, prPtr *model.PasswordReset) error
+	GetFromTokenHash(ctx context.Context, tokenHash string) (*model.PasswordReset, error)
+	Consume(ctx context.Context, tokenHash string) (*model.PasswordReset, error)
+}
+
+type EmailVerificationStore interface {
+	Upsert(ctx context.Context, evPtr *model.EmailVerification) error
+	GetFromTokenHash(ctx context.Context, tokenHash string) (*model.EmailVerification, error)
+	GetByUserID(ctx context.Context, userID int) (*model.EmailVerification, error)
+	DeleteByUserID(ctx context.Context, userID int) error
+}
+
+type OutboxStore interface {
+	Enqueue(ctx context.Context, ePtr *model.OutboxEmail) error
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]model.OutboxEmail, error)
+	MarkSent(ctx context.Context, id int) error
+	MarkFailed(ctx context.Context, id int, sendErr error, backoff time.Duration, maxAttempts int) error
+	List(ctx context.Context, status string, limit, offset int) ([]model.OutboxEmail, error)
+	Requeue(ctx context.Context, id int) error
+	DeleteFinished(ctx context.Context, retention time.Duration, batchSize int) (int64, error)
+}
+
+type RoleStore interface {
+	Grant(ctx context.Context, userID int, role string, actorID int) error
+	Revoke(ctx context.Context, userID int, role string, actorID int) error
+	CountHolders(ctx context.Context, role string) (int, error)
+	HasPermission(ctx context.Context, userID int, permission string) (bool, error)
+	ListAudits(ctx context.Context, limit, offset int) ([]model.RoleAudit, error)
+}
+
+type QuestionStore interface {
+	Create(ctx context.Context, qPtr *model.Question) error
+	GetByID(ctx context.Context, id int) (*model.Question, error)
+	List(ctx context.Context, topic string, limit, offset int) ([]model.Question, error)
+	Update(ctx context.Context, qPtr *model.Question) error
+	Delete(ctx context.Context, id int) error
+}
+
+type SubmissionStore interface {
+	Create(ctx context.Context, sPtr *model.Submission) error
+	AttemptStats(ctx context.Context, userID, questionID int) (*model.AttemptStats, error)
+	ListByUser(ctx context.Context, userID, questionID, limit, offset int) ([]model.Submission, error)
+}
+
+// TwoFactorStore keeps the TOTP enrolment and recovery codes of users
+type TwoFactorStore interface {
+	// UpsertTOTP replaces an unconfirmed enrolment, a confirmed one is a conflict
+	UpsertTOTP(ctx context.Context, tPtr *model.TOTP) error
+	GetTOTP(ctx context.Context, userID int) (*model.TOTP, error)
+	ConfirmTOTP(ctx context.Context, userID int, step int64) error
+	// UseTOTPStep fails with not found unless step is newer than the last one used
+	UseTOTPStep(ctx context.Context, userID int, step int64) error
+	DeleteTOTP(ctx context.Context, userID int) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) error
+}
+
+type LoginChallengeStore interface {
+	Create(ctx context.Context, cPtr *model.LoginChallenge) error
+	GetFromTokenHash(ctx context.Context, tokenHash string) (*model.LoginChallenge, error)
+	RecordAttempt(ctx context.Context, id int) (int, error)
+	Delete(ctx context.Context, id int) error
+	DeleteExpired(ctx context.Context, batchSize int) (int64, error)
+}
+
+type PasskeyStore interface {
+	Create(ctx context.Context, pPtr *model.Passkey) error
+	GetByCredentialID(ctx context.Context, credentialID []byte) (*model.Passkey, error)
+	ListByUser(ctx context.Context, userID int) ([]model.Passkey, error)
+	RecordUse(ctx context.Context, id int, signCount uint32, backedUp bool) error
+	// Rename and Delete only touch a passkey of userID
+	Rename(ctx context.Context, userID, id int, name string) error
+	Delete(ctx context.Context, userID, id int) error
+}
+
+type PasskeyChallengeStore interface {
+	Create(ctx context.Context, cPtr *model.PasskeyChallenge) error
+	Consume(ctx context.Context, challengeHash, ceremony string) (*model.PasskeyChallenge, error)
+	DeleteExpired(ctx context.Context, batchSize int) (int64, error)
+}
+
+// OAuthIdentityStore keeps which provider accounts log in as which user
+type OAuthIdentityStore interface {
+	Create(ctx context.Context, iPtr *model.OAuthIdentity) error
+	GetBySubject(ctx context.Context, provider, subject string) (*model.OAuthIdentity, error)
+}
+
+type OAuthStateStore interface {
+	Create(ctx context.Context, sPtr *model.OAuthState) error
+	Consume(ctx context.Context, stateHash string) (*model.OAuthState, error)
+	DeleteExpired(ctx context.Context, batchSize int) (int64, error)
+}
+
+// RateLimitStore keeps token buckets by key, see model.RateLimit
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit model.RateLimit) (bool, time.Duration, error)
+	DeleteFull(ctx context.Context, batchSize int) (int64, error)
+}
+
+// Transactor runs fn with repos that commit or roll back together
+type Transactor interface {
+	Do(ctx context.Context, fn func(r Repos) error) error
+}
+
+var (
+	_ UserStore              = (*UserRepo)(nil)
+	_ SessionStore           = (*SessionRepo)(nil)
+	_ PasswordResetStore     = (*PasswordResetRepo)(nil)
+	_ EmailVerificationStore = (*EmailVerificationRepo)(nil)
+	_ OutboxStore            = (*OutboxRepo)(nil)
+	_ RoleStore              = (*RoleRepo)(nil)
+	_ QuestionStore          = (*QuestionRepo)(nil)
+	_ SubmissionStore        = (*SubmissionRepo)(nil)
+	_ RateLimitStore         = (*RateLimitRepo)(nil)
+	_ TwoFactorStore         = (*TwoFactorRepo)(nil)
+	_ LoginChallengeStore    = (*LoginChallengeRepo)(nil)
+	_ PasskeyStore           = (*PasskeyRepo)(nil)
+	_ PasskeyChallengeStore  = (*PasskeyChallengeRepo)(nil)
+	_ OAuthIdentityStore     = (*OAuthIdentityRepo)(nil)
+	_ OAuthStateStore        = (*OAuthStateRepo)(nil)
+	_ Transactor             = (*UnitOfWork)(nil)
+)
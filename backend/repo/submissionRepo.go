@@ -0,0 +1,89 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type SubmissionRepo struct {
+	db DBTX
+}
+
+func NewSubmissionRepo(db *sql.DB) *SubmissionRepo {
+	return &SubmissionRepo{db: db}
+}
+
+func (sbr SubmissionRepo) Create(ctx context.Context, sPtr *model.Submission) error {
+	verdict, err := json.Marshal(sPtr.Verdict)
+	if err != nil {
+		return fmt.Errorf("marshaling verdict: %w", err)
+	}
+	queryStr := `
+		INSERT INTO submissions (user_id, question_id, answer, is_correct, verdict)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at;`
+	row := sbr.db.QueryRowContext(ctx, queryStr, sPtr.UserID, sPtr.QuestionID, sPtr.Answer,
+		sPtr.Verdict.IsCorrect, verdict)
+	err = row.Scan(&sPtr.ID, &sPtr.CreatedAt)
+	if err != nil {
+		return dbError("creating submission in repo", err)
+	}
+	return nil
+}
+
+// AttemptStats counts the submissions of a user to a question and finds the latest one
+func (sbr SubmissionRepo) AttemptStats(ctx context.Context, userID, questionID int) (*model.AttemptStats, error) {
+	var stats model.AttemptStats
+	var lastAttemptAt sql.NullTime
+	queryStr := `
+		SELECT COUNT(*), MAX(created_at)
+		FROM submissions
+		WHERE user_id = $1 AND question_id = $2;`
+	row := sbr.db.QueryRowContext(ctx, queryStr, userID, questionID)
+	err := row.Scan(&stats.Count, &lastAttemptAt)
+	if err != nil {
+		return nil, dbError("selecting attempt stats in repo", err)
+	}
+	stats.LastAttemptAt = lastAttemptAt.Time
+	return &stats, nil
+}
+
+// ListByUser returns the submissions of a user newest first, filtered by
+// question when questionID is not zero
+func (sbr SubmissionRepo) ListByUser(ctx context.Context, userID, questionID, limit, offset int) ([]model.Submission, error) {
+	queryStr := `
+		SELECT id, user_id, question_id, answer, verdict, created_at
+		FROM submissions
+		WHERE user_id = $1 AND ($2 = 0 OR question_id = $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3 OFFSET $4;`
+	rows, err := sbr.db.QueryContext(ctx, queryStr, userID, questionID, limit, offset)
+	if err != nil {
+		return nil, dbError("selecting submissions in repo", err)
+	}
+	defer rows.Close()
+
+	submissions := []model.Submission{}
+	for rows.Next() {
+		var submission model.Submission
+		var verdict []byte
+		err = rows.Scan(&submission.ID, &submission.UserID, &submission.QuestionID,
+			&submission.Answer, &verdict, &submission.CreatedAt)
+		if err != nil {
+			return nil, dbError("scanning submission in repo", err)
+		}
+		err = json.Unmarshal(verdict, &submission.Verdict)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshaling verdict: %w", err)
+		}
+		submissions = append(submissions, submission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating submissions in repo: %w", err)
+	}
+	return submissions, nil
+}
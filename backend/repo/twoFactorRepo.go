@@ -0,0 +1,138 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+type TwoFactorRepo struct {
+	db DBTX
+}
+
+func NewTwoFactorRepo(db *sql.DB) *TwoFactorRepo {
+	return &TwoFactorRepo{db: db}
+}
+
+// UpsertTOTP starts an enrolment, replacing one that was never confirmed. A
+// confirmed enrolment is kept and reported as apperr.ErrConflict.
+func (tfr TwoFactorRepo) UpsertTOTP(ctx context.Context, tPtr *model.TOTP) error {
+	queryStr := `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0
+		WHERE user_totp.confirmed_at IS NULL
+		RETURNING user_id;`
+	err := tfr.db.QueryRowContext(ctx, queryStr, tPtr.UserID, tPtr.Secret).Scan(&tPtr.UserID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("upserting totp in repo: %w: already confirmed", apperr.ErrConflict)
+	}
+	if err != nil {
+		return dbError("upserting totp in repo", err)
+	}
+	tPtr.ConfirmedAt = time.Time{}
+	tPtr.LastUsedStep = 0
+	return nil
+}
+
+func (tfr TwoFactorRepo) GetTOTP(ctx context.Context, userID int) (*model.TOTP, error) {
+	t := model.TOTP{UserID: userID}
+	queryStr := `
+		SELECT secret, confirmed_at, last_used_step
+		FROM user_totp
+		WHERE user_id = $1;`
+	var confirmedAt sql.NullTime
+	err := tfr.db.QueryRowContext(ctx, queryStr, userID).Scan(&t.Secret, &confirmedAt, &t.LastUsedStep)
+	if err != nil {
+		return nil, dbError("selecting totp from repo", err)
+	}
+	t.ConfirmedAt = confirmedAt.Time
+	return &t, nil
+}
+
+// ConfirmTOTP turns a pending enrolment on, step is the one of the code that confirmed it
+func (tfr TwoFactorRepo) ConfirmTOTP(ctx context.Context, userID int, step int64) error {
+	queryStr := `
+		UPDATE user_totp
+		SET confirmed_at = NOW(), last_used_step = $2
+		WHERE user_id = $1 AND confirmed_at IS NULL;`
+	return tfr.execOne(ctx, "confirming totp in repo", queryStr, userID, step)
+}
+
+// UseTOTPStep records the step of an accepted code, a step that is not newer
+// than the last one is reported as apperr.ErrNotFound, so concurrent logins
+// can't both use one code
+func (tfr TwoFactorRepo) UseTOTPStep(ctx context.Context, userID int, step int64) error {
+	queryStr := `
+		UPDATE user_totp
+		SET last_used_step = $2
+		WHERE user_id = $1 AND last_used_step < $2;`
+	return tfr.execOne(ctx, "using totp step in repo", queryStr, userID, step)
+}
+
+// DeleteTOTP turns two-factor authentication off, recovery codes included
+func (tfr TwoFactorRepo) DeleteTOTP(ctx context.Context, userID int) error {
+	queryStr := `
+		DELETE FROM recovery_codes
+		WHERE user_id = $1;`
+	_, err := tfr.db.ExecContext(ctx, queryStr, userID)
+	if err != nil {
+		return dbError("deleting recovery codes in repo", err)
+	}
+	queryStr = `
+		DELETE FROM user_totp
+		WHERE user_id = $1;`
+	return tfr.execOne(ctx, "deleting totp in repo", queryStr, userID)
+}
+
+// ReplaceRecoveryCodes drops every recovery code of the user for codeHashes
+func (tfr TwoFactorRepo) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	queryStr := `
+		DELETE FROM recovery_codes
+		WHERE user_id = $1;`
+	_, err := tfr.db.ExecContext(ctx, queryStr, userID)
+	if err != nil {
+		return dbError("deleting recovery codes in repo", err)
+	}
+	queryStr = `
+		INSERT INTO recovery_codes (user_id, code_hash)
+		VALUES ($1, $2);`
+	for _, codeHash := range codeHashes {
+		_, err = tfr.db.ExecContext(ctx, queryStr, userID, codeHash)
+		if err != nil {
+			return dbError("inserting recovery code in repo", err)
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode marks an unused code of the user as used, any other code is
+// reported as apperr.ErrNotFound
+func (tfr TwoFactorRepo) UseRecoveryCode(ctx context.Context, userID int, codeHash string) error {
+	queryStr := `
+		UPDATE recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;`
+	return tfr.execOne(ctx, "using recovery code in repo", queryStr, userID, codeHash)
+}
+
+// execOne runs a statement that must change one row
+func (tfr TwoFactorRepo) execOne(ctx context.Context, action, queryStr string, args ...any) error {
+	res, err := tfr.db.ExecContext(ctx, queryStr, args...)
+	if err != nil {
+		return dbError(action, err)
+	}
+	changedRow, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking changed row: %w", err)
+	}
+	if changedRow == 0 {
+		return fmt.Errorf("%s: zero changed row: %w", action, apperr.ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// maxTxAttempts is how many times a transaction runs before a serialization
+// failure is returned to the caller
+const maxTxAttempts = 3
+
+// DBTX is satisfied by both *sql.DB and *sql.Tx, so a repo can run inside a transaction
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Repos are the repositories bound to one transaction of a UnitOfWork
+type Repos struct {
+	Users              UserStore
+	Sessions           SessionStore
+	PasswordResets     PasswordResetStore
+	EmailVerifications EmailVerificationStore
+	Outbox             OutboxStore
+	Roles              RoleStore
+	Questions          QuestionStore
+	Submissions        SubmissionStore
+	RateLimits         RateLimitStore
+	TwoFactor          TwoFactorStore
+	LoginChallenges    LoginChallengeStore
+	Passkeys           PasskeyStore
+	PasskeyChallenges  PasskeyChallengeStore
+	OAuthIdentities    OAuthIdentityStore
+	OAuthStates        OAuthStateStore
+}
+
+func reposFor(tx *sql.Tx) Repos {
+	return Repos{
+		Users:              &UserRepo{db: tx},
+		Sessions:           &SessionRepo{db: tx},
+		PasswordResets:     &PasswordResetRepo{db: tx},
+		EmailVerifications: &EmailVerificationRepo{db: tx},
+		Outbox:             &OutboxRepo{db: tx},
+		Roles:              &RoleRepo{db: tx},
+		Questions:          &QuestionRepo{db: tx},
+		Submissions:        &SubmissionRepo{db: tx},
+		RateLimits:         &RateLimitRepo{db: tx},
+		TwoFactor:          &TwoFactorRepo{db: tx},
+		LoginChallenges:    &LoginChallengeRepo{db: tx},
+		Passkeys:           &PasskeyRepo{db: tx},
+		PasskeyChallenges:  &PasskeyChallengeRepo{db: tx},
+		OAuthIdentities:    &OAuthIdentityRepo{db: tx},
+		OAuthStates:        &OAuthStateRepo{db: tx},
+	}
+}
+
+// UnitOfWork runs several repo operations inside one serializable transaction
+type UnitOfWork struct {
+	db *sql.DB
+}
+
+func NewUnitOfWork(db *sql.DB) *UnitOfWork {
+	return &UnitOfWork{db: db}
+}
+
+// Do runs fn in a transaction, committing when fn returns nil and rolling back
+// otherwise. On a serialization failure or deadlock the whole transaction is
+// retried, so fn must not have side effects outside the database.
+func (uow UnitOfWork) Do(ctx context.Context, fn func(r Repos) error) error {
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err = uow.run(ctx, fn)
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+
+		// jittered wait so two conflicting transactions do not collide again
+		wait := time.Duration(attempt)*10*time.Millisecond + rand.N(10*time.Millisecond)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting to retry transaction: %w", ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+	return fmt.Errorf("transaction failed after %d attempts: %w", maxTxAttempts, err)
+}
+
+func (uow UnitOfWork) run(ctx context.Context, fn func(r Repos) error) error {
+	tx, err := uow.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	err = fn(reposFor(tx))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+	return nil
+}
+
+// isRetryable reports whether err is a postgres serialization failure or deadlock
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
@@ -1,80 +1,165 @@
 package repo
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
+	"github.com/lib/pq"
+	"github.com/suryasaputra2016/course/backend/apperr"
 	"github.com/suryasaputra2016/course/backend/model"
 )
 
+// rolesColumn selects the role names of users.id as a text array
+const rolesColumn = `
+		ARRAY(
+			SELECT roles.name
+			FROM user_roles
+			JOIN roles ON roles.id = user_roles.role_id
+			WHERE user_roles.user_id = users.id
+			ORDER BY roles.id
+		)`
+
 type UserRepo struct {
-	db *sql.DB
+	db DBTX
 }
 
 func NewUserRepo(db *sql.DB) *UserRepo {
 	return &UserRepo{db: db}
 }
 
-func (ur UserRepo) Create(userPtr *model.User) error {
+// Create inserts the user together with its roles in one statement
+func (ur UserRepo) Create(ctx context.Context, userPtr *model.User) error {
 	queryStr := `
-		INSERT INTO users (email, password_hash, role)
-		VALUES ($1, $2, $3)
-		RETURNING id;`
-	row := ur.db.QueryRow(queryStr, userPtr.Email, userPtr.PasswordHash, userPtr.Role)
+		WITH new_user AS (
+			INSERT INTO users (email, password_hash)
+			VALUES ($1, $2)
+			RETURNING id
+		), new_roles AS (
+			INSERT INTO user_roles (user_id, role_id)
+			SELECT new_user.id, roles.id
+			FROM new_user, roles
+			WHERE roles.name = ANY($3)
+		)
+		SELECT id FROM new_user;`
+	row := ur.db.QueryRowContext(ctx, queryStr, userPtr.Email, userPtr.PasswordHash, pq.Array(userPtr.Roles))
 	err := row.Scan(&userPtr.ID)
 	if err != nil {
-		return fmt.Errorf("creating user in repo: %w", err)
+		return dbError("creating user in repo", err)
 	}
 	return nil
 }
 
-func (ur UserRepo) GetByEmail(email string) (*model.User, error) {
+func (ur UserRepo) GetByEmail(ctx context.Context, email string) (*model.User, error) {
 	user := model.User{Email: email}
 	queryStr := `
-		SELECT  id, password_hash, is_verified, role FROM users
+		SELECT  id, password_hash, is_verified, failed_logins, locked_until, ` + rolesColumn + ` FROM users
 		WHERE email = $1;`
-	row := ur.db.QueryRow(queryStr, email)
-	err := row.Scan(&user.ID, &user.PasswordHash, &user.IsVerified, &user.Role)
+	row := ur.db.QueryRowContext(ctx, queryStr, email)
+	var lockedUntil sql.NullTime
+	err := row.Scan(&user.ID, &user.PasswordHash, &user.IsVerified, &user.FailedLogins, &lockedUntil, pq.Array(&user.Roles))
 	if err != nil {
-		return nil, fmt.Errorf("selecting user by email in repo: %w", err)
+		return nil, dbError("selecting user by email in repo", err)
 	}
+	user.LockedUntil = lockedUntil.Time
 	return &user, nil
 }
 
-func (ur UserRepo) GetByID(id int) (*model.User, error) {
+func (ur UserRepo) GetByID(ctx context.Context, id int) (*model.User, error) {
 	user := model.User{ID: id}
 	queryStr := `
-		SELECT  email, password_hash, is_verified, role 
+		SELECT  email, password_hash, is_verified, failed_logins, locked_until, ` + rolesColumn + `
 		FROM users
 		WHERE id = $1;`
-	row := ur.db.QueryRow(queryStr, id)
-	err := row.Scan(&user.Email, &user.PasswordHash, &user.IsVerified, &user.Role)
+	row := ur.db.QueryRowContext(ctx, queryStr, id)
+	var lockedUntil sql.NullTime
+	err := row.Scan(&user.Email, &user.PasswordHash, &user.IsVerified, &user.FailedLogins, &lockedUntil, pq.Array(&user.Roles))
 	if err != nil {
-		return nil, fmt.Errorf("selecting user by id in repo: %w", err)
+		return nil, dbError("selecting user by id in repo", err)
 	}
+	user.LockedUntil = lockedUntil.Time
 	return &user, nil
 }
 
-func (ur UserRepo) UpdatePassword(id int, newPasswordHash string) error {
+func (ur UserRepo) UpdatePassword(ctx context.Context, id int, newPasswordHash string) error {
 	queryStr := `
 	UPDATE users
 	SET password_hash = $1
 	WHERE id = $2;`
-	_, err := ur.db.Exec(queryStr, newPasswordHash, id)
+	_, err := ur.db.ExecContext(ctx, queryStr, newPasswordHash, id)
 	if err != nil {
-		return fmt.Errorf("updating user password in repo: %w", err)
+		return dbError("updating user password in repo", err)
 	}
 	return nil
 }
 
-func (ur UserRepo) UpdateEmailVerification(id int) error {
+func (ur UserRepo) UpdateEmailVerification(ctx context.Context, id int) error {
 	queryStr := `
 	UPDATE users
 	SET is_verified = TRUE
 	WHERE id = $1;`
-	_, err := ur.db.Exec(queryStr, id)
+	_, err := ur.db.ExecContext(ctx, queryStr, id)
 	if err != nil {
-		return fmt.Errorf("updating user password in repo: %w", err)
+		return dbError("updating user password in repo", err)
+	}
+	return nil
+}
+
+func (ur UserRepo) RecordLoginFailure(ctx context.Context, id int) (int, error) {
+	queryStr := `
+	UPDATE users
+	SET failed_logins = failed_logins + 1
+	WHERE id = $1
+	RETURNING failed_logins;`
+	var failures int
+	err := ur.db.QueryRowContext(ctx, queryStr, id).Scan(&failures)
+	if err != nil {
+		return 0, dbError("recording login failure in repo", err)
+	}
+	return failures, nil
+}
+
+func (ur UserRepo) LockUntil(ctx context.Context, id int, until time.Time) error {
+	queryStr := `
+	UPDATE users
+	SET locked_until = $1
+	WHERE id = $2;`
+	_, err := ur.db.ExecContext(ctx, queryStr, until, id)
+	if err != nil {
+		return dbError("locking user in repo", err)
+	}
+	return nil
+}
+
+func (ur UserRepo) ResetLoginFailures(ctx context.Context, id int) error {
+	queryStr := `
+	UPDATE users
+	SET failed_logins = 0, locked_until = NULL
+	WHERE id = $1;`
+	_, err := ur.db.ExecContext(ctx, queryStr, id)
+	if err != nil {
+		return dbError("resetting login failures in repo", err)
+	}
+	return nil
+}
+
+// Delete removes the user, the ON DELETE clauses of the schema remove or
+// detach everything that references it
+func (ur UserRepo) Delete(ctx context.Context, id int) error {
+	queryStr := `
+	DELETE FROM users
+	WHERE id = $1;`
+	res, err := ur.db.ExecContext(ctx, queryStr, id)
+	if err != nil {
+		return dbError("deleting user in repo", err)
+	}
+	deletedRow, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking deleted row: %w", err)
+	}
+	if deletedRow == 0 {
+		return fmt.Errorf("zero deleted row: %w", apperr.ErrNotFound)
 	}
 	return nil
 }
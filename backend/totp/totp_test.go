@@ -0,0 +1,52 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of the RFC 6238 test vectors
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// the RFC lists 8 digit codes, these are their last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %s", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	previous, _ := Code(rfcSecret, Step(now)-1)
+
+	step, ok, err := Verify(rfcSecret, previous, now, 0)
+	if err != nil || !ok || step != Step(now)-1 {
+		t.Fatalf("Verify previous step = %d, %t, %v, want %d, true", step, ok, err, Step(now)-1)
+	}
+	_, ok, _ = Verify(rfcSecret, previous, now, step)
+	if ok {
+		t.Error("Verify accepted a code of an already used step")
+	}
+	_, ok, _ = Verify(rfcSecret, previous, now.Add(3*Period), 0)
+	if ok {
+		t.Error("Verify accepted a code outside the skew")
+	}
+}
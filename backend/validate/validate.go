@@ -0,0 +1,207 @@
+// Package validate checks request structs against their `validate` struct tags
+// and reports every invalid field at once.
+//
+//	Email string `json:"email" validate:"required,email,max=254"`
+//
+// Rules are separated by commas, fields are named by their json tag and
+// nested structs, pointers and slices are checked too:
+//
+//	required       not the zero value, such as an empty string or a nil pointer
+//	min=N, max=N   the length of a string (in characters) or slice, or a number's value
+//	maxbytes=N     the length of a string in bytes, as bcrypt counts it
+//	email          a well formed email address
+//	oneof=a b c    one of the words listed
+//
+// Any other rule is only checked on a value that is not zero.
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+	"github.com/suryasaputra2016/course/backend/utils"
+)
+
+// Rule checks v against param and returns why it is invalid, or "" when it is valid
+type Rule func(v reflect.Value, param string) string
+
+var rules = map[string]Rule{
+	"min":      checkMin,
+	"max":      checkMax,
+	"maxbytes": checkMaxBytes,
+	"email":    checkEmail,
+	"oneof":    checkOneOf,
+}
+
+// Register adds or replaces the rule called name, it must be called before any
+// request is validated
+func Register(name string, rule Rule) {
+	rules[name] = rule
+}
+
+// Struct checks every tagged field of v, a struct or pointer to one, and
+// returns an apperr validation error listing the invalid fields, or nil
+func Struct(v any) error {
+	var invalid apperr.FieldErrors
+	err := check(reflect.ValueOf(v), "", &invalid)
+	if err != nil {
+		return err
+	}
+	return invalid.Err()
+}
+
+func check(v reflect.Value, path string, invalid *apperr.FieldErrors) error {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return check(v.Elem(), path, invalid)
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			err := check(v.Index(i), fmt.Sprintf("%s[%d]", path, i), invalid)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Struct:
+	default:
+		return nil
+	}
+
+	t := v.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fieldPath := joinPath(path, fieldName(field))
+		fieldValue := v.Field(i)
+
+		tag := field.Tag.Get("validate")
+		if tag != "" {
+			message, err := checkField(fieldValue, tag)
+			if err != nil {
+				return fmt.Errorf("validating %s: %w", fieldPath, err)
+			}
+			if message != "" {
+				invalid.Add(fieldPath, message)
+				continue
+			}
+		}
+		err := check(fieldValue, fieldPath, invalid)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkField runs the rules of tag in order and returns the first failure
+func checkField(v reflect.Value, tag string) (string, error) {
+	for _, spec := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(spec, "=")
+		if name == "required" {
+			if v.IsZero() {
+				return "must not be empty", nil
+			}
+			continue
+		}
+		if v.IsZero() {
+			return "", nil
+		}
+		rule, ok := rules[name]
+		if !ok {
+			return "", fmt.Errorf("unknown validation rule %q", name)
+		}
+		if message := rule(v, param); message != "" {
+			return message, nil
+		}
+	}
+	return "", nil
+}
+
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// size is the length of a string or slice and the value of a number
+func size(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func checkMin(v reflect.Value, param string) string {
+	return compare(v, param, func(got, limit float64) bool { return got >= limit }, "at least")
+}
+
+func checkMax(v reflect.Value, param string) string {
+	return compare(v, param, func(got, limit float64) bool { return got <= limit }, "at most")
+}
+
+func checkMaxBytes(v reflect.Value, param string) string {
+	limit, err := strconv.Atoi(param)
+	if err != nil || v.Kind() != reflect.String || len(v.String()) <= limit {
+		return ""
+	}
+	return fmt.Sprintf("must be at most %s bytes long", param)
+}
+
+func compare(v reflect.Value, param string, ok func(got, limit float64) bool, bound string) string {
+	limit, err := strconv.ParseFloat(param, 64)
+	got, hasSize := size(v)
+	if err != nil || !hasSize || ok(got, limit) {
+		return ""
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return fmt.Sprintf("must be %s %s characters long", bound, param)
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return fmt.Sprintf("must have %s %s items", bound, param)
+	}
+	return fmt.Sprintf("must be %s %s", bound, param)
+}
+
+func checkEmail(v reflect.Value, _ string) string {
+	if v.Kind() != reflect.String || utils.CheckEmailFormat(v.String()) != nil {
+		return "must be a valid email address"
+	}
+	return ""
+}
+
+func checkOneOf(v reflect.Value, param string) string {
+	words := strings.Fields(param)
+	for _, word := range words {
+		if fmt.Sprint(v.Interface()) == word {
+			return ""
+		}
+	}
+	return "must be one of " + strings.Join(words, ", ")
+}
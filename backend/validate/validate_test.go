@@ -0,0 +1,136 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/suryasaputra2016/course/backend/apperr"
+)
+
+type address struct {
+	City string `json:"city" validate:"required,max=5"`
+}
+
+type signup struct {
+	Email    string    `json:"email" validate:"required,email,max=30"`
+	Name     string    `json:"name,omitempty" validate:"min=2,max=4"`
+	Age      int       `json:"age" validate:"min=18,max=99"`
+	Score    float64   `json:"score" validate:"max=1.5"`
+	Role     string    `json:"role" validate:"oneof=student author"`
+	Level    int       `json:"level" validate:"oneof=1 2 3"`
+	Tags     []string  `json:"tags" validate:"max=2"`
+	Home     address   `json:"home"`
+	Work     *address  `json:"work"`
+	Previous []address `json:"previous"`
+	Note     *string   `json:"note" validate:"required"`
+	Secret   string    `json:"secret" validate:"maxbytes=4"`
+	Internal string    `json:"-" validate:"max=1"`
+	secret   string    `validate:"required"`
+}
+
+func valid() signup {
+	note := "hi"
+	return signup{Email: "ada@example.com", Home: address{City: "Paris"}, Note: &note}
+}
+
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(s *signup)
+		fields []string
+	}{
+		{"valid", func(s *signup) {}, nil},
+		{"required string", func(s *signup) { s.Email = "" }, []string{"email"}},
+		{"required pointer", func(s *signup) { s.Note = nil }, []string{"note"}},
+		{"email", func(s *signup) { s.Email = "ada.example.com" }, []string{"email"}},
+		{"first failing rule only", func(s *signup) { s.Email = "not an email but far too long for max" }, []string{"email"}},
+		{"min string", func(s *signup) { s.Name = "A" }, []string{"name"}},
+		{"max counts characters", func(s *signup) { s.Name = "Ádám" }, nil},
+		{"max string", func(s *signup) { s.Name = "Grace" }, []string{"name"}},
+		{"maxbytes", func(s *signup) { s.Secret = "abcd" }, nil},
+		{"maxbytes counts bytes", func(s *signup) { s.Secret = "ééé" }, []string{"secret"}},
+		{"min number", func(s *signup) { s.Age = 17 }, []string{"age"}},
+		{"max number", func(s *signup) { s.Age = 100 }, []string{"age"}},
+		{"max float", func(s *signup) { s.Score = 1.6 }, []string{"score"}},
+		{"zero skips rules", func(s *signup) { s.Age = 0; s.Name = "" }, nil},
+		{"oneof", func(s *signup) { s.Role = "admin" }, []string{"role"}},
+		{"oneof number", func(s *signup) { s.Level = 4 }, []string{"level"}},
+		{"max slice", func(s *signup) { s.Tags = []string{"a", "b", "c"} }, []string{"tags"}},
+		{"nested", func(s *signup) { s.Home.City = "" }, []string{"home.city"}},
+		{"nested pointer", func(s *signup) { s.Work = &address{City: "Amsterdam"} }, []string{"work.city"}},
+		{"nil pointer", func(s *signup) { s.Work = nil }, nil},
+		{"slice of structs", func(s *signup) { s.Previous = []address{{City: "Rome"}, {}} }, []string{"previous[1].city"}},
+		{"go name without json name", func(s *signup) { s.Internal = "too long" }, []string{"Internal"}},
+		{"every field", func(s *signup) { s.Email = ""; s.Age = 1; s.Home.City = "" }, []string{"email", "age", "home.city"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid()
+			tt.change(&s)
+			err := Struct(&s)
+			if tt.fields == nil {
+				if err != nil {
+					t.Fatalf("Struct = %v, want nil", err)
+				}
+				return
+			}
+			var appErr *apperr.Error
+			if !errors.As(err, &appErr) || !errors.Is(err, apperr.ErrValidation) {
+				t.Fatalf("Struct = %v, want a validation error", err)
+			}
+			var fields []string
+			for _, field := range appErr.Fields {
+				fields = append(fields, field.Field)
+				if field.Message == "" {
+					t.Errorf("field %s has no message", field.Field)
+				}
+			}
+			if !slices.Equal(fields, tt.fields) {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestStructByValue(t *testing.T) {
+	s := valid()
+	s.Age = 5
+	if err := Struct(s); !errors.Is(err, apperr.ErrValidation) {
+		t.Errorf("Struct of a value = %v, want a validation error", err)
+	}
+}
+
+func TestUnknownRule(t *testing.T) {
+	var s struct {
+		Name string `json:"name" validate:"required,shiny"`
+	}
+	s.Name = "Ada"
+	err := Struct(&s)
+	if err == nil || errors.Is(err, apperr.ErrValidation) {
+		t.Errorf("Struct with an unknown rule = %v, want a programming error", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("even", func(v reflect.Value, _ string) string {
+		if v.Int()%2 != 0 {
+			return "must be even"
+		}
+		return ""
+	})
+	defer delete(rules, "even")
+
+	var s struct {
+		Count int `json:"count" validate:"even"`
+	}
+	s.Count = 3
+	if err := Struct(&s); !errors.Is(err, apperr.ErrValidation) {
+		t.Errorf("Struct with a failing registered rule = %v, want a validation error", err)
+	}
+	s.Count = 4
+	if err := Struct(&s); err != nil {
+		t.Errorf("Struct with a passing registered rule = %v, want nil", err)
+	}
+}
@@ -0,0 +1,191 @@
+package variant
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"regexp"
+	"strconv"
+
+	"github.com/suryasaputra2016/course/backend/expression"
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+// maxVariables bounds how many variables one question template may have
+const maxVariables = 20
+
+// maxSteps bounds how many values a variable with a step may take, far more
+// than any question needs and far less than an int holds
+const maxSteps = 1_000_000
+
+var (
+	placeholderRegex = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+	nameRegex        = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Variant is one user's instance of a question template
+type Variant struct {
+	Values     expression.Env   `json:"values"`
+	Statement  string           `json:"statement"`
+	AnswerSpec model.AnswerSpec `json:"-"`
+}
+
+// Seed derives a deterministic seed for a user and question,
+// so a user sees the same numbers every time they open the question
+func Seed(userID, questionID int) uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d:%d", userID, questionID)
+	return h.Sum64()
+}
+
+// Generate draws the variable values of question for userID, fills them into
+// the statement and computes the expected answer
+func Generate(question model.Question, userID int) (*Variant, error) {
+	v := Variant{
+		Values:    expression.Env{},
+		Statement: question.Statement,
+	}
+	if question.AnswerSpec != nil {
+		v.AnswerSpec = *question.AnswerSpec
+	}
+	if len(question.Variables) == 0 && v.AnswerSpec.Formula == "" {
+		return &v, nil
+	}
+
+	rng := rand.New(rand.NewPCG(Seed(userID, question.ID), uint64(question.ID)))
+	for _, variable := range question.Variables {
+		value, err := draw(rng, variable)
+		if err != nil {
+			return nil, fmt.Errorf("drawing variable %s: %w", variable.Name, err)
+		}
+		v.Values[variable.Name] = value
+	}
+
+	v.Statement = placeholderRegex.ReplaceAllStringFunc(question.Statement, func(match string) string {
+		name := placeholderRegex.FindStringSubmatch(match)[1]
+		value, ok := v.Values[name]
+		if !ok {
+			return match
+		}
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	})
+
+	if v.AnswerSpec.Formula != "" {
+		value, err := expression.Evaluate(v.AnswerSpec.Formula, v.Values)
+		if err != nil {
+			return nil, fmt.Errorf("evaluating answer formula: %w", err)
+		}
+		v.AnswerSpec.Value = value
+	}
+	return &v, nil
+}
+
+// draw checks the range again, a template stored before Validate caught
+// something must not crash whoever opens it
+func draw(rng *rand.Rand, variable model.Variable) (float64, error) {
+	if !finite(variable.Min, variable.Max, variable.Step) || variable.Min > variable.Max {
+		return 0, fmt.Errorf("invalid range %g..%g with step %g", variable.Min, variable.Max, variable.Step)
+	}
+	if variable.Step > 0 {
+		steps, err := stepCount(variable)
+		if err != nil {
+			return 0, err
+		}
+		value := variable.Min + variable.Step*float64(rng.IntN(steps+1))
+		return roundTo(value, decimalsOf(variable.Step)), nil
+	}
+	value := variable.Min + rng.Float64()*(variable.Max-variable.Min)
+	return roundTo(value, variable.Decimals), nil
+}
+
+// stepCount returns how many steps fit between the min and max of variable
+func stepCount(variable model.Variable) (int, error) {
+	steps := math.Floor((variable.Max-variable.Min)/variable.Step + 1e-9)
+	if math.IsNaN(steps) || steps < 0 || steps > maxSteps {
+		return 0, fmt.Errorf("step %g gives more than %d values between %g and %g", variable.Step, maxSteps, variable.Min, variable.Max)
+	}
+	return int(steps), nil
+}
+
+func finite(values ...float64) bool {
+	for _, value := range values {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func roundTo(value float64, decimals int) float64 {
+	pow := math.Pow(10, float64(decimals))
+	return math.Round(value*pow) / pow
+}
+
+// decimalsOf returns how many decimals a step like 0.25 needs
+func decimalsOf(step float64) int {
+	s := strconv.FormatFloat(step, 'f', -1, 64)
+	for i, c := range s {
+		if c == '.' {
+			return len(s) - i - 1
+		}
+	}
+	return 0
+}
+
+// Validate checks that a template is well formed: variable names are unique
+// identifiers with sane ranges, and the statement and formula only use them
+func Validate(statement string, variables []model.Variable, spec model.AnswerSpec) error {
+	if len(variables) > maxVariables {
+		return fmt.Errorf("more than %d variables", maxVariables)
+	}
+
+	defined := map[string]bool{}
+	for _, variable := range variables {
+		if !nameRegex.MatchString(variable.Name) {
+			return fmt.Errorf("variable name %q is not an identifier", variable.Name)
+		}
+		if defined[variable.Name] {
+			return fmt.Errorf("variable %s defined twice", variable.Name)
+		}
+		defined[variable.Name] = true
+		if !finite(variable.Min, variable.Max, variable.Step) {
+			return fmt.Errorf("variable %s has a min, max or step that isn't a finite number", variable.Name)
+		}
+		if variable.Min > variable.Max {
+			return fmt.Errorf("variable %s has min above max", variable.Name)
+		}
+		if variable.Step < 0 || variable.Decimals < 0 || variable.Decimals > 10 {
+			return fmt.Errorf("variable %s has invalid step or decimals", variable.Name)
+		}
+		if variable.Step > 0 {
+			if _, err := stepCount(variable); err != nil {
+				return fmt.Errorf("variable %s: %w", variable.Name, err)
+			}
+		}
+	}
+
+	for _, match := range placeholderRegex.FindAllStringSubmatch(statement, -1) {
+		if !defined[match[1]] {
+			return fmt.Errorf("statement uses undefined variable %s", match[1])
+		}
+	}
+
+	if spec.Formula == "" {
+		if len(variables) > 0 {
+			return errors.New("template questions need an answer formula")
+		}
+		return nil
+	}
+	node, err := expression.Parse(spec.Formula)
+	if err != nil {
+		return fmt.Errorf("answer formula: %w", err)
+	}
+	for _, name := range expression.Variables(node) {
+		if !defined[name] && !expression.IsConstant(name) {
+			return fmt.Errorf("answer formula uses undefined variable %s", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package variant
+
+import (
+	"math"
+	"testing"
+
+	"github.com/suryasaputra2016/course/backend/model"
+)
+
+func TestGenerate(t *testing.T) {
+	question := model.Question{
+		ID:        7,
+		Statement: "A stone falls for {{t}} s from {{ y }} m.",
+		Variables: []model.Variable{
+			{Name: "t", Min: 1, Max: 3, Step: 0.5},
+			{Name: "y", Min: 10, Max: 20, Decimals: 1},
+		},
+		AnswerSpec: &model.AnswerSpec{Formula: "g*t^2/2", Unit: "m"},
+	}
+
+	v, err := Generate(question, 1)
+	if err != nil {
+		t.Fatalf("Generate = %v", err)
+	}
+	tValue, yValue := v.Values["t"], v.Values["y"]
+	if tValue < 1 || tValue > 3 || math.Mod(tValue, 0.5) != 0 {
+		t.Errorf("t = %g, want a multiple of 0.5 in [1, 3]", tValue)
+	}
+	if yValue < 10 || yValue > 20 || math.Abs(yValue*10-math.Round(yValue*10)) > 1e-9 {
+		t.Errorf("y = %g, want one decimal in [10, 20]", yValue)
+	}
+	if want := 9.80665 * tValue * tValue / 2; math.Abs(v.AnswerSpec.Value-want) > 1e-9 {
+		t.Errorf("answer = %g, want %g", v.AnswerSpec.Value, want)
+	}
+	if question.AnswerSpec.Value != 0 {
+		t.Error("Generate changed the answer spec of the question")
+	}
+
+	again, err := Generate(question, 1)
+	if err != nil {
+		t.Fatalf("Generate again = %v", err)
+	}
+	if again.Statement != v.Statement || again.AnswerSpec.Value != v.AnswerSpec.Value {
+		t.Errorf("the same user got %q then %q", v.Statement, again.Statement)
+	}
+}
+
+func TestGenerateWithoutVariables(t *testing.T) {
+	question := model.Question{ID: 1, Statement: "How far is {{x}}?", AnswerSpec: &model.AnswerSpec{Value: 3, Unit: "m"}}
+	v, err := Generate(question, 1)
+	if err != nil {
+		t.Fatalf("Generate = %v", err)
+	}
+	if v.Statement != question.Statement || v.AnswerSpec.Value != 3 {
+		t.Errorf("variant = %+v, want the question unchanged", v)
+	}
+}
+
+func TestGenerateRejectsHugeStepCounts(t *testing.T) {
+	// stored before Validate caught it, drawing used to panic in rand.IntN
+	question := model.Question{
+		ID:         3,
+		Statement:  "Take {{t}}",
+		Variables:  []model.Variable{{Name: "t", Max: 1e12, Step: 1e-9}},
+		AnswerSpec: &model.AnswerSpec{Formula: "t"},
+	}
+	if _, err := Generate(question, 1); err == nil {
+		t.Error("Generate with 1e21 steps = nil error, want one")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	spec := model.AnswerSpec{Formula: "g*t^2/2"}
+	valid := []model.Variable{{Name: "t", Min: 1, Max: 3}}
+	tests := []struct {
+		name      string
+		statement string
+		variables []model.Variable
+		spec      model.AnswerSpec
+		ok        bool
+	}{
+		{"valid", "Fall for {{t}} s", valid, spec, true},
+		{"plain question", "Fall for 2 s", nil, model.AnswerSpec{Value: 19.6}, true},
+		{"bad name", "", []model.Variable{{Name: "2t", Min: 1, Max: 3}}, model.AnswerSpec{Formula: "g"}, false},
+		{"defined twice", "", []model.Variable{{Name: "t"}, {Name: "t"}}, spec, false},
+		{"min above max", "", []model.Variable{{Name: "t", Min: 3, Max: 1}}, spec, false},
+		{"negative step", "", []model.Variable{{Name: "t", Max: 1, Step: -1}}, spec, false},
+		{"too many steps", "", []model.Variable{{Name: "t", Max: 1e12, Step: 1e-9}}, spec, false},
+		{"most steps allowed", "", []model.Variable{{Name: "t", Max: 1, Step: 1e-6}}, spec, true},
+		{"infinite max", "", []model.Variable{{Name: "t", Max: math.Inf(1)}}, spec, false},
+		{"not a number step", "", []model.Variable{{Name: "t", Max: 1, Step: math.NaN()}}, spec, false},
+		{"undefined placeholder", "Fall for {{s}} s", valid, spec, false},
+		{"no formula", "Fall for {{t}} s", valid, model.AnswerSpec{Value: 19.6}, false},
+		{"formula with undefined variable", "", valid, model.AnswerSpec{Formula: "g*t*z"}, false},
+		{"malformed formula", "", valid, model.AnswerSpec{Formula: "g*(t"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.statement, tt.variables, tt.spec)
+			if (err == nil) != tt.ok {
+				t.Errorf("Validate = %v, want ok %t", err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package webauthn
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// maxCBORDepth bounds nesting, authenticator data never goes deeper than a few levels
+const maxCBORDepth = 16
+
+var errCBORTruncated = errors.New("cbor: unexpected end of data")
+
+// decodeCBOR decodes the first CBOR item of data, the subset CTAP2 uses:
+// integers, byte and text strings, arrays, maps, booleans and null, all with
+// definite lengths. Integers decode to int64, maps to map[any]any with int64
+// or string keys. It returns the item and how many bytes it took.
+func decodeCBOR(data []byte) (any, int, error) {
+	d := cborDecoder{data: data}
+	v, err := d.item(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return v, d.pos, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) item(depth int) (any, error) {
+	if depth > maxCBORDepth {
+		return nil, errors.New("cbor: nested too deep")
+	}
+	major, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, errors.New("cbor: integer overflows int64")
+		}
+		return int64(arg), nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, errors.New("cbor: integer overflows int64")
+		}
+		return -1 - int64(arg), nil
+	case 2, 3:
+		b, err := d.take(arg)
+		if err != nil {
+			return nil, err
+		}
+		if major == 3 {
+			return string(b), nil
+		}
+		return append([]byte(nil), b...), nil
+	case 4:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, errCBORTruncated
+		}
+		items := make([]any, arg)
+		for i := range items {
+			items[i], err = d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case 5:
+		if arg > uint64(len(d.data)-d.pos)/2 {
+			return nil, errCBORTruncated
+		}
+		m := make(map[any]any, arg)
+		for range arg {
+			key, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("cbor: unsupported map key type %T", key)
+			}
+			if _, ok := m[key]; ok {
+				return nil, fmt.Errorf("cbor: duplicate map key %v", key)
+			}
+			m[key], err = d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case 7:
+		switch arg {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22:
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("cbor: unsupported item, major type %d", major)
+}
+
+// head reads the initial byte of an item and its argument
+func (d *cborDecoder) head() (byte, uint64, error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, errCBORTruncated
+	}
+	initial := d.data[d.pos]
+	d.pos++
+	major, info := initial>>5, initial&0x1F
+
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info <= 27:
+		b, err := d.take(1 << (info - 24))
+		if err != nil {
+			return 0, 0, err
+		}
+		var arg uint64
+		for _, c := range b {
+			arg = arg<<8 | uint64(c)
+		}
+		return major, arg, nil
+	}
+	// 28 to 30 are reserved and 31 is an indefinite length, which CTAP2
+	// canonical CBOR doesn't allow
+	return 0, 0, fmt.Errorf("cbor: unsupported additional information %d", info)
+}
+
+func (d *cborDecoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errCBORTruncated
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// cborMap returns v as a map or an error naming what was expected
+func cborMap(v any, what string) (map[any]any, error) {
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a CBOR map", what)
+	}
+	return m, nil
+}
+
+func cborBytes(m map[any]any, key any) ([]byte, bool) {
+	b, ok := m[key].([]byte)
+	return b, ok
+}
+
+func cborInt(m map[any]any, key any) (int64, bool) {
+	n, ok := m[key].(int64)
+	return n, ok
+}
@@ -0,0 +1,49 @@
+package webauthn
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	// examples from RFC 8949 appendix A
+	tests := []struct {
+		hex  string
+		want any
+	}{
+		{"00", int64(0)},
+		{"1864", int64(100)},
+		{"1a000f4240", int64(1000000)},
+		{"3903e7", int64(-1000)},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"6449455446", "IETF"},
+		{"f5", true},
+		{"f6", nil},
+		{"83010203", []any{int64(1), int64(2), int64(3)}},
+		{"a201020304", map[any]any{int64(1): int64(2), int64(3): int64(4)}},
+		{"a26161016162820203", map[any]any{"a": int64(1), "b": []any{int64(2), int64(3)}}},
+	}
+	for _, tt := range tests {
+		data := mustHex(t, tt.hex)
+		got, n, err := decodeCBOR(data)
+		if err != nil || n != len(data) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decodeCBOR(%s) = %#v, %d, %v, want %#v", tt.hex, got, n, err, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "18", "62ff", "9f01ff", "a20102", "a2010201ff", "1bffffffffffffffff"} {
+		if _, _, err := decodeCBOR(mustHex(t, bad)); err == nil {
+			t.Errorf("decodeCBOR(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("decoding hex %q: %s", s, err)
+	}
+	return b
+}
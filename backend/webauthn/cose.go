@@ -0,0 +1,115 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers of the keys a relying party accepts
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// COSE key parameters, RFC 9053
+const (
+	coseKty    = 1
+	coseAlg    = 3
+	coseCrv    = -1
+	coseX      = -2
+	coseY      = -3
+	coseRSAN   = -1
+	coseRSAE   = -2
+	ktyOKP     = 1
+	ktyEC2     = 2
+	ktyRSA     = 3
+	crvP256    = 1
+	crvEd25519 = 6
+	// minRSABits is the smallest RSA modulus accepted
+	minRSABits = 2048
+)
+
+// publicKey is a credential public key with the algorithm it signs with
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE_Key as found in authenticator data
+func parsePublicKey(coseKey []byte) (*publicKey, error) {
+	v, n, err := decodeCBOR(coseKey)
+	if err != nil {
+		return nil, fmt.Errorf("decoding public key: %w", err)
+	}
+	if n != len(coseKey) {
+		return nil, errors.New("decoding public key: trailing data")
+	}
+	m, err := cborMap(v, "public key")
+	if err != nil {
+		return nil, err
+	}
+	kty, _ := cborInt(m, int64(coseKty))
+	alg, _ := cborInt(m, int64(coseAlg))
+
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		crv, _ := cborInt(m, int64(coseCrv))
+		x, okX := cborBytes(m, int64(coseX))
+		y, okY := cborBytes(m, int64(coseY))
+		if crv != crvP256 || !okX || !okY || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("public key is not a P-256 point")
+		}
+		// ecdh checks the point is on the curve
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("public key: %w", err)
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		return &publicKey{alg: alg, key: key}, nil
+
+	case kty == ktyOKP && alg == AlgEdDSA:
+		crv, _ := cborInt(m, int64(coseCrv))
+		x, ok := cborBytes(m, int64(coseX))
+		if crv != crvEd25519 || !ok || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("public key is not an Ed25519 key")
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+
+	case kty == ktyRSA && alg == AlgRS256:
+		n, okN := cborBytes(m, int64(coseRSAN))
+		e, okE := cborBytes(m, int64(coseRSAE))
+		if !okN || !okE || len(e) > 4 {
+			return nil, errors.New("public key is not an RSA key")
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < minRSABits || key.E < 3 || key.E%2 == 0 {
+			return nil, errors.New("public key is a weak RSA key")
+		}
+		return &publicKey{alg: alg, key: key}, nil
+	}
+	return nil, fmt.Errorf("public key type %d with algorithm %d is not supported", kty, alg)
+}
+
+// verify checks sig over data
+func (pk *publicKey) verify(data, sig []byte) bool {
+	switch key := pk.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, sig)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+// Package softauthn is a software authenticator for tests. It answers
+// webauthn options like a platform authenticator would, with discoverable
+// ES256 credentials, user verification and a sign count.
+package softauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/suryasaputra2016/course/backend/webauthn"
+)
+
+// Authenticator holds credentials in memory. Its fields can be changed
+// between ceremonies to make it misbehave.
+type Authenticator struct {
+	// Origin is the web origin the client reports
+	Origin string
+	// Flags are the authenticator data flags of every response, user present
+	// and verified unless changed
+	Flags       byte
+	credentials []*credential
+}
+
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+const (
+	FlagUserPresent  = 0x01
+	FlagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+func New(origin string) *Authenticator {
+	return &Authenticator{Origin: origin, Flags: FlagUserPresent | FlagUserVerified}
+}
+
+// Create makes a credential for options and returns the registration
+// response a browser would send, with "none" attestation
+func (a *Authenticator) Create(options webauthn.CreationOptions) (webauthn.RegistrationResponse, error) {
+	var response webauthn.RegistrationResponse
+	for _, excluded := range options.ExcludeCredentials {
+		for _, c := range a.credentials {
+			if webauthn.Encoding.EncodeToString(c.id) == excluded.ID {
+				return response, errors.New("softauthn: a credential of this authenticator is excluded")
+			}
+		}
+	}
+	userHandle, err := webauthn.Encoding.DecodeString(options.User.ID)
+	if err != nil {
+		return response, fmt.Errorf("softauthn: decoding user id: %w", err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return response, fmt.Errorf("softauthn: generating key: %w", err)
+	}
+	c := &credential{id: make([]byte, 16), rpID: options.RP.ID, userHandle: userHandle, key: key}
+	_, err = rand.Read(c.id)
+	if err != nil {
+		return response, fmt.Errorf("softauthn: generating credential id: %w", err)
+	}
+	// a new credential replaces the one of the same user, as discoverable
+	// credentials do
+	a.credentials = slices.DeleteFunc(a.credentials, func(old *credential) bool {
+		return old.rpID == c.rpID && string(old.userHandle) == string(userHandle)
+	})
+	a.credentials = append(a.credentials, c)
+
+	var ecPoint [65]byte
+	key.PublicKey.X.FillBytes(ecPoint[1:33])
+	key.PublicKey.Y.FillBytes(ecPoint[33:])
+	coseKey := encode(map[any]any{
+		int64(1):  int64(2),
+		int64(3):  int64(webauthn.AlgES256),
+		int64(-1): int64(1),
+		int64(-2): ecPoint[1:33],
+		int64(-3): ecPoint[33:],
+	})
+
+	attested := slices.Concat(make([]byte, 16), binary.BigEndian.AppendUint16(nil, uint16(len(c.id))), c.id, coseKey)
+	authData := a.authData(c, a.Flags|flagAttestedData, attested)
+	attestation := encode(map[any]any{
+		"fmt":      "none",
+		"attStmt":  map[any]any{},
+		"authData": authData,
+	})
+
+	response.ID = webauthn.Encoding.EncodeToString(c.id)
+	response.RawID = response.ID
+	response.Type = "public-key"
+	response.Response.ClientDataJSON = a.clientData("webauthn.create", options.Challenge)
+	response.Response.AttestationObject = webauthn.Encoding.EncodeToString(attestation)
+	response.Response.Transports = []string{"internal"}
+	return response, nil
+}
+
+// Get signs the challenge of options with a credential it allows, or with
+// any credential of the relying party when it allows all, and returns the
+// assertion response a browser would send
+func (a *Authenticator) Get(options webauthn.RequestOptions) (webauthn.AssertionResponse, error) {
+	var response webauthn.AssertionResponse
+	c := a.find(options)
+	if c == nil {
+		return response, errors.New("softauthn: no credential for the options")
+	}
+
+	c.signCount++
+	authData := a.authData(c, a.Flags, nil)
+	clientDataJSON := a.clientData("webauthn.get", options.Challenge)
+	rawClientData, _ := webauthn.Encoding.DecodeString(clientDataJSON)
+	clientDataHash := sha256.Sum256(rawClientData)
+	digest := sha256.Sum256(slices.Concat(authData, clientDataHash[:]))
+	sig, err := ecdsa.SignASN1(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return response, fmt.Errorf("softauthn: signing: %w", err)
+	}
+
+	response.ID = webauthn.Encoding.EncodeToString(c.id)
+	response.RawID = response.ID
+	response.Type = "public-key"
+	response.Response.ClientDataJSON = clientDataJSON
+	response.Response.AuthenticatorData = webauthn.Encoding.EncodeToString(authData)
+	response.Response.Signature = webauthn.Encoding.EncodeToString(sig)
+	response.Response.UserHandle = webauthn.Encoding.EncodeToString(c.userHandle)
+	return response, nil
+}
+
+// SetSignCount changes the counter of every credential, to act like a clone
+func (a *Authenticator) SetSignCount(count uint32) {
+	for _, c := range a.credentials {
+		c.signCount = count
+	}
+}
+
+func (a *Authenticator) find(options webauthn.RequestOptions) *credential {
+	for _, c := range slices.Backward(a.credentials) {
+		if c.rpID != options.RPID {
+			continue
+		}
+		if len(options.AllowCredentials) == 0 {
+			return c
+		}
+		for _, allowed := range options.AllowCredentials {
+			if allowed.ID == webauthn.Encoding.EncodeToString(c.id) {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Authenticator) authData(c *credential, flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(c.rpID))
+	return slices.Concat(rpIDHash[:], []byte{flags}, binary.BigEndian.AppendUint32(nil, c.signCount), attested)
+}
+
+func (a *Authenticator) clientData(ceremony, challenge string) string {
+	raw, _ := json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return webauthn.Encoding.EncodeToString(raw)
+}
+
+// encode writes v as CTAP2 canonical CBOR, for the types webauthn uses
+func encode(v any) []byte {
+	switch v := v.(type) {
+	case int64:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case map[any]any:
+		// canonical order sorts the encoded keys, shorter first
+		keys := [][]byte{}
+		values := map[string][]byte{}
+		for k, item := range v {
+			encodedKey := encode(k)
+			keys = append(keys, encodedKey)
+			values[string(encodedKey)] = encode(item)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) < len(keys[j])
+			}
+			return string(keys[i]) < string(keys[j])
+		})
+		out := head(5, uint64(len(v)))
+		for _, k := range keys {
+			out = append(append(out, k...), values[string(k)]...)
+		}
+		return out
+	}
+	panic(fmt.Sprintf("softauthn: can't encode %T", v))
+}
+
+func head(major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return []byte{major<<5 | byte(arg)}
+	case arg <= 0xFF:
+		return []byte{major<<5 | 24, byte(arg)}
+	case arg <= 0xFFFF:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(arg))
+	case arg <= 0xFFFFFFFF:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(arg))
+	}
+	return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, arg)
+}
@@ -0,0 +1,526 @@
+// Package webauthn runs the relying party side of WebAuthn registration and
+// authentication ceremonies, the protocol behind passkeys. It takes the JSON
+// encoding of PublicKeyCredential that browsers produce with toJSON, binary
+// fields are base64url.
+//
+// Attestation is not used to decide which authenticators to trust: options
+// ask for none and only the "none" and self "packed" formats are accepted.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// Timeout is how long the browser waits for the user, in the options
+	Timeout = 5 * time.Minute
+	// challengeBytes is the length of a ceremony challenge
+	challengeBytes = 32
+	// maxCredentialIDBytes is the largest credential id the spec allows
+	maxCredentialIDBytes = 1023
+)
+
+// authenticator data flags
+const (
+	flagUserPresent    = 0x01
+	flagUserVerified   = 0x04
+	flagBackupEligible = 0x08
+	flagBackedUp       = 0x10
+	flagAttestedData   = 0x40
+	flagExtensionData  = 0x80
+)
+
+// ErrVerification is wrapped by every error about a response that doesn't
+// check out, as opposed to one about the relying party itself
+var ErrVerification = errors.New("webauthn verification failed")
+
+// Encoding is how binary values are sent to and from the browser
+var Encoding = base64.RawURLEncoding
+
+// RelyingParty is the site credentials are scoped to
+type RelyingParty struct {
+	// ID is the domain credentials are bound to, such as example.com
+	ID   string
+	Name string
+	// Origins are the web origins allowed to run ceremonies, such as
+	// https://example.com
+	Origins []string
+}
+
+// NewChallenge returns a random base64url challenge for one ceremony
+func NewChallenge() (string, error) {
+	challenge := make([]byte, challengeBytes)
+	_, err := rand.Read(challenge)
+	if err != nil {
+		return "", fmt.Errorf("generating webauthn challenge: %w", err)
+	}
+	return Encoding.EncodeToString(challenge), nil
+}
+
+// User is the account a credential is created for. ID is the user handle the
+// authenticator stores and returns on login, it must not contain personal data.
+type User struct {
+	ID          []byte
+	Name        string
+	DisplayName string
+}
+
+type RPEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	RequireResident  bool   `json:"requireResidentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions are the publicKey options of navigator.credentials.create
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RPEntity               `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the publicKey options of navigator.credentials.get
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// CreationOptions asks for a discoverable credential for user, so it can log
+// in without typing an email. exclude are the ids of the credentials user
+// already has, an authenticator holding one of them refuses to add another.
+func (rp RelyingParty) CreationOptions(challenge string, user User, exclude [][]byte) CreationOptions {
+	excluded := []CredentialDescriptor{}
+	for _, id := range exclude {
+		excluded = append(excluded, CredentialDescriptor{Type: "public-key", ID: Encoding.EncodeToString(id)})
+	}
+	return CreationOptions{
+		Challenge: challenge,
+		RP:        RPEntity{ID: rp.ID, Name: rp.Name},
+		User: UserEntity{
+			ID:          Encoding.EncodeToString(user.ID),
+			Name:        user.Name,
+			DisplayName: user.DisplayName,
+		},
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout:            Timeout.Milliseconds(),
+		ExcludeCredentials: excluded,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "required",
+			RequireResident:  true,
+			UserVerification: "required",
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions asks for any discoverable credential of the relying party
+// with user verification, the credential alone then logs a user in
+func (rp RelyingParty) RequestOptions(challenge string) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		RPID:             rp.ID,
+		Timeout:          Timeout.Milliseconds(),
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: "required",
+	}
+}
+
+// RegistrationResponse is the JSON of the PublicKeyCredential returned by
+// navigator.credentials.create
+type RegistrationResponse struct {
+	ID                      string         `json:"id" validate:"required,max=1400"`
+	RawID                   string         `json:"rawId" validate:"required,max=1400"`
+	Type                    string         `json:"type" validate:"required,oneof=public-key"`
+	AuthenticatorAttachment string         `json:"authenticatorAttachment"`
+	ClientExtensionResults  map[string]any `json:"clientExtensionResults"`
+	Response                struct {
+		ClientDataJSON     string   `json:"clientDataJSON" validate:"required"`
+		AttestationObject  string   `json:"attestationObject" validate:"required"`
+		Transports         []string `json:"transports"`
+		AuthenticatorData  string   `json:"authenticatorData"`
+		PublicKey          string   `json:"publicKey"`
+		PublicKeyAlgorithm int      `json:"publicKeyAlgorithm"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the JSON of the PublicKeyCredential returned by
+// navigator.credentials.get
+type AssertionResponse struct {
+	ID                      string         `json:"id" validate:"required,max=1400"`
+	RawID                   string         `json:"rawId" validate:"required,max=1400"`
+	Type                    string         `json:"type" validate:"required,oneof=public-key"`
+	AuthenticatorAttachment string         `json:"authenticatorAttachment"`
+	ClientExtensionResults  map[string]any `json:"clientExtensionResults"`
+	Response                struct {
+		ClientDataJSON    string `json:"clientDataJSON" validate:"required"`
+		AuthenticatorData string `json:"authenticatorData" validate:"required"`
+		Signature         string `json:"signature" validate:"required"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// Challenge is the challenge the client signed, to find the ceremony the
+// response belongs to
+func (r RegistrationResponse) Challenge() (string, error) {
+	clientData, _, err := parseClientData(r.Response.ClientDataJSON)
+	if err != nil {
+		return "", err
+	}
+	return clientData.Challenge, nil
+}
+
+// Challenge is the challenge the client signed, to find the ceremony the
+// response belongs to
+func (r AssertionResponse) Challenge() (string, error) {
+	clientData, _, err := parseClientData(r.Response.ClientDataJSON)
+	if err != nil {
+		return "", err
+	}
+	return clientData.Challenge, nil
+}
+
+// CredentialID is the decoded raw id of the credential that answered
+func (r AssertionResponse) CredentialID() ([]byte, error) {
+	return decodeCredentialID(r.ID, r.RawID)
+}
+
+// UserHandle is the decoded user handle, empty when the authenticator sent none
+func (r AssertionResponse) UserHandle() ([]byte, error) {
+	return decodeField("userHandle", r.Response.UserHandle)
+}
+
+// Credential is a newly registered public key credential
+type Credential struct {
+	ID []byte
+	// PublicKey is the COSE_Key, kept as is to verify later assertions
+	PublicKey  []byte
+	SignCount  uint32
+	Transports []string
+	// BackupEligible and BackedUp tell whether the credential is a synced
+	// passkey rather than bound to one device
+	BackupEligible bool
+	BackedUp       bool
+}
+
+// Assertion is what a verified login tells about its credential
+type Assertion struct {
+	SignCount uint32
+	BackedUp  bool
+}
+
+// VerifyRegistration checks a response to CreationOptions made with challenge
+// and returns the credential to store
+func (rp RelyingParty) VerifyRegistration(r RegistrationResponse, challenge string) (*Credential, error) {
+	if r.Type != "public-key" {
+		return nil, verificationError("credential type is %q", r.Type)
+	}
+	credentialID, err := decodeCredentialID(r.ID, r.RawID)
+	if err != nil {
+		return nil, err
+	}
+	clientData, clientDataHash, err := parseClientData(r.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	err = rp.checkClientData(clientData, "webauthn.create", challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	rawAttestation, err := decodeField("attestationObject", r.Response.AttestationObject)
+	if err != nil {
+		return nil, err
+	}
+	v, n, err := decodeCBOR(rawAttestation)
+	if err != nil || n != len(rawAttestation) {
+		return nil, verificationError("attestation object is not valid CBOR")
+	}
+	attestation, err := cborMap(v, "attestation object")
+	if err != nil {
+		return nil, verificationError("%s", err)
+	}
+	format, _ := attestation["fmt"].(string)
+	statement, okStatement := attestation["attStmt"].(map[any]any)
+	rawAuthData, okAuthData := attestation["authData"].([]byte)
+	if !okStatement || !okAuthData {
+		return nil, verificationError("attestation object is incomplete")
+	}
+
+	authData, err := parseAuthData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	err = rp.checkAuthData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.credentialID == nil {
+		return nil, verificationError("authenticator data has no credential")
+	}
+	if !bytes.Equal(authData.credentialID, credentialID) {
+		return nil, verificationError("credential id doesn't match the authenticator data")
+	}
+	key, err := parsePublicKey(authData.publicKey)
+	if err != nil {
+		return nil, verificationError("%s", err)
+	}
+
+	switch format {
+	case "none":
+		if len(statement) != 0 {
+			return nil, verificationError("none attestation has a statement")
+		}
+	case "packed":
+		// only self attestation, signed by the credential key itself
+		if _, ok := statement["x5c"]; ok {
+			return nil, verificationError("packed attestation with a certificate is not supported")
+		}
+		alg, _ := cborInt(statement, "alg")
+		sig, ok := cborBytes(statement, "sig")
+		if !ok || alg != key.alg || !key.verify(slices.Concat(rawAuthData, clientDataHash), sig) {
+			return nil, verificationError("packed self attestation signature is invalid")
+		}
+	default:
+		return nil, verificationError("attestation format %q is not supported", format)
+	}
+
+	return &Credential{
+		ID:             credentialID,
+		PublicKey:      authData.publicKey,
+		SignCount:      authData.signCount,
+		Transports:     r.Response.Transports,
+		BackupEligible: authData.flags&flagBackupEligible != 0,
+		BackedUp:       authData.flags&flagBackedUp != 0,
+	}, nil
+}
+
+// VerifyAssertion checks a response to RequestOptions made with challenge
+// against the stored public key and sign count of the credential it names.
+// A sign count that didn't grow means the credential may have been cloned.
+func (rp RelyingParty) VerifyAssertion(r AssertionResponse, challenge string, coseKey []byte, signCount uint32) (*Assertion, error) {
+	if r.Type != "public-key" {
+		return nil, verificationError("credential type is %q", r.Type)
+	}
+	clientData, clientDataHash, err := parseClientData(r.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	err = rp.checkClientData(clientData, "webauthn.get", challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	rawAuthData, err := decodeField("authenticatorData", r.Response.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	authData, err := parseAuthData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	err = rp.checkAuthData(authData)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := decodeField("signature", r.Response.Signature)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parsePublicKey(coseKey)
+	if err != nil {
+		return nil, fmt.Errorf("parsing stored public key: %w", err)
+	}
+	if !key.verify(slices.Concat(rawAuthData, clientDataHash), sig) {
+		return nil, verificationError("signature is invalid")
+	}
+
+	// authenticators without a counter always send zero
+	if (authData.signCount != 0 || signCount != 0) && authData.signCount <= signCount {
+		return nil, verificationError("sign count %d is not above %d, the credential may be cloned", authData.signCount, signCount)
+	}
+	return &Assertion{
+		SignCount: authData.signCount,
+		BackedUp:  authData.flags&flagBackedUp != 0,
+	}, nil
+}
+
+// clientData is the part of CollectedClientData a relying party checks
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// parseClientData decodes clientDataJSON and returns it with its hash, which
+// is what authenticators sign
+func parseClientData(encoded string) (*clientData, []byte, error) {
+	raw, err := decodeField("clientDataJSON", encoded)
+	if err != nil {
+		return nil, nil, err
+	}
+	var data clientData
+	err = json.Unmarshal(raw, &data)
+	if err != nil {
+		return nil, nil, verificationError("clientDataJSON is not valid JSON")
+	}
+	hash := sha256.Sum256(raw)
+	return &data, hash[:], nil
+}
+
+func (rp RelyingParty) checkClientData(data *clientData, ceremony, challenge string) error {
+	if data.Type != ceremony {
+		return verificationError("client data type is %q, want %q", data.Type, ceremony)
+	}
+	if subtle.ConstantTimeCompare([]byte(data.Challenge), []byte(challenge)) != 1 {
+		return verificationError("challenge doesn't match")
+	}
+	if !slices.Contains(rp.Origins, data.Origin) {
+		return verificationError("origin %q is not allowed", data.Origin)
+	}
+	if data.CrossOrigin {
+		return verificationError("cross origin ceremonies are not allowed")
+	}
+	return nil
+}
+
+type authData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// parseAuthData splits authenticator data, the attested credential is only
+// there on registration
+func parseAuthData(raw []byte) (*authData, error) {
+	if len(raw) < 37 {
+		return nil, verificationError("authenticator data is too short")
+	}
+	data := authData{
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	rest := raw[37:]
+
+	if data.flags&flagAttestedData != 0 {
+		// aaguid, then the length of the credential id
+		if len(rest) < 18 {
+			return nil, verificationError("attested credential data is too short")
+		}
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength > maxCredentialIDBytes || len(rest) < idLength {
+			return nil, verificationError("credential id is too long")
+		}
+		data.credentialID = rest[:idLength]
+		rest = rest[idLength:]
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, verificationError("credential public key is not valid CBOR")
+		}
+		data.publicKey = rest[:n]
+		rest = rest[n:]
+	}
+	if data.flags&flagExtensionData != 0 {
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, verificationError("extensions are not valid CBOR")
+		}
+		rest = rest[n:]
+	}
+	if len(rest) != 0 {
+		return nil, verificationError("authenticator data has trailing bytes")
+	}
+	return &data, nil
+}
+
+// checkAuthData checks the relying party and that the user was there and
+// verified, with a PIN or biometrics
+func (rp RelyingParty) checkAuthData(data *authData) error {
+	want := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(data.rpIDHash, want[:]) {
+		return verificationError("credential is for another relying party")
+	}
+	if data.flags&flagUserPresent == 0 {
+		return verificationError("user was not present")
+	}
+	if data.flags&flagUserVerified == 0 {
+		return verificationError("user was not verified")
+	}
+	if data.flags&flagBackedUp != 0 && data.flags&flagBackupEligible == 0 {
+		return verificationError("credential is backed up but not backup eligible")
+	}
+	return nil
+}
+
+func decodeCredentialID(id, rawID string) ([]byte, error) {
+	raw, err := decodeField("rawId", rawID)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 || len(raw) > maxCredentialIDBytes || strings.TrimRight(id, "=") != Encoding.EncodeToString(raw) {
+		return nil, verificationError("credential id is invalid")
+	}
+	return raw, nil
+}
+
+// decodeField decodes a base64url field, with or without padding
+func decodeField(name, encoded string) ([]byte, error) {
+	b, err := Encoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return nil, verificationError("%s is not base64url", name)
+	}
+	return b, nil
+}
+
+func verificationError(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrVerification, fmt.Sprintf(format, args...))
+}
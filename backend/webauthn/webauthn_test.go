@@ -0,0 +1,144 @@
+package webauthn_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/suryasaputra2016/course/backend/webauthn"
+	"github.com/suryasaputra2016/course/backend/webauthn/softauthn"
+)
+
+const origin = "https://course.test"
+
+var rp = webauthn.RelyingParty{ID: "course.test", Name: "Course", Origins: []string{origin}}
+
+var user = webauthn.User{ID: []byte{0, 0, 0, 0, 0, 0, 0, 7}, Name: "ada@example.com", DisplayName: "ada@example.com"}
+
+// register creates a credential on authenticator and verifies it
+func register(t *testing.T, authenticator *softauthn.Authenticator) *webauthn.Credential {
+	t.Helper()
+	challenge, _ := webauthn.NewChallenge()
+	response, err := authenticator.Create(rp.CreationOptions(challenge, user, nil))
+	if err != nil {
+		t.Fatalf("creating credential: %s", err)
+	}
+	credential, err := rp.VerifyRegistration(response, challenge)
+	if err != nil {
+		t.Fatalf("verifying registration: %s", err)
+	}
+	return credential
+}
+
+func TestCeremonies(t *testing.T) {
+	authenticator := softauthn.New(origin)
+	credential := register(t, authenticator)
+
+	signCount := credential.SignCount
+	for range 2 {
+		challenge, _ := webauthn.NewChallenge()
+		response, err := authenticator.Get(rp.RequestOptions(challenge))
+		if err != nil {
+			t.Fatalf("getting assertion: %s", err)
+		}
+		id, err := response.CredentialID()
+		if err != nil || string(id) != string(credential.ID) {
+			t.Fatalf("assertion credential id = %x, %v, want %x", id, err, credential.ID)
+		}
+		handle, _ := response.UserHandle()
+		if string(handle) != string(user.ID) {
+			t.Errorf("user handle = %x, want %x", handle, user.ID)
+		}
+		assertion, err := rp.VerifyAssertion(response, challenge, credential.PublicKey, signCount)
+		if err != nil {
+			t.Fatalf("verifying assertion: %s", err)
+		}
+		signCount = assertion.SignCount
+	}
+
+	// a clone of the authenticator falls behind the stored count
+	authenticator.SetSignCount(0)
+	challenge, _ := webauthn.NewChallenge()
+	response, _ := authenticator.Get(rp.RequestOptions(challenge))
+	_, err := rp.VerifyAssertion(response, challenge, credential.PublicKey, signCount)
+	if !errors.Is(err, webauthn.ErrVerification) {
+		t.Errorf("cloned sign count error = %v, want webauthn.ErrVerification", err)
+	}
+}
+
+func TestRegistrationIsChecked(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(a *softauthn.Authenticator, options *webauthn.CreationOptions)
+		// challenge replaces the expected challenge when not empty
+		challenge string
+	}{
+		{name: "other challenge", challenge: "b3RoZXI"},
+		{name: "other origin", setup: func(a *softauthn.Authenticator, _ *webauthn.CreationOptions) {
+			a.Origin = "https://evil.test"
+		}},
+		{name: "other relying party", setup: func(_ *softauthn.Authenticator, options *webauthn.CreationOptions) {
+			options.RP.ID = "evil.test"
+		}},
+		{name: "user not verified", setup: func(a *softauthn.Authenticator, _ *webauthn.CreationOptions) {
+			a.Flags = softauthn.FlagUserPresent
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator := softauthn.New(origin)
+			challenge, _ := webauthn.NewChallenge()
+			options := rp.CreationOptions(challenge, user, nil)
+			if tt.setup != nil {
+				tt.setup(authenticator, &options)
+			}
+			response, err := authenticator.Create(options)
+			if err != nil {
+				t.Fatalf("creating credential: %s", err)
+			}
+			if tt.challenge != "" {
+				challenge = tt.challenge
+			}
+			_, err = rp.VerifyRegistration(response, challenge)
+			if !errors.Is(err, webauthn.ErrVerification) {
+				t.Errorf("error = %v, want webauthn.ErrVerification", err)
+			}
+		})
+	}
+}
+
+func TestAssertionIsChecked(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(r *webauthn.AssertionResponse)
+	}{
+		{name: "signature", tamper: func(r *webauthn.AssertionResponse) {
+			sig, _ := webauthn.Encoding.DecodeString(r.Response.Signature)
+			sig[len(sig)-1] ^= 1
+			r.Response.Signature = webauthn.Encoding.EncodeToString(sig)
+		}},
+		{name: "authenticator data", tamper: func(r *webauthn.AssertionResponse) {
+			data, _ := webauthn.Encoding.DecodeString(r.Response.AuthenticatorData)
+			data[36]++
+			r.Response.AuthenticatorData = webauthn.Encoding.EncodeToString(data)
+		}},
+		{name: "client data", tamper: func(r *webauthn.AssertionResponse) {
+			r.Response.ClientDataJSON = webauthn.Encoding.EncodeToString([]byte(`{"type":"webauthn.create"}`))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator := softauthn.New(origin)
+			credential := register(t, authenticator)
+			challenge, _ := webauthn.NewChallenge()
+			response, err := authenticator.Get(rp.RequestOptions(challenge))
+			if err != nil {
+				t.Fatalf("getting assertion: %s", err)
+			}
+			tt.tamper(&response)
+			_, err = rp.VerifyAssertion(response, challenge, credential.PublicKey, credential.SignCount)
+			if !errors.Is(err, webauthn.ErrVerification) {
+				t.Errorf("error = %v, want webauthn.ErrVerification", err)
+			}
+		})
+	}
+}